@@ -2,63 +2,457 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
-	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"sawthet.go-press-server.net/internal/models"
 	"sawthet.go-press-server.net/internal/services/job"
+	"sawthet.go-press-server.net/internal/services/store"
+	"sawthet.go-press-server.net/internal/services/validation"
+	"sawthet.go-press-server.net/internal/utils"
 )
 
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Hello World!"))
 }
 
-func (app *application) submitBuildJob(w http.ResponseWriter, r *http.Request) {
+func (app *application) listProjects(w http.ResponseWriter, r *http.Request) {
+	projects, err := app.projects.List()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, projects)
+}
+
+func (app *application) createProject(w http.ResponseWriter, r *http.Request) {
+	var project models.Project
+	if err := app.readJSON(w, r, &project); err != nil {
+		if errors.Is(err, errEmptyBody) {
+			app.errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		app.requestErrorResponse(w, err)
+		return
+	}
+
+	// Assign an ID when the client did not choose one
+	if project.ID == "" {
+		project.ID = utils.NewID()
+	}
+
+	// Refuse build configs the pipeline could never run
+	if issues := app.buildConfigIssues(project); len(issues) > 0 {
+		app.validationErrorResponse(w, issues)
+		return
+	}
+
+	rev, err := app.projects.Create(project, revisionInfo(r))
+	if err != nil {
+		app.storeErrorResponse(w, err)
+		return
+	}
+
+	setRevisionHeaders(w, rev)
+	w.Header().Set("Location", fmt.Sprintf("/projects/%s", project.ID))
+	app.writeJSON(w, http.StatusCreated, project)
+}
+
+func (app *application) getProject(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	project, err := app.projects.Get(params.ByName("id"))
+	if err != nil {
+		app.storeErrorResponse(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, project)
+}
+
+func (app *application) updateProject(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	var project models.Project
+	if err := app.readJSON(w, r, &project); err != nil {
+		if errors.Is(err, errEmptyBody) {
+			app.errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		app.requestErrorResponse(w, err)
+		return
+	}
+
+	// The URL is authoritative for the project ID
+	project.ID = params.ByName("id")
+
+	if issues := app.buildConfigIssues(project); len(issues) > 0 {
+		app.validationErrorResponse(w, issues)
+		return
+	}
+
+	rev, err := app.projects.Update(project, revisionInfo(r))
+	if err != nil {
+		app.storeErrorResponse(w, err)
+		return
+	}
+
+	setRevisionHeaders(w, rev)
+	app.writeJSON(w, http.StatusOK, project)
+}
+
+func (app *application) patchProject(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
 	projectID := params.ByName("id")
 
-	// For now, we'll use the sample project data
-	projectData, err := os.ReadFile("data/project_1.json")
+	var patch any
+	if err := app.readJSON(w, r, &patch); err != nil {
+		if errors.Is(err, errEmptyBody) {
+			app.errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		app.requestErrorResponse(w, err)
+		return
+	}
+
+	existing, err := app.projects.Get(projectID)
+	if err != nil {
+		app.storeErrorResponse(w, err)
+		return
+	}
+
+	// Apply the body as a JSON merge patch (RFC 7396) to the stored document
+	project, err := applyMergePatch(existing, patch)
+	if err != nil {
+		app.requestErrorResponse(w, err)
+		return
+	}
+	project.ID = projectID
+
+	if issues := app.buildConfigIssues(project); len(issues) > 0 {
+		app.validationErrorResponse(w, issues)
+		return
+	}
+
+	rev, err := app.projects.Update(project, revisionInfo(r))
+	if err != nil {
+		app.storeErrorResponse(w, err)
+		return
+	}
+
+	setRevisionHeaders(w, rev)
+	app.writeJSON(w, http.StatusOK, project)
+}
+
+func (app *application) deleteProject(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	if err := app.projects.Delete(params.ByName("id")); err != nil {
+		app.storeErrorResponse(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) listProjectRevisions(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	revisions, err := app.projects.ListRevisions(params.ByName("id"))
+	if err != nil {
+		app.storeErrorResponse(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, revisions)
+}
+
+func (app *application) getProjectRevision(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	number, err := parseRevision(params.ByName("revision"))
+	if err != nil {
+		app.requestErrorResponse(w, err)
+		return
+	}
+
+	project, rev, err := app.projects.GetRevision(params.ByName("id"), number)
+	if err != nil {
+		app.storeErrorResponse(w, err)
+		return
+	}
+
+	response := struct {
+		Revision store.Revision `json:"revision"`
+		Project  models.Project `json:"project"`
+	}{
+		Revision: rev,
+		Project:  project,
+	}
+
+	app.writeJSON(w, http.StatusOK, response)
+}
+
+func (app *application) diffProjectRevisions(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	projectID := params.ByName("id")
+
+	number, err := parseRevision(params.ByName("revision"))
+	if err != nil {
+		app.requestErrorResponse(w, err)
+		return
+	}
+
+	// Compare against the previous revision unless another one is requested
+	against := number - 1
+	if value := r.URL.Query().Get("against"); value != "" {
+		against, err = parseRevision(value)
+		if err != nil {
+			app.requestErrorResponse(w, err)
+			return
+		}
+	}
+
+	var base models.Project
+	if against > 0 {
+		base, _, err = app.projects.GetRevision(projectID, against)
+		if err != nil {
+			app.storeErrorResponse(w, err)
+			return
+		}
+	}
+
+	project, _, err := app.projects.GetRevision(projectID, number)
+	if err != nil {
+		app.storeErrorResponse(w, err)
+		return
+	}
+
+	changes, err := store.Diff(base, project)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
+	response := struct {
+		From    int            `json:"from"`
+		To      int            `json:"to"`
+		Changes []store.Change `json:"changes"`
+	}{
+		From:    against,
+		To:      number,
+		Changes: changes,
+	}
+
+	app.writeJSON(w, http.StatusOK, response)
+}
+
+func (app *application) restoreProjectRevision(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	projectID := params.ByName("id")
+
+	number, err := parseRevision(params.ByName("revision"))
+	if err != nil {
+		app.requestErrorResponse(w, err)
+		return
+	}
+
+	project, _, err := app.projects.GetRevision(projectID, number)
+	if err != nil {
+		app.storeErrorResponse(w, err)
+		return
+	}
+
+	// Restoring saves the old content as a new revision, keeping history intact
+	info := revisionInfo(r)
+	if info.Message == "" {
+		info.Message = fmt.Sprintf("Restore revision %d", number)
+	}
+
+	if issues := app.buildConfigIssues(project); len(issues) > 0 {
+		app.validationErrorResponse(w, issues)
+		return
+	}
+
+	rev, err := app.projects.Update(project, info)
+	if err != nil {
+		app.storeErrorResponse(w, err)
+		return
+	}
+
+	setRevisionHeaders(w, rev)
+	app.writeJSON(w, http.StatusOK, project)
+}
+
+func (app *application) validateProject(w http.ResponseWriter, r *http.Request) {
 	var project models.Project
-	if err := json.Unmarshal(projectData, &project); err != nil {
-		app.serverError(w, err)
+	if err := app.readJSON(w, r, &project); err != nil {
+		if errors.Is(err, errEmptyBody) {
+			app.errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		app.requestErrorResponse(w, err)
+		return
+	}
+
+	issues := append(validation.Validate(project), app.buildConfigIssues(project)...)
+
+	response := struct {
+		Valid  bool                         `json:"valid"`
+		Issues []validation.ValidationIssue `json:"issues"`
+	}{
+		Valid:  !validation.HasErrors(issues),
+		Issues: issues,
+	}
+
+	app.writeJSON(w, http.StatusOK, response)
+}
+
+func (app *application) submitBuildJob(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	projectID := params.ByName("id")
+
+	priority, err := job.ParsePriority(r.URL.Query().Get("priority"))
+	if err != nil {
+		app.errorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	// Drafts are previews styled by the Tailwind CDN instead of a compiled stylesheet
+	draft, err := parseDraft(r.URL.Query().Get("draft"))
+	if err != nil {
+		app.requestErrorResponse(w, err)
+		return
+	}
+
+	// Build a stored revision when one is requested; otherwise decode the
+	// project from the request body, falling back to the latest saved
+	// version in the project store when no body is sent
+	var project models.Project
+	if value := r.URL.Query().Get("revision"); value != "" {
+		number, err := parseRevision(value)
+		if err != nil {
+			app.requestErrorResponse(w, err)
+			return
+		}
+
+		project, _, err = app.projects.GetRevision(projectID, number)
+		if err != nil {
+			app.storeErrorResponse(w, err)
+			return
+		}
+	} else {
+		err := app.readJSON(w, r, &project)
+		if errors.Is(err, errEmptyBody) {
+			project, err = app.projects.Get(projectID)
+			if err != nil {
+				app.storeErrorResponse(w, err)
+				return
+			}
+		} else if err != nil {
+			app.requestErrorResponse(w, err)
+			return
+		}
+	}
+
 	// Set the project ID from the URL parameter
 	project.ID = projectID
 
-	// Submit job to queue
-	jobID := app.jobQueue.SubmitJob(project)
-	if jobID == "" {
-		app.clientError(w, http.StatusBadRequest)
+	// Refuse to build projects with structural errors or build configs the
+	// pipeline cannot run
+	issues := append(validation.Validate(project), app.buildConfigIssues(project)...)
+	if validation.HasErrors(issues) {
+		app.validationErrorResponse(w, issues)
+		return
+	}
+
+	// Submit job to queue without waiting for a worker
+	jobID, placement, err := app.jobQueue.SubmitJob(project, job.SubmitOptions{
+		Priority: priority,
+		Draft:    draft,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, job.ErrQueueFull):
+			retryAfter := int(math.Ceil(app.jobQueue.RetryAfter().Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+			app.errorResponse(w, http.StatusServiceUnavailable, err.Error())
+		case errors.Is(err, job.ErrProjectIDRequired):
+			app.errorResponse(w, http.StatusBadRequest, err.Error())
+		default:
+			app.serverError(w, err)
+		}
 		return
 	}
 
 	// Return job ID and WebSocket URL to client
 	response := struct {
-		JobID     string `json:"jobId"`
-		SocketURL string `json:"socketUrl"`
+		JobID          string `json:"jobId"`
+		Status         string `json:"status"`
+		Priority       string `json:"priority"`
+		Draft          bool   `json:"draft"`
+		QueuePosition  int    `json:"queuePosition"`
+		EstimatedStart string `json:"estimatedStart"`
+		SocketURL      string `json:"socketUrl"`
 	}{
-		JobID:     jobID,
-		SocketURL: fmt.Sprintf("/ws?jobId=%s", jobID),
+		JobID:          jobID,
+		Status:         string(job.StatusPending),
+		Priority:       string(priority),
+		Draft:          draft,
+		QueuePosition:  placement.Position,
+		EstimatedStart: placement.EstimatedStart.Format(time.RFC3339),
+		SocketURL:      fmt.Sprintf("/ws?jobId=%s", jobID),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		app.serverError(w, err)
-		return
+	app.writeJSON(w, http.StatusAccepted, response)
+}
+
+func (app *application) listProjectBuilds(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	type build struct {
+		JobID       string `json:"jobId"`
+		Status      string `json:"status"`
+		Progress    int    `json:"progress"`
+		Message     string `json:"message"`
+		Priority    string `json:"priority"`
+		Draft       bool   `json:"draft"`
+		Attempt     int    `json:"attempt"`
+		CreatedAt   string `json:"createdAt"`
+		UpdatedAt   string `json:"updatedAt"`
+		ExpiresAt   string `json:"expiresAt,omitempty"`
+		DownloadURL string `json:"downloadUrl,omitempty"`
+	}
+
+	builds := []build{}
+	for _, buildJob := range app.jobQueue.ListProjectJobs(params.ByName("id")) {
+		b := build{
+			JobID:     buildJob.ID,
+			Status:    string(buildJob.Status),
+			Progress:  buildJob.Progress,
+			Message:   buildJob.Message,
+			Priority:  string(buildJob.Priority),
+			Draft:     buildJob.Draft,
+			Attempt:   buildJob.Attempt,
+			CreatedAt: buildJob.CreatedAt.Format(time.RFC3339),
+			UpdatedAt: buildJob.UpdatedAt.Format(time.RFC3339),
+			ExpiresAt: expiresAt(&buildJob),
+		}
+		if buildJob.Status == job.StatusCompleted {
+			b.DownloadURL = fmt.Sprintf("/jobs/%s/download", buildJob.ID)
+		}
+		builds = append(builds, b)
 	}
+
+	app.writeJSON(w, http.StatusOK, builds)
 }
 
 func (app *application) downloadJobResult(w http.ResponseWriter, r *http.Request) {
@@ -77,7 +471,7 @@ func (app *application) downloadJobResult(w http.ResponseWriter, r *http.Request
 	}
 
 	// Check if zip file exists
-	zipPath := filepath.Join("static", "sites", jobID+".zip")
+	zipPath := job.ZipPath(jobID)
 	if _, err := os.Stat(zipPath); os.IsNotExist(err) {
 		app.clientError(w, http.StatusGone)
 		return
@@ -93,7 +487,7 @@ func (app *application) downloadJobResult(w http.ResponseWriter, r *http.Request
 
 	// Set headers for file download
 	w.Header().Set("Content-Type", "application/zip")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", jobID))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s.zip", buildJob.ProjectID, jobID))
 
 	// Stream the file to the client
 	if _, err := io.Copy(w, zipFile); err != nil {
@@ -102,6 +496,35 @@ func (app *application) downloadJobResult(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// stageResponse describes a build pipeline stage of a job
+type stageResponse struct {
+	Name       string         `json:"name"`
+	Status     string         `json:"status"`
+	Weight     int            `json:"weight"`
+	StartedAt  string         `json:"startedAt,omitempty"`
+	DurationMs int64          `json:"durationMs"`
+	Error      string         `json:"error,omitempty"`
+	Logs       []job.StageLog `json:"logs,omitempty"`
+}
+
+func newStageResponses(records []job.StageRecord) []stageResponse {
+	stages := make([]stageResponse, len(records))
+	for i, record := range records {
+		stages[i] = stageResponse{
+			Name:       record.Name,
+			Status:     string(record.Status),
+			Weight:     record.Weight,
+			DurationMs: record.Duration().Milliseconds(),
+			Error:      record.Error,
+			Logs:       record.Logs,
+		}
+		if !record.StartedAt.IsZero() {
+			stages[i].StartedAt = record.StartedAt.Format(time.RFC3339)
+		}
+	}
+	return stages
+}
+
 func (app *application) checkJobAvailability(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
 	jobID := params.ByName("id")
@@ -113,19 +536,41 @@ func (app *application) checkJobAvailability(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Check if job directory exists
-	jobDir := filepath.Join("static", "sites", jobID+".zip")
+	jobDir := job.ZipPath(jobID)
 	_, dirErr := os.Stat(jobDir)
 
 	response := struct {
-		Exists       bool   `json:"exists"`
-		Status       string `json:"status"`
-		FolderExists bool   `json:"folderExists"`
-		ExpiresAt    string `json:"expiresAt"`
+		Exists         bool            `json:"exists"`
+		Status         string          `json:"status"`
+		FolderExists   bool            `json:"folderExists"`
+		ExpiresAt      string          `json:"expiresAt,omitempty"`
+		Attempt        int             `json:"attempt"`
+		MaxAttempts    int             `json:"maxAttempts"`
+		Priority       string          `json:"priority"`
+		Draft          bool            `json:"draft"`
+		QueuePosition  int             `json:"queuePosition,omitempty"`
+		EstimatedStart string          `json:"estimatedStart,omitempty"`
+		Stages         []stageResponse `json:"stages"`
+		Pages          *job.PageReport `json:"pages,omitempty"`
+		Manifest       *job.Manifest   `json:"manifest,omitempty"`
 	}{
 		Exists:       true,
 		Status:       string(buildJob.Status),
 		FolderExists: dirErr == nil,
-		ExpiresAt:    buildJob.ExpiresAt.Format(time.RFC3339),
+		ExpiresAt:    expiresAt(buildJob),
+		Attempt:      buildJob.Attempt,
+		MaxAttempts:  buildJob.Retry.MaxAttempts,
+		Priority:     string(buildJob.Priority),
+		Draft:        buildJob.Draft,
+		Stages:       newStageResponses(buildJob.Stages),
+		Pages:        buildJob.Pages,
+		Manifest:     buildJob.Manifest,
+	}
+
+	// Pending jobs report where the scheduler has placed them
+	if placement, ok := app.jobQueue.Placement(jobID); ok {
+		response.QueuePosition = placement.Position
+		response.EstimatedStart = placement.EstimatedStart.Format(time.RFC3339)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -135,6 +580,225 @@ func (app *application) checkJobAvailability(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+func (app *application) cancelJob(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	jobID := params.ByName("id")
+
+	status, err := app.jobQueue.CancelJob(jobID)
+	if err != nil {
+		switch {
+		case errors.Is(err, job.ErrJobNotFound):
+			app.errorResponse(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, job.ErrJobFinished):
+			app.errorResponse(w, http.StatusConflict, err.Error())
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// Running jobs stop asynchronously; the final status arrives over the WebSocket
+	response := struct {
+		JobID  string `json:"jobId"`
+		Status string `json:"status"`
+	}{
+		JobID:  jobID,
+		Status: string(status),
+	}
+
+	app.writeJSON(w, http.StatusAccepted, response)
+}
+
 func (app *application) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	app.socketManager.HandleConnection(w, r)
 }
+
+// handleEventStream serves the multiplexed WebSocket for watching many jobs
+// and projects over one connection
+func (app *application) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	if app.streamToken == "" {
+		app.errorResponse(w, http.StatusUnauthorized, "the event stream is disabled: no stream token is configured")
+		return
+	}
+	if !app.authorizeStream(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="stream"`)
+		app.errorResponse(w, http.StatusUnauthorized, "a valid stream token is required")
+		return
+	}
+	app.socketManager.HandleStream(w, r)
+}
+
+// sseKeepAlive is how often an idle event stream sends a comment, so proxies
+// do not close it
+const sseKeepAlive = 15 * time.Second
+
+// streamJobEvents streams the same progress events as the WebSocket as
+// server-sent events. Clients resume after the Last-Event-ID header or the
+// since parameter; without either they start from the job's current state.
+// The stream ends after the job's final event.
+func (app *application) streamJobEvents(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	jobID := params.ByName("id")
+
+	value, resume := r.Header.Get("Last-Event-ID"), true
+	if value == "" {
+		value, resume = r.URL.Query().Get("since"), r.URL.Query().Has("since")
+	}
+	var since uint64
+	if resume {
+		var err error
+		if since, err = parseSince(value); err != nil {
+			app.requestErrorResponse(w, err)
+			return
+		}
+	}
+
+	snapshot, backlog, sub, err := app.jobQueue.Subscribe(jobID, since, resume, false)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+	defer sub.Unsubscribe()
+
+	// Browsers reconnect whenever a stream ends; 204 tells them the job has
+	// nothing more to send
+	if resume && snapshot.Status.IsFinal() && len(backlog) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// The stream lasts as long as the build
+	rc, err := startEventStream(w)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	for _, event := range backlog {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.C:
+			// Evicted clients reconnect and resume from their last event
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-app.closing:
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// getJobLogs returns a page of a job's structured build log. With follow
+// set, the log is streamed as server-sent events instead, from the same
+// starting point until the job finishes; clients resume after the
+// Last-Event-ID header.
+func (app *application) getJobLogs(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	jobID := params.ByName("id")
+
+	query, err := parseLogQuery(r)
+	if err != nil {
+		app.requestErrorResponse(w, err)
+		return
+	}
+
+	var follow bool
+	if value := r.URL.Query().Get("follow"); value != "" {
+		if follow, err = strconv.ParseBool(value); err != nil {
+			app.errorResponse(w, http.StatusBadRequest, fmt.Sprintf("invalid follow flag %q", value))
+			return
+		}
+	}
+
+	if !follow {
+		page, err := app.jobQueue.Logs(jobID, query)
+		if err != nil {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.writeJSON(w, http.StatusOK, page)
+		return
+	}
+
+	page, sub, err := app.jobQueue.FollowLogs(jobID, query)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+	defer sub.Unsubscribe()
+
+	// As with progress events, 204 stops browsers from reconnecting once a
+	// finished job's log has been read
+	if r.Header.Get("Last-Event-ID") != "" && page.Done && len(page.Logs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	rc, err := startEventStream(w)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	for _, entry := range page.Logs {
+		if err := writeLogEvent(w, entry); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.C:
+			// Evicted clients reconnect and resume from their last line
+			if !ok {
+				return
+			}
+			if !query.Matches(*event.Log) {
+				continue
+			}
+			if err := writeLogEvent(w, *event.Log); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-app.closing:
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
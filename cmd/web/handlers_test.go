@@ -0,0 +1,379 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	gorilla "github.com/gorilla/websocket"
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/services/job"
+	"sawthet.go-press-server.net/internal/services/store"
+	"sawthet.go-press-server.net/internal/services/validation"
+	"sawthet.go-press-server.net/internal/services/websocket"
+)
+
+// invalidProject has two pages writing the same file and a link without href
+const invalidProject = `{
+	"name": "Site",
+	"pages": [
+		{"id": "home", "title": "Home", "slug": "/", "components": [{"type": "link", "id": "a", "href": ""}]},
+		{"id": "index", "title": "Index", "slug": "/index", "components": []}
+	]
+}`
+
+func TestBuildRefusesInvalidProject(t *testing.T) {
+	app := newTestApplication(t, job.Config{})
+
+	w := send(t, app, http.MethodPost, "/projects/site/build", invalidProject)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d; body %s", w.Code, http.StatusUnprocessableEntity, w.Body)
+	}
+
+	var body struct {
+		Error  string                       `json:"error"`
+		Issues []validation.ValidationIssue `json:"issues"`
+	}
+	decode(t, w, &body)
+	if body.Error == "" {
+		t.Error("response has no error message")
+	}
+	want := map[string]string{
+		"/pages/0/components/0/href": "empty-href",
+		"/pages/1/slug":              "duplicate-slug",
+	}
+	for _, issue := range body.Issues {
+		if code, ok := want[issue.Path]; ok && code == issue.Code && issue.Severity == validation.SeverityError && issue.Message != "" {
+			delete(want, issue.Path)
+		}
+	}
+	if len(want) > 0 {
+		t.Errorf("issues %+v are missing %v", body.Issues, want)
+	}
+	if jobs := app.jobQueue.ListProjectJobs("site"); len(jobs) != 0 {
+		t.Errorf("invalid project was queued: %+v", jobs)
+	}
+}
+
+func TestValidateProject(t *testing.T) {
+	app := newTestApplication(t, job.Config{})
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		valid  bool
+		codes  []string
+	}{
+		{"valid", `{"pages": [{"id": "home", "title": "Home", "slug": "/"}]}`, http.StatusOK, true, nil},
+		{"invalid", invalidProject, http.StatusOK, false, []string{"empty-href", "duplicate-slug"}},
+		{"unknown stage", `{"pages": [{"id": "home", "title": "Home", "slug": "/"}], "build": {"stages": ["deploy"]}}`, http.StatusOK, false, []string{"invalid-build"}},
+		{"empty body", ``, http.StatusBadRequest, false, nil},
+	}
+	for _, tt := range tests {
+		w := send(t, app, http.MethodPost, "/projects/validate", tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d; body %s", tt.name, w.Code, tt.status, w.Body)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+
+		var body struct {
+			Valid  bool                         `json:"valid"`
+			Issues []validation.ValidationIssue `json:"issues"`
+		}
+		decode(t, w, &body)
+		if body.Valid != tt.valid {
+			t.Errorf("%s: valid = %t, want %t; issues %+v", tt.name, body.Valid, tt.valid, body.Issues)
+		}
+		codes := map[string]bool{}
+		for _, issue := range body.Issues {
+			codes[issue.Code] = true
+		}
+		for _, code := range tt.codes {
+			if !codes[code] {
+				t.Errorf("%s: issues %+v have no %s", tt.name, body.Issues, code)
+			}
+		}
+	}
+}
+
+func TestPostToProjectIsNotAllowed(t *testing.T) {
+	app := newTestApplication(t, job.Config{})
+
+	w := send(t, app, http.MethodPost, "/projects/site", `{}`)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, PUT, PATCH, DELETE" {
+		t.Errorf("Allow = %q", allow)
+	}
+	var body errorBody
+	decode(t, w, &body)
+	if body.Error == "" {
+		t.Error("response has no error message")
+	}
+}
+
+// submittedJob returns the job a build request queued
+func submittedJob(t *testing.T, app *application, w *httptest.ResponseRecorder) *job.BuildJob {
+	t.Helper()
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d; body %s", w.Code, http.StatusAccepted, w.Body)
+	}
+	var body struct {
+		JobID string `json:"jobId"`
+	}
+	decode(t, w, &body)
+	build, err := app.jobQueue.GetJobStatus(body.JobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return build
+}
+
+func TestBuildPrefersBodyOverStoredProject(t *testing.T) {
+	app := newTestApplication(t, job.Config{})
+
+	// Without a stored project an empty body has nothing to build
+	if w := send(t, app, http.MethodPost, "/projects/site/build", ""); w.Code != http.StatusNotFound {
+		t.Errorf("empty body without a stored project: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	stored := models.Project{ID: "site", Name: "Stored", Pages: []models.Page{{ID: "home", Title: "Home", Slug: "/"}}}
+	if _, err := app.projects.Create(stored, store.RevisionInfo{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"body", `{"id": "other", "name": "Sent", "pages": [{"id": "home", "title": "Home", "slug": "/"}]}`, "Sent"},
+		{"empty body", "", "Stored"},
+	}
+	for _, tt := range tests {
+		build := submittedJob(t, app, send(t, app, http.MethodPost, "/projects/site/build", tt.body))
+		// The URL names the project, whatever ID the body holds
+		if build.Project.Name != tt.want || build.ProjectID != "site" || build.Project.ID != "site" {
+			t.Errorf("%s: built %q as %s/%s, want %q as site", tt.name, build.Project.Name, build.ProjectID, build.Project.ID, tt.want)
+		}
+	}
+}
+
+func TestBuildRefusedWhenQueueIsFull(t *testing.T) {
+	gate := gateStage{release: make(chan struct{})}
+	app := newTestApplication(t, job.Config{Workers: 1, Backlog: 1, Stages: []job.Stage{gate}})
+	defer close(gate.release)
+
+	const project = `{"pages": [{"id": "home", "title": "Home", "slug": "/"}]}`
+	running := submittedJob(t, app, send(t, app, http.MethodPost, "/projects/site/build", project))
+	waitForStatus(t, app, running.ID, job.StatusRunning)
+	submittedJob(t, app, send(t, app, http.MethodPost, "/projects/site/build", project))
+
+	// The worker is busy and the backlog holds one pending build
+	w := send(t, app, http.MethodPost, "/projects/site/build", project)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d; body %s", w.Code, http.StatusServiceUnavailable, w.Body)
+	}
+	if seconds, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || seconds < 1 {
+		t.Errorf("Retry-After = %q, want a positive number of seconds", w.Header().Get("Retry-After"))
+	}
+	var body errorBody
+	decode(t, w, &body)
+	if body.Error == "" {
+		t.Error("response has no error message")
+	}
+	if jobs := app.jobQueue.ListProjectJobs("site"); len(jobs) != 2 {
+		t.Errorf("%d jobs queued, want 2", len(jobs))
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	gate := gateStage{release: make(chan struct{})}
+	app := newTestApplication(t, job.Config{Workers: 1, Stages: []job.Stage{gate}})
+	defer close(gate.release)
+
+	const project = `{"pages": [{"id": "home", "title": "Home", "slug": "/"}]}`
+	running := submittedJob(t, app, send(t, app, http.MethodPost, "/projects/site/build", project))
+	waitForStatus(t, app, running.ID, job.StatusRunning)
+	pending := submittedJob(t, app, send(t, app, http.MethodPost, "/projects/site/build", project))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		status int
+	}{
+		{"pending job", http.MethodPost, "/jobs/" + pending.ID + "/cancel", http.StatusAccepted},
+		{"running job", http.MethodDelete, "/jobs/" + running.ID, http.StatusAccepted},
+		{"cancelled job", http.MethodPost, "/jobs/" + pending.ID + "/cancel", http.StatusConflict},
+		{"unknown job", http.MethodPost, "/jobs/missing/cancel", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := send(t, app, tt.method, tt.target, "")
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d; body %s", tt.name, w.Code, tt.status, w.Body)
+			continue
+		}
+		if tt.status == http.StatusAccepted {
+			var body struct {
+				JobID  string `json:"jobId"`
+				Status string `json:"status"`
+			}
+			decode(t, w, &body)
+			if body.JobID == "" || body.Status == "" {
+				t.Errorf("%s: response %+v", tt.name, body)
+			}
+			continue
+		}
+		var body errorBody
+		decode(t, w, &body)
+		if body.Error == "" {
+			t.Errorf("%s: response has no error message", tt.name)
+		}
+	}
+
+	// Both jobs end up cancelled, the running one once its build stops
+	waitForStatus(t, app, pending.ID, job.StatusCancelled)
+	waitForStatus(t, app, running.ID, job.StatusCancelled)
+	if w := send(t, app, http.MethodDelete, "/jobs/"+running.ID, ""); w.Code != http.StatusConflict {
+		t.Errorf("cancelling a finished job: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+}
+
+// eventIDs returns the ids of the events in a text/event-stream body
+func eventIDs(body string) []string {
+	ids := []string{}
+	for _, line := range strings.Split(body, "\n") {
+		if id, found := strings.CutPrefix(line, "id: "); found {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func TestJobEventsResumeAfterLastEventID(t *testing.T) {
+	app := newTestApplication(t, job.Config{})
+
+	build := submittedJob(t, app, send(t, app, http.MethodPost, "/projects/site/build", `{"pages": [{"id": "home", "title": "Home", "slug": "/"}]}`))
+	waitForStatus(t, app, build.ID, job.StatusCompleted)
+
+	// Event streams need a connection that supports write deadlines
+	server := httptest.NewServer(app.routes())
+	defer server.Close()
+
+	// events fetches the stream of the finished job, which ends after its
+	// final event
+	events := func(lastEventID, query string) (int, string, string) {
+		t.Helper()
+		r, err := http.NewRequest(http.MethodGet, server.URL+"/jobs/"+build.ID+"/events"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastEventID != "" {
+			r.Header.Set("Last-Event-ID", lastEventID)
+		}
+		res, err := server.Client().Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, res.Header.Get("Content-Type"), string(body)
+	}
+
+	status, contentType, body := events("", "?since=0")
+	if status != http.StatusOK || contentType != "text/event-stream" {
+		t.Fatalf("status = %d, Content-Type = %q", status, contentType)
+	}
+	all := eventIDs(body)
+	if len(all) < 2 {
+		t.Fatalf("timeline has events %v, want at least 2", all)
+	}
+
+	// A reconnecting client only gets the events after its last one
+	status, _, body = events(all[0], "")
+	if got := eventIDs(body); status != http.StatusOK || !reflect.DeepEqual(got, all[1:]) {
+		t.Errorf("resumed after %s: status %d, events %v; want %v", all[0], status, got, all[1:])
+	}
+	// The header wins over the since parameter
+	_, _, body = events(all[len(all)-2], "?since=0")
+	if got := eventIDs(body); !reflect.DeepEqual(got, all[len(all)-1:]) {
+		t.Errorf("resumed with both: events %v, want %v", got, all[len(all)-1:])
+	}
+
+	// Nothing is left after the final event
+	if status, _, body := events(all[len(all)-1], ""); status != http.StatusNoContent || body != "" {
+		t.Errorf("resumed after the final event: status %d, body %q; want %d", status, body, http.StatusNoContent)
+	}
+	if status, _, _ := events("soon", ""); status != http.StatusBadRequest {
+		t.Errorf("malformed Last-Event-ID: status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestEventStreamRequiresToken(t *testing.T) {
+	app := newTestApplication(t, job.Config{})
+	server := httptest.NewServer(app.routes())
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/stream"
+
+	// dial opens the stream with the given headers and subprotocols
+	dial := func(header http.Header, subprotocols ...string) (*gorilla.Conn, *http.Response, error) {
+		dialer := gorilla.Dialer{Subprotocols: subprotocols}
+		conn, res, err := dialer.Dial(url, header)
+		if conn != nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+		return conn, res, err
+	}
+
+	// Without a configured token the stream is disabled
+	if _, res, err := dial(http.Header{"Authorization": {"Bearer "}}); err == nil || res == nil || res.StatusCode != http.StatusUnauthorized || res.Header.Get("WWW-Authenticate") != "" {
+		t.Errorf("disabled stream: %v", err)
+	}
+
+	app.streamToken = "secret"
+	refused := []struct {
+		name         string
+		header       http.Header
+		subprotocols []string
+	}{
+		{"no token", nil, nil},
+		{"wrong bearer token", http.Header{"Authorization": {"Bearer guess"}}, nil},
+		{"wrong scheme", http.Header{"Authorization": {"Basic secret"}}, nil},
+		{"wrong subprotocol token", nil, []string{websocket.StreamProtocol, "bearer.guess"}},
+	}
+	for _, tt := range refused {
+		_, res, err := dial(tt.header, tt.subprotocols...)
+		if err == nil || res == nil || res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: dial = %v, want %d", tt.name, err, http.StatusUnauthorized)
+			continue
+		}
+		if res.Header.Get("WWW-Authenticate") != `Bearer realm="stream"` {
+			t.Errorf("%s: WWW-Authenticate = %q", tt.name, res.Header.Get("WWW-Authenticate"))
+		}
+	}
+
+	if _, _, err := dial(http.Header{"Authorization": {"Bearer secret"}}); err != nil {
+		t.Errorf("bearer token: %v", err)
+	}
+	// Browsers present the token as a subprotocol and need one answered
+	conn, _, err := dial(nil, websocket.StreamProtocol, "bearer.secret")
+	if err != nil {
+		t.Fatalf("subprotocol token: %v", err)
+	}
+	if conn.Subprotocol() != websocket.StreamProtocol {
+		t.Errorf("subprotocol = %q, want %q", conn.Subprotocol(), websocket.StreamProtocol)
+	}
+}
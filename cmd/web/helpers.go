@@ -1,23 +1,360 @@
 package main
 
 import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/services/job"
+	"sawthet.go-press-server.net/internal/services/store"
+	"sawthet.go-press-server.net/internal/services/validation"
+	"sawthet.go-press-server.net/internal/services/websocket"
 )
 
+// maxRequestBodyBytes limits the size of JSON request bodies
+const maxRequestBodyBytes = 5 << 20
+
+// errEmptyBody is returned by readJSON when the request has no body
+var errEmptyBody = errors.New("request body is empty")
+
+// requestError describes a problem with the client's request
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
 func (app *application) serverError(w http.ResponseWriter, err error) {
 	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-    app.errorLog.Output(2, trace)
+	app.errorLog.Output(2, trace)
 
-    http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
 func (app *application) clientError(w http.ResponseWriter, status int) {
-    http.Error(w, http.StatusText(status), status)
+	http.Error(w, http.StatusText(status), status)
 }
 
 func (app *application) notFound(w http.ResponseWriter) {
-    app.clientError(w, http.StatusNotFound)
+	app.clientError(w, http.StatusNotFound)
+}
+
+// writeJSON encodes data as the JSON response body with the given status
+func (app *application) writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		app.errorLog.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// errorResponse sends a JSON error payload with the given status
+func (app *application) errorResponse(w http.ResponseWriter, status int, message string) {
+	app.writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{
+		Error: message,
+	})
+}
+
+// requestErrorResponse sends the payload for an error returned by readJSON,
+// falling back to a server error for anything unexpected
+func (app *application) requestErrorResponse(w http.ResponseWriter, err error) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		app.errorResponse(w, reqErr.status, reqErr.message)
+		return
+	}
+	app.serverError(w, err)
+}
+
+// validationErrorResponse sends a 422 listing the issues found in a project
+func (app *application) validationErrorResponse(w http.ResponseWriter, issues []validation.ValidationIssue) {
+	app.writeJSON(w, http.StatusUnprocessableEntity, struct {
+		Error  string                       `json:"error"`
+		Issues []validation.ValidationIssue `json:"issues"`
+	}{
+		Error:  "project has validation errors",
+		Issues: issues,
+	})
+}
+
+// buildConfigIssues reports a project build config the job queue's pipeline
+// cannot run, such as one naming unknown stages or leaving out required ones
+func (app *application) buildConfigIssues(project models.Project) []validation.ValidationIssue {
+	if _, err := app.jobQueue.Pipeline(project); err != nil {
+		return []validation.ValidationIssue{{
+			Severity: validation.SeverityError,
+			Code:     "invalid-build",
+			Path:     "/build",
+			Message:  err.Error(),
+		}}
+	}
+	return nil
+}
+
+// storeErrorResponse maps project store errors to HTTP responses
+func (app *application) storeErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrRevisionNotFound):
+		app.errorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrAlreadyExists):
+		app.errorResponse(w, http.StatusConflict, err.Error())
+	case errors.Is(err, store.ErrInvalidID):
+		app.errorResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		app.serverError(w, err)
+	}
+}
+
+// revisionInfo reads the author and message of a project save from the request headers
+func revisionInfo(r *http.Request) store.RevisionInfo {
+	return store.RevisionInfo{
+		Author:  r.Header.Get("X-Revision-Author"),
+		Message: r.Header.Get("X-Revision-Message"),
+	}
+}
+
+// setRevisionHeaders describes a saved revision in the response headers
+func setRevisionHeaders(w http.ResponseWriter, rev store.Revision) {
+	w.Header().Set("X-Project-Revision", strconv.Itoa(rev.Number))
+	w.Header().Set("ETag", strconv.Quote(rev.Hash))
+}
+
+// parseRevision parses a positive revision number
+func parseRevision(value string) (int, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		return 0, &requestError{http.StatusBadRequest, fmt.Sprintf("invalid revision %q", value)}
+	}
+	return number, nil
+}
+
+// parseDraft parses the optional draft flag of a build request
+func parseDraft(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	draft, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, &requestError{http.StatusBadRequest, fmt.Sprintf("invalid draft flag %q", value)}
+	}
+	return draft, nil
+}
+
+// authorizeStream reports whether a request presents the stream token, as a
+// bearer token or, since browsers cannot set headers on WebSockets, as the
+// "bearer.<token>" subprotocol. Without a configured token no request is
+// authorized.
+func (app *application) authorizeStream(r *http.Request) bool {
+	if app.streamToken == "" {
+		return false
+	}
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		token, found = websocket.StreamToken(r)
+	}
+	return found && subtle.ConstantTimeCompare([]byte(token), []byte(app.streamToken)) == 1
+}
+
+// redactedURI returns the request URI with the value of any token query
+// parameter replaced, so credentials are not written to the logs
+func redactedURI(u *url.URL) string {
+	query := u.Query()
+	if !query.Has("token") {
+		return u.RequestURI()
+	}
+	query.Set("token", "REDACTED")
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	return redacted.RequestURI()
 }
 
+// expiresAt formats when a finished job expires; live jobs do not expire
+func expiresAt(buildJob *job.BuildJob) string {
+	if buildJob.ExpiresAt.IsZero() {
+		return ""
+	}
+	return buildJob.ExpiresAt.Format(time.RFC3339)
+}
+
+// parseSince parses the sequence number of the last event a client received
+func parseSince(value string) (uint64, error) {
+	since, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, &requestError{http.StatusBadRequest, fmt.Sprintf("invalid event ID %q", value)}
+	}
+	return since, nil
+}
+
+// parseLogQuery reads which lines of a job's log a request asks for: those
+// after the Last-Event-ID header or the after parameter, at the level
+// parameter or above, and up to limit lines
+func parseLogQuery(r *http.Request) (job.LogQuery, error) {
+	var query job.LogQuery
+
+	after := r.Header.Get("Last-Event-ID")
+	if after == "" {
+		after = r.URL.Query().Get("after")
+	}
+	if after != "" {
+		var err error
+		if query.After, err = parseSince(after); err != nil {
+			return query, err
+		}
+	}
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > job.MaxLogLimit {
+			return query, &requestError{http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", job.MaxLogLimit)}
+		}
+		query.Limit = limit
+	}
+
+	level, err := job.ParseLogLevel(r.URL.Query().Get("level"))
+	if err != nil {
+		return query, &requestError{http.StatusBadRequest, err.Error()}
+	}
+	query.Level = level
+	return query, nil
+}
+
+// startEventStream sends the headers of a text/event-stream response. The
+// stream may outlast the server's write timeout.
+func startEventStream(w http.ResponseWriter) (*http.ResponseController, error) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	return rc, nil
+}
+
+// writeLogEvent writes a line of a job's log in the text/event-stream format
+func writeLogEvent(w io.Writer, entry job.LogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", entry.Seq, data)
+	return err
+}
+
+// writeEvent writes a job event in the text/event-stream format
+func writeEvent(w io.Writer, event job.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if event.Seq > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.Seq); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data)
+	return err
+}
+
+// readJSON decodes a single JSON value from the request body into dst
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(dst); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		var maxBytesErr *http.MaxBytesError
+
+		switch {
+		case errors.Is(err, io.EOF):
+			return errEmptyBody
+		case errors.As(err, &syntaxErr):
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("body contains malformed JSON (at character %d)", syntaxErr.Offset)}
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return &requestError{http.StatusBadRequest, "body contains malformed JSON"}
+		case errors.As(err, &typeErr):
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("body contains an invalid value for field %q", typeErr.Field)}
+		case errors.As(err, &maxBytesErr):
+			return &requestError{http.StatusRequestEntityTooLarge, fmt.Sprintf("body must not be larger than %d bytes", maxBytesErr.Limit)}
+		case errors.Is(err, models.ErrUnknownComponentType):
+			return &requestError{http.StatusUnprocessableEntity, err.Error()}
+		default:
+			return err
+		}
+	}
+
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return &requestError{http.StatusBadRequest, "body must only contain a single JSON value"}
+	}
+
+	return nil
+}
+
+// applyMergePatch applies a JSON merge patch (RFC 7396) to a project
+func applyMergePatch(project models.Project, patch any) (models.Project, error) {
+	data, err := json.Marshal(project)
+	if err != nil {
+		return project, err
+	}
+
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return project, err
+	}
+
+	merged, err := json.Marshal(mergePatch(doc, patch))
+	if err != nil {
+		return project, err
+	}
+
+	var patched models.Project
+	if err := json.Unmarshal(merged, &patched); err != nil {
+		if errors.Is(err, models.ErrUnknownComponentType) {
+			return project, &requestError{http.StatusUnprocessableEntity, err.Error()}
+		}
+		return project, &requestError{http.StatusBadRequest, fmt.Sprintf("patch produces an invalid project: %v", err)}
+	}
+
+	return patched, nil
+}
+
+// mergePatch recursively merges patch into target; null values remove keys
+// and non-object patches replace the target outright
+func mergePatch(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = make(map[string]any)
+	}
+
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = mergePatch(targetObj[key], value)
+	}
+
+	return targetObj
+}
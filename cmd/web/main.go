@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,6 +12,7 @@ import (
 
 	"sawthet.go-press-server.net/internal/services"
 	"sawthet.go-press-server.net/internal/services/job"
+	"sawthet.go-press-server.net/internal/services/store"
 	"sawthet.go-press-server.net/internal/services/websocket"
 	"sawthet.go-press-server.net/internal/utils"
 )
@@ -21,31 +24,105 @@ type application struct {
 	socketManager   *websocket.SocketManager
 	templateService *services.TemplateService
 	cssCompiler     *services.CSSCompiler
+	projects        store.ProjectStore
+	// closing is closed when the server starts shutting down, ending
+	// long-lived event streams
+	closing chan struct{}
+	// streamToken is required to open the multiplexed event stream, which is
+	// disabled without one
+	streamToken string
 }
 
 func main() {
+	storeType := flag.String("store", "file", "Project store backend (file or bolt)")
+	storePath := flag.String("store-path", "", "Project directory (file) or database file (bolt)")
+	jobStoreType := flag.String("job-store", "file", "Job store backend (file, bolt or memory)")
+	jobStorePath := flag.String("job-store-path", "", "Job directory (file) or database file (bolt)")
+	workers := flag.Int("workers", job.DefaultWorkers, "Number of builds run concurrently")
+	backlog := flag.Int("backlog", job.DefaultBacklog, "Maximum number of pending builds before submissions are refused")
+	attempts := flag.Int("build-attempts", job.DefaultRetryPolicy.MaxAttempts, "Maximum attempts for builds failing with transient errors")
+	renderWorkers := flag.Int("render-workers", 0, "Number of pages rendered concurrently within a build (0 uses one per CPU)")
+	cssBackend := flag.String("css-backend", services.CSSBackendTailwind, "CSS backend: tailwind (node) or go (no node required)")
+	cssDaemons := flag.Int("css-daemons", 2, "Number of long-running tailwind processes (0 runs tailwind once per build)")
+	streamToken := flag.String("stream-token", os.Getenv("STREAM_TOKEN"), "Token clients must present to open the multiplexed event stream (empty disables the stream)")
+	cacheDir := flag.String("build-cache", "data/cache", "Directory caching build output for incremental builds (empty disables)")
+	flag.Parse()
+
 	// Initialize loggers
 	infoLog := utils.NewColoredLogger("INFO", "\033[32m")   // Green color for info
 	errorLog := utils.NewColoredLogger("ERROR", "\033[31m") // Red color for error
 
-	// Initialize job queue with 2 workers
-	jobQueue := job.NewJobQueue(2, infoLog, errorLog)
+	// Initialize project store
+	projects, err := openProjectStore(*storeType, *storePath)
+	if err != nil {
+		errorLog.Printf("Failed to open project store: %v", err)
+		os.Exit(1)
+	}
+	defer projects.Close()
 
-	// Initialize WebSocket manager
-	socketManager := websocket.NewSocketManager(jobQueue)
+	// Initialize job store
+	jobStore, err := openJobStore(*jobStoreType, *jobStorePath)
+	if err != nil {
+		errorLog.Printf("Failed to open job store: %v", err)
+		os.Exit(1)
+	}
+	if jobStore != nil {
+		defer jobStore.Close()
+	}
 
-	// Initialize services
+	// Initialize services shared by all builds
 	templateService, err := services.NewTemplateService()
 	if err != nil {
 		errorLog.Printf("Failed to initialize template service: %v", err)
 		os.Exit(1)
 	}
 
-	cssCompiler, err := services.NewCSSCompiler()
+	cssCompiler, err := services.NewCSSCompiler(services.CSSCompilerConfig{
+		Backend:  *cssBackend,
+		Daemons:  *cssDaemons,
+		ErrorLog: errorLog,
+	})
 	if err != nil {
 		errorLog.Printf("Failed to initialize CSS compiler: %v", err)
 		os.Exit(1)
 	}
+	defer cssCompiler.Cleanup()
+	infoLog.Printf("Compiling CSS with the %s backend", cssCompiler.Backend())
+
+	if *streamToken == "" {
+		errorLog.Printf("No stream token is configured: /ws/stream refuses every connection; set -stream-token or STREAM_TOKEN to enable it")
+	}
+
+	// Initialize build cache
+	var buildCache *job.BuildCache
+	if *cacheDir != "" {
+		buildCache, err = job.NewBuildCache(*cacheDir)
+		if err != nil {
+			errorLog.Printf("Failed to open build cache: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	// Initialize job queue
+	jobQueue := job.NewJobQueue(job.Config{
+		Workers: *workers,
+		Backlog: *backlog,
+		Store:   jobStore,
+		Cache:   buildCache,
+		Stages: []job.Stage{
+			job.RenderStage{Templates: templateService, Workers: *renderWorkers},
+			job.CSSStage{Compiler: cssCompiler},
+			job.PackageStage{},
+		},
+		Retry: job.RetryPolicy{
+			MaxAttempts:    *attempts,
+			InitialBackoff: job.DefaultRetryPolicy.InitialBackoff,
+			MaxBackoff:     job.DefaultRetryPolicy.MaxBackoff,
+		},
+	}, infoLog, errorLog)
+
+	// Initialize WebSocket manager
+	socketManager := websocket.NewSocketManager(jobQueue)
 
 	// Initialize application
 	app := &application{
@@ -55,6 +132,9 @@ func main() {
 		socketManager:   socketManager,
 		templateService: templateService,
 		cssCompiler:     cssCompiler,
+		projects:        projects,
+		closing:         make(chan struct{}),
+		streamToken:     *streamToken,
 	}
 
 	// Create server
@@ -65,6 +145,7 @@ func main() {
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
+	server.RegisterOnShutdown(func() { close(app.closing) })
 
 	// Channel to receive OS signals
 	done := make(chan os.Signal, 1)
@@ -83,8 +164,11 @@ func main() {
 	<-done
 	infoLog.Println("Server is gracefully shutting down...")
 
-	// Cleanup all jobs
-	jobQueue.CleanupAllJobs()
+	// Stop the job queue
+	jobQueue.Shutdown()
+
+	// Hijacked WebSocket connections are not closed by server.Shutdown
+	socketManager.Cleanup()
 
 	// Create shutdown context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -97,3 +181,42 @@ func main() {
 
 	infoLog.Println("Server exited properly")
 }
+
+// openProjectStore creates the project store for the selected backend
+func openProjectStore(storeType, path string) (store.ProjectStore, error) {
+	switch storeType {
+	case "file":
+		if path == "" {
+			path = "data/projects"
+		}
+		return store.NewFileStore(path)
+	case "bolt":
+		if path == "" {
+			path = "data/projects.db"
+		}
+		return store.NewBoltStore(path)
+	default:
+		return nil, fmt.Errorf("unknown store type %q", storeType)
+	}
+}
+
+// openJobStore creates the job store for the selected backend; the memory
+// backend returns a nil store so jobs are not persisted
+func openJobStore(storeType, path string) (job.JobStore, error) {
+	switch storeType {
+	case "file":
+		if path == "" {
+			path = "data/jobs"
+		}
+		return job.NewFileJobStore(path)
+	case "bolt":
+		if path == "" {
+			path = "data/jobs.db"
+		}
+		return job.NewBoltJobStore(path)
+	case "memory":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown job store type %q", storeType)
+	}
+}
@@ -11,9 +11,11 @@ func cors(next http.Handler) http.Handler {
 		// Allow all origins
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		// Allow specific methods
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		// Allow specific headers
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Last-Event-ID, X-Revision-Author, X-Revision-Message")
+		// Expose revision metadata to browser clients
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Retry-After, X-Project-Revision")
 
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
@@ -27,7 +29,7 @@ func cors(next http.Handler) http.Handler {
 
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI())
+		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, redactedURI(r.URL))
 		next.ServeHTTP(w, r)
 	})
 }
@@ -24,13 +24,45 @@ func (app *application) routes() http.Handler {
 	// Home page endpoint
 	router.HandlerFunc(http.MethodGet, "/", app.home)
 
+	// Project endpoints
+	router.HandlerFunc(http.MethodGet, "/projects", app.listProjects)
+	router.HandlerFunc(http.MethodPost, "/projects", app.createProject)
+	router.HandlerFunc(http.MethodGet, "/projects/:id", app.getProject)
+	router.HandlerFunc(http.MethodPut, "/projects/:id", app.updateProject)
+	router.HandlerFunc(http.MethodPatch, "/projects/:id", app.patchProject)
+	router.HandlerFunc(http.MethodDelete, "/projects/:id", app.deleteProject)
+
+	// httprouter cannot register the static /projects/validate next to the
+	// /projects/:id wildcard, so it is dispatched by the ID parameter; other
+	// projects answer like any route without a POST handler
+	router.HandlerFunc(http.MethodPost, "/projects/:id", func(w http.ResponseWriter, r *http.Request) {
+		if httprouter.ParamsFromContext(r.Context()).ByName("id") != "validate" {
+			w.Header().Set("Allow", "GET, PUT, PATCH, DELETE")
+			app.errorResponse(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+			return
+		}
+		app.validateProject(w, r)
+	})
+
+	// Project revision endpoints
+	router.HandlerFunc(http.MethodGet, "/projects/:id/revisions", app.listProjectRevisions)
+	router.HandlerFunc(http.MethodGet, "/projects/:id/revisions/:revision", app.getProjectRevision)
+	router.HandlerFunc(http.MethodGet, "/projects/:id/revisions/:revision/diff", app.diffProjectRevisions)
+	router.HandlerFunc(http.MethodPost, "/projects/:id/revisions/:revision/restore", app.restoreProjectRevision)
+
 	// Job endpoints
 	router.HandlerFunc(http.MethodPost, "/projects/:id/build", app.submitBuildJob)
+	router.HandlerFunc(http.MethodGet, "/projects/:id/builds", app.listProjectBuilds)
 	router.HandlerFunc(http.MethodGet, "/jobs/:id/download", app.downloadJobResult)
 	router.HandlerFunc(http.MethodGet, "/jobs/:id/check", app.checkJobAvailability)
+	router.HandlerFunc(http.MethodGet, "/jobs/:id/events", app.streamJobEvents)
+	router.HandlerFunc(http.MethodGet, "/jobs/:id/logs", app.getJobLogs)
+	router.HandlerFunc(http.MethodPost, "/jobs/:id/cancel", app.cancelJob)
+	router.HandlerFunc(http.MethodDelete, "/jobs/:id", app.cancelJob)
 
-	// WebSocket endpoint
+	// WebSocket endpoints
 	router.HandlerFunc(http.MethodGet, "/ws", app.handleWebSocket)
+	router.HandlerFunc(http.MethodGet, "/ws/stream", app.handleEventStream)
 
 	standard := alice.New(cors, app.recoverPanic, app.logRequest, app.secureHeaders)
 
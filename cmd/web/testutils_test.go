@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sawthet.go-press-server.net/internal/services/job"
+	"sawthet.go-press-server.net/internal/services/store"
+	"sawthet.go-press-server.net/internal/services/websocket"
+	"sawthet.go-press-server.net/internal/utils"
+)
+
+// newTestApplication returns an application storing projects in a temporary
+// directory, with a job queue built from config; nil stages run no stages
+func newTestApplication(t *testing.T, config job.Config) *application {
+	t.Helper()
+	projects, err := store.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Stages == nil {
+		config.Stages = []job.Stage{}
+	}
+
+	logger := utils.NewColoredLogger("TEST", "")
+	jobQueue := job.NewJobQueue(config, logger, logger)
+	app := &application{
+		infoLog:       logger,
+		errorLog:      logger,
+		jobQueue:      jobQueue,
+		socketManager: websocket.NewSocketManager(jobQueue),
+		projects:      projects,
+		closing:       make(chan struct{}),
+	}
+	t.Cleanup(func() {
+		close(app.closing)
+		jobQueue.Shutdown()
+	})
+	return app
+}
+
+// send serves a request with the given body through the application's
+// routes and returns the recorded response
+func send(t *testing.T, app *application, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, r)
+	return w
+}
+
+// decode decodes a JSON response body into dst
+func decode(t *testing.T, w *httptest.ResponseRecorder, dst any) {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json; body %q", ct, w.Body.String())
+	}
+	if err := json.NewDecoder(w.Body).Decode(dst); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// errorBody is the payload of errorResponse
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// gateStage blocks every build until release is closed
+type gateStage struct {
+	release chan struct{}
+}
+
+func (s gateStage) Name() string { return "gate" }
+func (s gateStage) Weight() int  { return 1 }
+
+func (s gateStage) Run(ctx context.Context, build *job.Build, progress job.ProgressFunc) error {
+	select {
+	case <-s.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitForStatus waits until a job reaches the given status
+func waitForStatus(t *testing.T, app *application, jobID string, status job.JobStatus) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		build, err := app.jobQueue.GetJobStatus(jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if build.Status == status {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is %s, want %s", jobID, build.Status, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -6,4 +6,7 @@ require (
 	github.com/gorilla/websocket v1.5.3
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/justinas/alice v1.2.0
+	go.etcd.io/bbolt v1.3.10
 )
+
+require golang.org/x/sys v0.4.0 // indirect
@@ -2,10 +2,15 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
+// ErrUnknownComponentType is returned when a component's type is not recognised
+var ErrUnknownComponentType = errors.New("unknown component type")
+
 // Project represents the entire project structure
 type Project struct {
 	ID           string           `json:"id"`
@@ -15,6 +20,7 @@ type Project struct {
 	Pages        []Page           `json:"pages"`
 	Header       ComponentWrapper `json:"header"`
 	Footer       ComponentWrapper `json:"footer"`
+	Build        *BuildConfig     `json:"build,omitempty"`
 }
 
 // Page represents a page in the CMS
@@ -27,6 +33,15 @@ type Page struct {
 	UpdatedAt  time.Time          `json:"updated_at"`
 }
 
+// Filename returns the path of the generated HTML file for the page
+func (p Page) Filename() string {
+	filename := strings.TrimPrefix(p.Slug, "/")
+	if filename == "" {
+		return "index.html"
+	}
+	return filename + ".html"
+}
+
 // Base Component Interface
 type BaseComponent struct {
 	Type       string             `json:"type"`
@@ -148,8 +163,18 @@ type ComponentWrapper struct {
 	Component
 }
 
+// MarshalJSON implements json.Marshaler for ComponentWrapper
+func (cw ComponentWrapper) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cw.Component)
+}
+
 // UnmarshalJSON implements json.Unmarshaler for ComponentWrapper
 func (cw *ComponentWrapper) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		cw.Component = nil
+		return nil
+	}
+
 	var base BaseComponent
 	if err := json.Unmarshal(data, &base); err != nil {
 		return err
@@ -217,7 +242,7 @@ func (cw *ComponentWrapper) UnmarshalJSON(data []byte) error {
 		}
 		cw.Component = &button
 	default:
-		return fmt.Errorf("unknown component type: %s", base.Type)
+		return fmt.Errorf("%w: %q", ErrUnknownComponentType, base.Type)
 	}
 
 	return nil
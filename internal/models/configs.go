@@ -5,11 +5,54 @@ type GlobalConfig struct {
 	Theme Theme `json:"theme"`
 }
 
+// BuildConfig customises the build pipeline of a project
+type BuildConfig struct {
+	// Stages lists the stages to run, in order; empty runs the default pipeline
+	Stages []string `json:"stages,omitempty"`
+	// Skip lists stages that should not run
+	Skip []string `json:"skip,omitempty"`
+	// InlineCSS embeds the stylesheet in every page instead of linking it
+	InlineCSS bool `json:"inlineCss,omitempty"`
+	// CriticalCSS embeds the CSS used above the fold of each page and loads
+	// the stylesheet without blocking rendering
+	CriticalCSS bool `json:"criticalCss,omitempty"`
+}
+
 // Theme represents the design system
 type Theme struct {
 	Colors     Colors     `json:"colors"`
 	Typography Typography `json:"typography"`
 	Spacing    Spacing    `json:"spacing"`
+	// Palettes adds named color scales, such as "brand": {"50": ..., "500": ...};
+	// the DEFAULT shade is used by classes without a shade, such as bg-brand
+	Palettes map[string]ColorScale `json:"palettes,omitempty"`
+	// Radii, Shadows and Breakpoints add or replace border radii, box
+	// shadows and responsive breakpoints by name; DEFAULT names the radius
+	// of "rounded" and the shadow of "shadow"
+	Radii       map[string]string `json:"radii,omitempty"`
+	Shadows     map[string]string `json:"shadows,omitempty"`
+	Breakpoints map[string]string `json:"breakpoints,omitempty"`
+	// Dark holds the tokens that change in dark mode
+	Dark *DarkTheme `json:"dark,omitempty"`
+}
+
+// ColorScale maps shade names to colors
+type ColorScale map[string]string
+
+// Dark mode strategies
+const (
+	// DarkModeMedia follows the visitor's system preference
+	DarkModeMedia = "media"
+	// DarkModeClass applies dark mode under an element with the "dark" class
+	DarkModeClass = "class"
+)
+
+// DarkTheme overrides theme colors in dark mode
+type DarkTheme struct {
+	// Mode is DarkModeMedia (the default) or DarkModeClass
+	Mode     string                `json:"mode,omitempty"`
+	Colors   Colors                `json:"colors"`
+	Palettes map[string]ColorScale `json:"palettes,omitempty"`
 }
 
 // Colors represents the color palette
@@ -24,6 +67,11 @@ type Colors struct {
 type Typography struct {
 	FontFamily string    `json:"fontFamily"`
 	FontSizes  FontSizes `json:"fontSizes"`
+	// FontFamilies adds font stacks by name, such as "display" for
+	// font-display; "sans" replaces FontFamily
+	FontFamilies map[string][]string `json:"fontFamilies,omitempty"`
+	// LineHeights adds or replaces line heights by name, such as "tight"
+	LineHeights map[string]string `json:"lineHeights,omitempty"`
 }
 
 // FontSizes represents the typography scale
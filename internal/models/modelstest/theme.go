@@ -0,0 +1,29 @@
+// Package modelstest provides models shared by the tests of other packages
+package modelstest
+
+import "sawthet.go-press-server.net/internal/models"
+
+// HostileTheme sets every theme value and token name to value, including the
+// dark mode; tests that need dark properties written set a valid mode
+func HostileTheme(value string) models.Theme {
+	tokens := map[string]string{"ok": value, value: "1px"}
+	return models.Theme{
+		Colors: models.Colors{Primary: value, Secondary: value, Background: value, Text: value},
+		Typography: models.Typography{
+			FontFamily:   value,
+			FontSizes:    models.FontSizes{Small: value, Base: value, Large: value, XLarge: value, XXLarge: value},
+			FontFamilies: map[string][]string{"ok": {value}, value: {"Inter"}},
+			LineHeights:  tokens,
+		},
+		Spacing:     models.Spacing{Small: value, Medium: value, Large: value, XLarge: value},
+		Palettes:    map[string]models.ColorScale{"ok": {"500": value, value: "#fff"}, value: {"500": "#fff"}},
+		Radii:       tokens,
+		Shadows:     tokens,
+		Breakpoints: tokens,
+		Dark: &models.DarkTheme{
+			Mode:     value,
+			Colors:   models.Colors{Primary: value, Text: value},
+			Palettes: map[string]models.ColorScale{"ok": {"500": value}},
+		},
+	}
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultToken is the token name used by utilities without a suffix, such as
+// "rounded" or "bg-brand"
+const DefaultToken = "DEFAULT"
+
+var tokenNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// IsTokenName reports whether a token name can be used in class names and
+// custom property names
+func IsTokenName(name string) bool {
+	return tokenNamePattern.MatchString(name)
+}
+
+// Property is a CSS custom property declaring a theme token
+type Property struct {
+	Name  string
+	Value string
+}
+
+// ColorProperty returns the custom property of a palette shade
+func ColorProperty(palette, shade string) string {
+	if shade == DefaultToken || shade == "" {
+		return "--color-" + palette
+	}
+	return "--color-" + palette + "-" + shade
+}
+
+// tokenProperty returns the custom property of a named token, such as
+// --radius-lg, or --radius for the DEFAULT token
+func tokenProperty(prefix, name string) string {
+	if name == DefaultToken {
+		return "--" + prefix
+	}
+	return "--" + prefix + "-" + name
+}
+
+// FontStack joins font family names into a font-family value, quoting names
+// that contain spaces. Names are expected to be validated font names, which
+// never contain quotes.
+func FontStack(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if strings.Contains(name, " ") {
+			name = `"` + name + `"`
+		}
+		quoted = append(quoted, name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// DarkMode returns the dark mode strategy, or "" when the theme has no dark mode
+func (t Theme) DarkMode() string {
+	if t.Dark == nil {
+		return ""
+	}
+	if t.Dark.Mode == "" {
+		return DarkModeMedia
+	}
+	return t.Dark.Mode
+}
+
+// FontFamilyStacks returns the font-family value of every named font stack,
+// including "sans" from FontFamily
+func (t Theme) FontFamilyStacks() map[string]string {
+	stacks := make(map[string]string)
+	if t.Typography.FontFamily != "" {
+		stacks["sans"] = t.Typography.FontFamily
+	}
+	for name, families := range t.Typography.FontFamilies {
+		if len(families) > 0 {
+			stacks[name] = FontStack(families)
+		}
+	}
+	return stacks
+}
+
+// Properties returns the custom properties declaring every token of the
+// theme, in a stable order. Tokens with invalid names or empty values are left out.
+func (t Theme) Properties() []Property {
+	var props []Property
+	props = append(props, colorProperties(t.Colors, t.Palettes)...)
+	props = append(props, tokenProperties("font", t.FontFamilyStacks())...)
+	props = append(props, tokenProperties("leading", t.Typography.LineHeights)...)
+	props = append(props, tokenProperties("radius", t.Radii)...)
+	props = append(props, tokenProperties("shadow", t.Shadows)...)
+	props = append(props, tokenProperties("breakpoint", t.Breakpoints)...)
+	return props
+}
+
+// DarkProperties returns the custom properties overridden in dark mode
+func (t Theme) DarkProperties() []Property {
+	if t.Dark == nil {
+		return nil
+	}
+	return colorProperties(t.Dark.Colors, t.Dark.Palettes)
+}
+
+func colorProperties(colors Colors, palettes map[string]ColorScale) []Property {
+	var props []Property
+	for _, color := range []Property{
+		{"primary", colors.Primary},
+		{"secondary", colors.Secondary},
+		{"background", colors.Background},
+		{"text", colors.Text},
+	} {
+		if color.Value != "" {
+			props = append(props, Property{ColorProperty(color.Name, ""), color.Value})
+		}
+	}
+
+	for _, name := range sortedTokens(palettes) {
+		scale := palettes[name]
+		for _, shade := range sortedTokens(scale) {
+			if scale[shade] != "" {
+				props = append(props, Property{ColorProperty(name, shade), scale[shade]})
+			}
+		}
+	}
+	return props
+}
+
+func tokenProperties(prefix string, tokens map[string]string) []Property {
+	var props []Property
+	for _, name := range sortedTokens(tokens) {
+		if tokens[name] != "" {
+			props = append(props, Property{tokenProperty(prefix, name), tokens[name]})
+		}
+	}
+	return props
+}
+
+// sortedTokens returns the valid token names of a map, sorted
+func sortedTokens[V any](tokens map[string]V) []string {
+	names := make([]string, 0, len(tokens))
+	for name := range tokens {
+		if IsTokenName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
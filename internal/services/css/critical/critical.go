@@ -0,0 +1,325 @@
+// Package critical extracts the rules of a compiled stylesheet that a page
+// needs for its first paint. It parses the flat, utility-style CSS produced by
+// Tailwind and gocss, keeping rules without class selectors (the base styles)
+// and rules whose classes are all used by the page.
+package critical
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Stylesheet is a parsed stylesheet that critical CSS can be extracted from
+// repeatedly
+type Stylesheet struct {
+	nodes []node
+}
+
+// node is a style rule, a grouping at-rule such as @media holding further
+// nodes, or any other statement, which is always kept
+type node struct {
+	// selectors and body are set for style rules
+	selectors []selector
+	body      string
+	// prelude and children are set for grouping at-rules
+	prelude  string
+	children []node
+	// raw is set for statements kept verbatim, such as @font-face
+	raw string
+}
+
+type selector struct {
+	text    string
+	classes []string
+}
+
+// groupingRules are the at-rules whose blocks hold style rules
+var groupingRules = map[string]bool{
+	"@media":     true,
+	"@supports":  true,
+	"@layer":     true,
+	"@container": true,
+}
+
+// Parse parses a stylesheet. Malformed input is parsed as far as possible.
+func Parse(css []byte) *Stylesheet {
+	p := &parser{src: string(css)}
+	var nodes []node
+	for p.pos < len(p.src) {
+		// A stray closing brace at the top level ends nodes early; it is
+		// skipped and parsing carries on with the rules after it
+		nodes = append(nodes, p.nodes()...)
+	}
+	return &Stylesheet{nodes: nodes}
+}
+
+// Extract returns the rules needed by an element tree using the given
+// classes, minified
+func (s *Stylesheet) Extract(classes map[string]bool) []byte {
+	var b strings.Builder
+	writeNodes(&b, s.nodes, classes)
+	return []byte(b.String())
+}
+
+func writeNodes(b *strings.Builder, nodes []node, classes map[string]bool) {
+	for _, n := range nodes {
+		switch {
+		case n.raw != "":
+			b.WriteString(n.raw)
+		case n.children != nil || n.prelude != "":
+			var inner strings.Builder
+			writeNodes(&inner, n.children, classes)
+			if inner.Len() > 0 {
+				b.WriteString(n.prelude + "{" + inner.String() + "}")
+			}
+		default:
+			var kept []string
+			for _, sel := range n.selectors {
+				if uses(classes, sel.classes) {
+					kept = append(kept, sel.text)
+				}
+			}
+			if len(kept) > 0 {
+				b.WriteString(strings.Join(kept, ",") + "{" + n.body + "}")
+			}
+		}
+	}
+}
+
+// uses reports whether every class of a selector is used
+func uses(classes map[string]bool, needed []string) bool {
+	for _, class := range needed {
+		if !classes[class] {
+			return false
+		}
+	}
+	return true
+}
+
+type parser struct {
+	src string
+	pos int
+}
+
+// nodes parses rules until the end of input or the brace closing a block
+func (p *parser) nodes() []node {
+	var nodes []node
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return nodes
+		}
+		if p.src[p.pos] == '}' {
+			p.pos++
+			return nodes
+		}
+
+		start := p.pos
+		prelude, terminator := p.until("{;")
+		prelude = strings.TrimSpace(prelude)
+
+		if terminator == ';' || terminator == 0 {
+			// Statements such as @import or @charset
+			if strings.HasPrefix(prelude, "@") {
+				nodes = append(nodes, node{raw: strings.TrimSpace(p.src[start:p.pos])})
+			}
+			continue
+		}
+
+		if strings.HasPrefix(prelude, "@") {
+			name, _, _ := strings.Cut(prelude, " ")
+			if groupingRules[strings.ToLower(name)] {
+				nodes = append(nodes, node{prelude: prelude, children: p.nodes()})
+				continue
+			}
+			p.skipBlock()
+			nodes = append(nodes, node{raw: strings.TrimSpace(p.src[start:p.pos])})
+			continue
+		}
+
+		bodyStart := p.pos
+		p.skipBlock()
+		bodyEnd := p.pos
+		if bodyEnd > bodyStart && p.src[bodyEnd-1] == '}' {
+			bodyEnd--
+		}
+		body := strings.TrimSpace(p.src[bodyStart:bodyEnd])
+
+		var selectors []selector
+		for _, text := range splitSelectors(prelude) {
+			selectors = append(selectors, selector{text: text, classes: selectorClasses(text)})
+		}
+		nodes = append(nodes, node{selectors: selectors, body: body})
+	}
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			end := strings.Index(p.src[p.pos+2:], "*/")
+			if end < 0 {
+				p.pos = len(p.src)
+				return
+			}
+			p.pos += end + 4
+		case strings.ContainsRune(" \t\r\n\f", rune(p.src[p.pos])):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// until consumes input up to and including the first of stops outside
+// strings, comments and escapes, returning the text before it and the stop
+// character, or 0 at the end of input
+func (p *parser) until(stops string) (string, byte) {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\\':
+			p.pos += 2
+			continue
+		case c == '"' || c == '\'':
+			p.skipString(c)
+			continue
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			end := strings.Index(p.src[p.pos+2:], "*/")
+			if end < 0 {
+				p.pos = len(p.src)
+				continue
+			}
+			p.pos += end + 4
+			continue
+		case strings.IndexByte(stops, c) >= 0:
+			p.pos++
+			return p.src[start : p.pos-1], c
+		}
+		p.pos++
+	}
+	p.pos = len(p.src)
+	return p.src[start:], 0
+}
+
+func (p *parser) skipString(quote byte) {
+	p.pos++
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos += 2
+			continue
+		case quote:
+			p.pos++
+			return
+		}
+		p.pos++
+	}
+	p.pos = len(p.src)
+}
+
+// skipBlock consumes a block up to and including its closing brace, the
+// opening brace having been consumed already
+func (p *parser) skipBlock() {
+	depth := 1
+	for depth > 0 {
+		_, c := p.until("{}")
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		default:
+			return
+		}
+	}
+}
+
+// splitSelectors splits a selector list on its top-level commas
+func splitSelectors(list string) []string {
+	var selectors []string
+	depth, start := 0, 0
+	for i := 0; i < len(list); i++ {
+		switch list[i] {
+		case '\\':
+			i++
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				selectors = append(selectors, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(selectors, strings.TrimSpace(list[start:]))
+}
+
+// selectorClasses returns the unescaped class names in a selector, ignoring
+// attribute selectors
+func selectorClasses(sel string) []string {
+	var classes []string
+	for i := 0; i < len(sel); i++ {
+		switch sel[i] {
+		case '\\':
+			i++
+		case '[':
+			for i < len(sel) && sel[i] != ']' {
+				i++
+			}
+		case '.':
+			name, n := readIdent(sel[i+1:])
+			if name != "" {
+				classes = append(classes, name)
+			}
+			i += n
+		}
+	}
+	return classes
+}
+
+// readIdent reads an identifier with CSS escapes, returning its unescaped
+// value and the number of bytes consumed
+func readIdent(s string) (string, int) {
+	var b strings.Builder
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			// A hex escape has up to six digits and may end with one space
+			j := i + 1
+			for j < len(s) && j < i+7 && isHex(s[j]) {
+				j++
+			}
+			if j == i+1 {
+				b.WriteByte(s[i+1])
+				i += 2
+				continue
+			}
+			code, _ := strconv.ParseUint(s[i+1:j], 16, 32)
+			b.WriteRune(rune(code))
+			if j < len(s) && s[j] == ' ' {
+				j++
+			}
+			i = j
+		case c == '-' || c == '_' || c >= 0x80 || isAlnum(c):
+			b.WriteByte(c)
+			i++
+		default:
+			return b.String(), i
+		}
+	}
+	return b.String(), i
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
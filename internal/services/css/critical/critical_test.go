@@ -0,0 +1,197 @@
+package critical
+
+import (
+	"reflect"
+	"testing"
+)
+
+// used returns a set of class names
+func used(classes ...string) map[string]bool {
+	set := make(map[string]bool, len(classes))
+	for _, class := range classes {
+		set[class] = true
+	}
+	return set
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		css     string
+		classes map[string]bool
+		want    string
+	}{
+		{
+			name:    "base styles are kept",
+			css:     `*,::before{box-sizing:border-box} html { line-height: 1.5 } body{margin:0}`,
+			classes: used(),
+			want:    `*,::before{box-sizing:border-box}html{line-height: 1.5}body{margin:0}`,
+		},
+		{
+			name:    "rules of unused classes are dropped",
+			css:     `.p-4{padding:1rem}.mt-2{margin-top:.5rem}.hidden{display:none}`,
+			classes: used("p-4", "hidden"),
+			want:    `.p-4{padding:1rem}.hidden{display:none}`,
+		},
+		{
+			name:    "selectors of a list are kept separately",
+			css:     `.a,.b,p{color:red}`,
+			classes: used("b"),
+			want:    `.b,p{color:red}`,
+		},
+		{
+			name:    "every class of a selector must be used",
+			css:     `.dark .dark\:bg-black{background:#000}.group:hover .x{color:red}`,
+			classes: used("dark:bg-black", "x"),
+			want:    ``,
+		},
+		{
+			name:    "compound and descendant selectors",
+			css:     `.dark .dark\:bg-black{background:#000}.space-x-4 > :not([hidden]) ~ :not([hidden]){margin-left:1rem}`,
+			classes: used("dark", "dark:bg-black", "space-x-4"),
+			want:    `.dark .dark\:bg-black{background:#000}.space-x-4 > :not([hidden]) ~ :not([hidden]){margin-left:1rem}`,
+		},
+		{
+			name:    "escaped class names",
+			css:     `.md\:p-4{padding:1rem}.w-1\/2{width:50%}.px-0\.5{padding:1px}.\32 xl\:mt-2{margin:0}.\!p-1{padding:0}`,
+			classes: used("md:p-4", "w-1/2", "px-0.5", "2xl:mt-2", "!p-1"),
+			want:    `.md\:p-4{padding:1rem}.w-1\/2{width:50%}.px-0\.5{padding:1px}.\32 xl\:mt-2{margin:0}.\!p-1{padding:0}`,
+		},
+		{
+			name:    "dots and commas in attribute selectors and functions",
+			css:     `[class~="a.b"]{color:red}:is(.a,.b) .c{color:blue}a[href$=".pdf"]{color:green}`,
+			classes: used("c"),
+			want:    `[class~="a.b"]{color:red}a[href$=".pdf"]{color:green}`,
+		},
+		{
+			name:    "pseudo-classes and elements",
+			css:     `.hover\:p-1:hover{padding:0}.prose :where(p){margin:0}.x::before{content:"."}`,
+			classes: used("hover:p-1", "prose"),
+			want:    `.hover\:p-1:hover{padding:0}.prose :where(p){margin:0}`,
+		},
+		{
+			name:    "media queries keep their used rules",
+			css:     `@media (min-width:768px){.md\:p-4{padding:1rem}.md\:mt-2{margin-top:.5rem}}`,
+			classes: used("md:p-4"),
+			want:    `@media (min-width:768px){.md\:p-4{padding:1rem}}`,
+		},
+		{
+			name:    "empty media queries are dropped",
+			css:     `@media (min-width:768px){.md\:p-4{padding:1rem}}.p-1{padding:0}`,
+			classes: used("p-1"),
+			want:    `.p-1{padding:0}`,
+		},
+		{
+			name:    "nested grouping rules",
+			css:     `@supports (display:grid){@media (min-width:640px){.grid{display:grid}.flex{display:flex}}}@layer base{html{color:red}}`,
+			classes: used("grid"),
+			want:    `@supports (display:grid){@media (min-width:640px){.grid{display:grid}}}@layer base{html{color:red}}`,
+		},
+		{
+			name:    "other at-rules are kept verbatim",
+			css:     `@charset "utf-8";@import url("a.css");@font-face{font-family:X;src:url(x.woff2)}@keyframes spin{to{transform:rotate(360deg)}}.x{color:red}`,
+			classes: used(),
+			want:    `@charset "utf-8";@import url("a.css");@font-face{font-family:X;src:url(x.woff2)}@keyframes spin{to{transform:rotate(360deg)}}`,
+		},
+		{
+			name:    "comments are skipped",
+			css:     "/* header { } */ .a{color:red} /* .b{color:blue} */\n.b /* note */ {color:blue}",
+			classes: used("a", "b"),
+			want:    `.a{color:red}.b /* note */{color:blue}`,
+		},
+		{
+			name:    "braces and semicolons in strings",
+			css:     `.a::after{content:"}{;"}.b{content:'\'}'}p{color:red}`,
+			classes: used("b"),
+			want:    `.b{content:'\'}'}p{color:red}`,
+		},
+		{
+			name:    "upper-case at-rule names",
+			css:     `@MEDIA print{.a{color:red}.b{color:blue}}`,
+			classes: used("a"),
+			want:    `@MEDIA print{.a{color:red}}`,
+		},
+	}
+	for _, tt := range tests {
+		if got := string(Parse([]byte(tt.css)).Extract(tt.classes)); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractMalformed(t *testing.T) {
+	// Malformed stylesheets are parsed as far as possible, without panicking
+	tests := []struct {
+		name string
+		css  string
+		want string
+	}{
+		{"empty", ``, ``},
+		{"unclosed rule", `.a{color:red`, `.a{color:red}`},
+		{"unclosed media query", `@media print{.a{color:red}`, `@media print{.a{color:red}}`},
+		{"stray closing brace", `}.a{color:red}`, `.a{color:red}`},
+		{"selector without a block", `.a{color:red}.b`, `.a{color:red}`},
+		{"declaration outside a rule", `color:red;.a{color:red}`, `.a{color:red}`},
+		{"unclosed comment", `.a{color:red}/* .b{`, `.a{color:red}`},
+		{"unclosed string", `.a{content:"}`, `.a{content:"}`},
+		{"trailing backslash", `.a{color:red}\`, `.a{color:red}`},
+		{"unclosed attribute selector", `.a[x{color:red}`, `.a[x{color:red}`},
+	}
+	for _, tt := range tests {
+		if got := string(Parse([]byte(tt.css)).Extract(used("a"))); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractReusesStylesheet(t *testing.T) {
+	sheet := Parse([]byte(`html{margin:0}.a{color:red}.b{color:blue}`))
+	if got, want := string(sheet.Extract(used("a"))), `html{margin:0}.a{color:red}`; got != want {
+		t.Errorf("first page: got %s, want %s", got, want)
+	}
+	if got, want := string(sheet.Extract(used("b"))), `html{margin:0}.b{color:blue}`; got != want {
+		t.Errorf("second page: got %s, want %s", got, want)
+	}
+}
+
+func TestSelectorClasses(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		{`p`, nil},
+		{`.a`, []string{"a"}},
+		{`.a.b:hover > .c`, []string{"a", "b", "c"}},
+		{`.md\:p-4`, []string{"md:p-4"}},
+		{`.\32 xl\:p-4`, []string{"2xl:p-4"}},
+		{`.\000032xl`, []string{"2xl"}},
+		{`.\31 0`, []string{"10"}},
+		{`.é-x`, []string{"é-x"}},
+		{`[data-x=".y"] .z`, []string{"z"}},
+		{`a\.b`, nil},
+		{`.`, nil},
+	}
+	for _, tt := range tests {
+		if got := selectorClasses(tt.selector); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("selectorClasses(%q) = %q, want %q", tt.selector, got, tt.want)
+		}
+	}
+}
+
+func TestSplitSelectors(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{`.a`, []string{".a"}},
+		{`.a, .b ,p`, []string{".a", ".b", "p"}},
+		{`:is(.a,.b),.c`, []string{":is(.a,.b)", ".c"}},
+		{`[x=","],.c`, []string{`[x=","]`, ".c"}},
+		{`.a\,b,.c`, []string{`.a\,b`, ".c"}},
+	}
+	for _, tt := range tests {
+		if got := splitSelectors(tt.list); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitSelectors(%q) = %q, want %q", tt.list, got, tt.want)
+		}
+	}
+}
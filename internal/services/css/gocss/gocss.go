@@ -0,0 +1,217 @@
+// Package gocss generates utility CSS in pure Go. It understands the subset
+// of Tailwind used by the press templates and editor (spacing, colors,
+// typography, flex and grid layout, borders, effects, the typography plugin's
+// prose classes, hover and focus states, the dark variant, the important
+// modifier and the responsive prefixes) and the theme's tokens, so sites can
+// be styled without a node installation.
+package gocss
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sawthet.go-press-server.net/internal/models"
+)
+
+var classAttr = regexp.MustCompile(`\bclass\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// Classes returns the distinct class names used in the class attributes of
+// html, sorted
+func Classes(html []byte) []string {
+	seen := make(map[string]bool)
+	for _, match := range classAttr.FindAllSubmatch(html, -1) {
+		value := match[1]
+		if value == nil {
+			value = match[2]
+		}
+		for _, class := range strings.Fields(string(value)) {
+			seen[class] = true
+		}
+	}
+
+	classes := make([]string, 0, len(seen))
+	for class := range seen {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+// Generate returns a minified stylesheet with the base styles and the rules
+// for every supported utility class used in html, using theme for the
+// project's colors, font and spacing. Unsupported classes are ignored.
+func Generate(html []byte, theme models.Theme) []byte {
+	g := newGenerator(theme)
+
+	var entries []entry
+	for _, class := range Classes(html) {
+		if e, ok := g.entry(class); ok {
+			entries = append(entries, e)
+		}
+	}
+
+	// Later rules win, so responsive rules come last, dark rules follow
+	// light ones, states follow plain utilities and utilities keep
+	// Tailwind's relative order
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.media != b.media {
+			return a.media < b.media
+		}
+		if a.dark != b.dark {
+			return b.dark
+		}
+		if a.state != b.state {
+			return a.state < b.state
+		}
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		return a.class < b.class
+	})
+
+	var css strings.Builder
+	fmt.Fprintf(&css, preflight, g.sansFonts())
+	css.WriteString(g.rootVariables())
+
+	query := ""
+	for _, e := range entries {
+		if q := g.query(e); q != query {
+			if query != "" {
+				css.WriteString("}")
+			}
+			query = q
+			if query != "" {
+				css.WriteString("@media " + query + "{")
+			}
+		}
+		e.write(&css)
+	}
+	if query != "" {
+		css.WriteString("}")
+	}
+
+	return []byte(css.String())
+}
+
+// Interaction states a class can be prefixed with
+const (
+	stateNone = iota
+	stateHover
+	stateFocus
+)
+
+var statePseudo = []string{"", ":hover", ":focus"}
+
+// query returns the media query an entry's rules are emitted in, if any
+func (g *generator) query(e entry) string {
+	var conditions []string
+	if e.media != 0 {
+		conditions = append(conditions, "(min-width:"+g.breakpoints[e.media-1].width+")")
+	}
+	if e.dark && g.darkMode == models.DarkModeMedia {
+		conditions = append(conditions, "(prefers-color-scheme:dark)")
+	}
+	return strings.Join(conditions, " and ")
+}
+
+// entry is a class together with the rules generated for it
+type entry struct {
+	class     string
+	media     int // 0, or the 1-based index of the breakpoint
+	dark      bool
+	ancestor  string // selector of an ancestor the rules are scoped to
+	state     int
+	rank      int
+	important bool
+	blocks    []block
+}
+
+// block is one rule of a utility: declarations for the class's selector
+// followed by suffix
+type block struct {
+	suffix string
+	body   string
+}
+
+func (e entry) write(css *strings.Builder) {
+	selector := e.ancestor + "." + escapeClass(e.class) + statePseudo[e.state]
+	for _, b := range e.blocks {
+		body := b.body
+		if e.important {
+			body = strings.ReplaceAll(body, ";", " !important;") + " !important"
+		}
+		css.WriteString(selector + b.suffix + "{" + body + "}")
+	}
+}
+
+// entry parses the variants and modifiers of a class and resolves its utility
+func (g *generator) entry(class string) (entry, bool) {
+	e := entry{class: class}
+
+	name := class
+	for {
+		variant, rest, found := strings.Cut(name, ":")
+		if !found {
+			break
+		}
+		name = rest
+
+		switch variant {
+		case "dark":
+			if e.dark {
+				return e, false
+			}
+			e.dark = true
+			if g.darkMode == models.DarkModeClass {
+				e.ancestor = ".dark "
+			}
+		case "hover", "focus":
+			if e.state != stateNone {
+				return e, false
+			}
+			e.state = stateHover
+			if variant == "focus" {
+				e.state = stateFocus
+			}
+		default:
+			if e.media != 0 {
+				return e, false
+			}
+			for i, bp := range g.breakpoints {
+				if bp.name == variant {
+					e.media = i + 1
+				}
+			}
+			if e.media == 0 {
+				return e, false
+			}
+		}
+	}
+
+	name, e.important = strings.CutPrefix(name, "!")
+
+	var ok bool
+	e.rank, e.blocks, ok = g.utility(name)
+	return e, ok
+}
+
+// escapeClass escapes a class name for use in a selector
+func escapeClass(class string) string {
+	var b strings.Builder
+	for i := 0; i < len(class); i++ {
+		c := class[i]
+		switch {
+		case i == 0 && c >= '0' && c <= '9':
+			fmt.Fprintf(&b, `\3%c `, c)
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c >= 0x80:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
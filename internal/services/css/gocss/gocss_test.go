@@ -0,0 +1,221 @@
+package gocss
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sawthet.go-press-server.net/internal/models"
+)
+
+// generated returns the rules Generate emits for classes, without the base
+// styles and root variables
+func generated(t *testing.T, classes string, theme models.Theme) string {
+	t.Helper()
+	g := newGenerator(theme)
+	base := fmt.Sprintf(preflight, g.sansFonts()) + g.rootVariables()
+	css := string(Generate([]byte(`<div class="`+classes+`"></div>`), theme))
+	rest, found := strings.CutPrefix(css, base)
+	if !found {
+		t.Fatalf("stylesheet for %q does not start with the base styles", classes)
+	}
+	return rest
+}
+
+func TestClasses(t *testing.T) {
+	html := []byte(`<div class="p-4  mt-2"><p class='text-sm p-4'>x</p><span class = "
+		hover:bg-primary"></span><i class=""></i></div>`)
+	want := []string{"hover:bg-primary", "mt-2", "p-4", "text-sm"}
+	if got := Classes(html); !reflect.DeepEqual(got, want) {
+		t.Errorf("Classes = %v, want %v", got, want)
+	}
+}
+
+func TestGenerateUtilities(t *testing.T) {
+	theme := models.Theme{
+		Colors:     models.Colors{Primary: "#3b82f6"},
+		Palettes:   map[string]models.ColorScale{"brand": {"DEFAULT": "#f00", "500": "#e00"}},
+		Spacing:    models.Spacing{Medium: "1.5rem"},
+		Radii:      map[string]string{"DEFAULT": "6px", "card": "12px"},
+		Shadows:    map[string]string{"md": "0 2px 4px #0000001a"},
+		Typography: models.Typography{LineHeights: map[string]string{"tight": "1.1", "prose": "1.8"}},
+	}
+	tests := []struct {
+		class string
+		want  string
+	}{
+		// Spacing
+		{"p-4", `.p-4{padding:1rem}`},
+		{"px-2.5", `.px-2\.5{padding-left:0.625rem;padding-right:0.625rem}`},
+		{"m-0", `.m-0{margin:0px}`},
+		{"mx-auto", `.mx-auto{margin-left:auto;margin-right:auto}`},
+		{"-mt-2", `.-mt-2{margin-top:-0.5rem}`},
+		{"-mx-px", `.-mx-px{margin-left:-1px;margin-right:-1px}`},
+		{"p-md", `.p-md{padding:1.5rem}`},
+		{"gap-x-3", `.gap-x-3{column-gap:0.75rem}`},
+		{"space-x-4", `.space-x-4 > :not([hidden]) ~ :not([hidden]){margin-left:1rem}`},
+		{"w-1/2", `.w-1\/2{width:50%}`},
+		{"-top-1/3", `.-top-1\/3{top:-33.333333%}`},
+
+		// Colors
+		{"bg-primary", `.bg-primary{background-color:var(--color-primary)}`},
+		{"text-brand", `.text-brand{color:var(--color-brand)}`},
+		{"border-brand-500", `.border-brand-500{border-color:var(--color-brand-500)}`},
+		{"bg-blue-500", `.bg-blue-500{background-color:#3b82f6}`},
+		{"text-white", `.text-white{color:#fff}`},
+		{"ring-red-500", `.ring-red-500{--tw-ring-color:#ef4444}`},
+
+		// Themed tokens, falling back to the defaults
+		{"rounded", `.rounded{border-radius:6px}`},
+		{"rounded-card", `.rounded-card{border-radius:12px}`},
+		{"rounded-t-lg", `.rounded-t-lg{border-top-left-radius:0.5rem;border-top-right-radius:0.5rem}`},
+		{"shadow-md", `.shadow-md{box-shadow:0 2px 4px #0000001a}`},
+		{"shadow-sm", `.shadow-sm{box-shadow:0 1px 2px 0 rgb(0 0 0 / 0.05)}`},
+		{"leading-tight", `.leading-tight{line-height:1.1}`},
+		{"leading-prose", `.leading-prose{line-height:1.8}`},
+		{"leading-loose", `.leading-loose{line-height:2}`},
+
+		// Typography and the rest
+		{"text-sm", `.text-sm{font-size:0.875rem;line-height:1.25rem}`},
+		{"font-bold", `.font-bold{font-weight:700}`},
+		{"border", `.border{border-width:1px}`},
+		{"hidden", `.hidden{display:none}`},
+		{"grid-cols-3", `.grid-cols-3{grid-template-columns:repeat(3, minmax(0, 1fr))}`},
+		{"opacity-50", `.opacity-50{opacity:0.5}`},
+		{"2xl:p-1", `@media (min-width:1536px){.\32 xl\:p-1{padding:0.25rem}}`},
+	}
+	for _, tt := range tests {
+		if got := generated(t, tt.class, theme); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.class, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateVariants(t *testing.T) {
+	tests := []struct {
+		class string
+		want  string
+	}{
+		{"hover:bg-white", `.hover\:bg-white:hover{background-color:#fff}`},
+		{"focus:ring", `.focus\:ring:focus{box-shadow:0 0 0 3px var(--tw-ring-color, rgb(59 130 246 / 0.5))}`},
+		{"!p-4", `.\!p-4{padding:1rem !important}`},
+		{"!text-sm", `.\!text-sm{font-size:0.875rem !important;line-height:1.25rem !important}`},
+		{"md:hover:!mt-1", `@media (min-width:768px){.md\:hover\:\!mt-1:hover{margin-top:0.25rem !important}}`},
+		{"dark:bg-black", `@media (prefers-color-scheme:dark){.dark\:bg-black{background-color:#000}}`},
+		{"lg:dark:text-white", `@media (min-width:1024px) and (prefers-color-scheme:dark){.lg\:dark\:text-white{color:#fff}}`},
+	}
+	for _, tt := range tests {
+		if got := generated(t, tt.class, models.Theme{}); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.class, got, tt.want)
+		}
+	}
+
+	// In class mode dark rules are scoped to an ancestor with the dark class
+	theme := models.Theme{Dark: &models.DarkTheme{Mode: models.DarkModeClass}}
+	if got, want := generated(t, "dark:hover:text-white", theme), `.dark .dark\:hover\:text-white:hover{color:#fff}`; got != want {
+		t.Errorf("class mode dark:\n got %s\nwant %s", got, want)
+	}
+	if got, want := generated(t, "md:dark:p-2", theme), `@media (min-width:768px){.dark .md\:dark\:p-2{padding:0.5rem}}`; got != want {
+		t.Errorf("class mode responsive dark:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestGenerateOrder(t *testing.T) {
+	theme := models.Theme{Breakpoints: map[string]string{"tablet": "700px", "wide": "90rem"}}
+	classes := "wide:p-1 sm:p-1 dark:p-1 hover:p-1 tablet:p-1 p-1 md:p-1 mt-1 sm:dark:p-1 p-2"
+	want := `.mt-1{margin-top:0.25rem}` +
+		`.p-1{padding:0.25rem}` +
+		`.p-2{padding:0.5rem}` +
+		`.hover\:p-1:hover{padding:0.25rem}` +
+		`@media (prefers-color-scheme:dark){.dark\:p-1{padding:0.25rem}}` +
+		`@media (min-width:640px){.sm\:p-1{padding:0.25rem}}` +
+		`@media (min-width:640px) and (prefers-color-scheme:dark){.sm\:dark\:p-1{padding:0.25rem}}` +
+		`@media (min-width:700px){.tablet\:p-1{padding:0.25rem}}` +
+		`@media (min-width:768px){.md\:p-1{padding:0.25rem}}` +
+		`@media (min-width:90rem){.wide\:p-1{padding:0.25rem}}`
+	if got := generated(t, classes, theme); got != want {
+		t.Errorf("rules are out of order:\n got %s\nwant %s", got, want)
+	}
+
+	// Rules of the same media query share one block
+	got := generated(t, "md:p-1 md:mt-1 md:hover:p-2", models.Theme{})
+	if want := `@media (min-width:768px){.md\:mt-1{margin-top:0.25rem}.md\:p-1{padding:0.25rem}.md\:hover\:p-2:hover{padding:0.5rem}}`; got != want {
+		t.Errorf("responsive rules:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestGenerateIgnoresUnsupportedClasses(t *testing.T) {
+	for _, class := range []string{
+		"not-a-utility", "p-97", "p-4.25", "-p-4", "w--4", "bg-brand", "text-gray-1000", "rounded-huge",
+		"shadow-card", "opacity-33", "grid-cols-13", "hover:focus:p-4", "dark:dark:p-4", "sm:md:p-4",
+		"print:p-4", "p-4:", "hover:", "!", "-", "w-3/2", "w-1/0", "border-3",
+	} {
+		if got := generated(t, class, models.Theme{}); got != "" {
+			t.Errorf("unsupported class %q generated %s", class, got)
+		}
+	}
+}
+
+func TestEscapeClass(t *testing.T) {
+	tests := []struct {
+		class string
+		want  string
+	}{
+		{"p-4", `p-4`},
+		{"md:p-4", `md\:p-4`},
+		{"w-1/2", `w-1\/2`},
+		{"px-0.5", `px-0\.5`},
+		{"!mt-2", `\!mt-2`},
+		{"2xl:mt-2", `\32 xl\:mt-2`},
+		{"x_y", `x_y`},
+		{"é", "é"},
+		{`a"b`, `a\"b`},
+	}
+	for _, tt := range tests {
+		if got := escapeClass(tt.class); got != tt.want {
+			t.Errorf("escapeClass(%q) = %s, want %s", tt.class, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateDropsUnsafeThemeValues(t *testing.T) {
+	for _, value := range []string{
+		`red;}body{display:none`,
+		`red}`,
+		`{red`,
+		`red</style><script>alert(1)</script>`,
+		`red/*`,
+		"red\n}",
+		`\72 ed`,
+	} {
+		tokens := map[string]string{"DEFAULT": value, "x": value}
+		theme := models.Theme{
+			Colors:      models.Colors{Primary: value},
+			Typography:  models.Typography{FontFamily: value, LineHeights: tokens},
+			Spacing:     models.Spacing{Small: value},
+			Palettes:    map[string]models.ColorScale{"brand": {"DEFAULT": value, "500": value}},
+			Radii:       tokens,
+			Shadows:     tokens,
+			Breakpoints: tokens,
+			Dark:        &models.DarkTheme{Colors: models.Colors{Primary: value}},
+		}
+		classes := "bg-primary text-brand text-brand-500 p-sm rounded rounded-x shadow shadow-x leading-x x:p-4 font-sans"
+		css := string(Generate([]byte(`<div class="`+classes+`"></div>`), theme))
+		if strings.Contains(css, value) {
+			t.Errorf("theme value %q was written to the stylesheet", value)
+		}
+		if strings.Count(css, "{") != strings.Count(css, "}") {
+			t.Errorf("theme value %q unbalanced the stylesheet", value)
+		}
+
+		// Themed utilities fall back to the defaults; the rest are ignored
+		got := generated(t, classes, theme)
+		want := `.rounded{border-radius:0.25rem}` +
+			`.font-sans{font-family:` + defaultSansFonts + `}` +
+			`.shadow{box-shadow:` + shadows[""] + `}`
+		if got != want {
+			t.Errorf("theme value %q:\n got %s\nwant %s", value, got, want)
+		}
+	}
+}
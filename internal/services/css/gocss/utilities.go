@@ -0,0 +1,697 @@
+package gocss
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sawthet.go-press-server.net/internal/models"
+)
+
+// valueFunc resolves the value part of a utility, such as "4" in "p-4", to
+// the declarations of its rule
+type valueFunc func(g *generator, value string) (string, bool)
+
+// rule is a utility: either a fixed class with its blocks, or a prefix whose
+// value is resolved by a valueFunc. The index of a rule in rules is its rank.
+type rule struct {
+	name     string
+	blocks   []block
+	value    valueFunc
+	suffix   string
+	negative bool
+}
+
+func exact(name, body string) rule {
+	return rule{name: name, blocks: []block{{body: body}}}
+}
+
+func exacts(prop string, names map[string]string) []rule {
+	var list []rule
+	for _, name := range sortedNames(names) {
+		list = append(list, exact(name, prop+":"+names[name]))
+	}
+	return list
+}
+
+func prefix(name string, value valueFunc) rule {
+	return rule{name: name, value: value}
+}
+
+// property builds a valueFunc setting each of props to the resolved value
+func property(resolve func(g *generator, value string) (string, bool), props ...string) valueFunc {
+	return func(g *generator, value string) (string, bool) {
+		v, ok := resolve(g, value)
+		if !ok {
+			return "", false
+		}
+		decls := make([]string, len(props))
+		for i, prop := range props {
+			decls[i] = prop + ":" + v
+		}
+		return strings.Join(decls, ";"), true
+	}
+}
+
+// themed resolves values from the theme's tokens, where DEFAULT names the
+// utility without a value, falling back to the built-in values
+func themed(defaults map[string]string, tokens func(models.Theme) map[string]string) func(*generator, string) (string, bool) {
+	return func(g *generator, value string) (string, bool) {
+		name := value
+		if name == "" {
+			name = models.DefaultToken
+		}
+		if v := tokens(g.theme)[name]; v != "" && safeValue(v) {
+			return v, true
+		}
+		v, ok := defaults[value]
+		return v, ok
+	}
+}
+
+func themeRadii(theme models.Theme) map[string]string { return theme.Radii }
+
+func themeShadows(theme models.Theme) map[string]string { return theme.Shadows }
+
+func themeLineHeights(theme models.Theme) map[string]string { return theme.Typography.LineHeights }
+
+// fromMap resolves values by looking them up in values
+func fromMap(values map[string]string) func(*generator, string) (string, bool) {
+	return func(_ *generator, value string) (string, bool) {
+		v, ok := values[value]
+		return v, ok
+	}
+}
+
+var rules = buildRules()
+
+// exactRules indexes the fixed classes of rules by name
+var exactRules = func() map[string]int {
+	index := make(map[string]int)
+	for i, r := range rules {
+		if r.value == nil {
+			index[r.name] = i
+		}
+	}
+	return index
+}()
+
+// buildRules lists the supported utilities in Tailwind's order, so that of
+// two conflicting utilities on an element the same one wins as with Tailwind
+func buildRules() []rule {
+	var list []rule
+	add := func(r ...rule) {
+		list = append(list, r...)
+	}
+
+	// Components
+	add(rule{name: "prose", blocks: proseBlocks})
+	add(exact("prose-sm", "font-size:0.875rem;line-height:1.7142857"))
+	add(exact("prose-base", "font-size:1rem;line-height:1.75"))
+	add(exact("prose-lg", "font-size:1.125rem;line-height:1.7777778"))
+	add(exact("prose-xl", "font-size:1.25rem;line-height:1.8"))
+
+	// Layout
+	add(exact("sr-only", "position:absolute;width:1px;height:1px;padding:0;margin:-1px;overflow:hidden;clip:rect(0, 0, 0, 0);white-space:nowrap;border-width:0"))
+	add(exacts("position", map[string]string{"static": "static", "fixed": "fixed", "absolute": "absolute", "relative": "relative", "sticky": "sticky"})...)
+	add(rule{name: "inset", value: property(inset, "inset"), negative: true})
+	add(rule{name: "inset-x", value: property(inset, "left", "right"), negative: true})
+	add(rule{name: "inset-y", value: property(inset, "top", "bottom"), negative: true})
+	for _, side := range []string{"top", "right", "bottom", "left"} {
+		add(rule{name: side, value: property(inset, side), negative: true})
+	}
+	add(prefix("z", property(fromMap(map[string]string{"0": "0", "10": "10", "20": "20", "30": "30", "40": "40", "50": "50", "auto": "auto"}), "z-index")))
+	add(prefix("col-span", colSpan))
+
+	// Margin
+	for _, m := range []struct {
+		name  string
+		props []string
+	}{
+		{"m", []string{"margin"}},
+		{"mx", []string{"margin-left", "margin-right"}},
+		{"my", []string{"margin-top", "margin-bottom"}},
+		{"mt", []string{"margin-top"}},
+		{"mr", []string{"margin-right"}},
+		{"mb", []string{"margin-bottom"}},
+		{"ml", []string{"margin-left"}},
+	} {
+		add(rule{name: m.name, value: property(margin, m.props...), negative: true})
+	}
+
+	// Display
+	add(exacts("display", map[string]string{
+		"block": "block", "inline-block": "inline-block", "inline": "inline", "flex": "flex",
+		"inline-flex": "inline-flex", "grid": "grid", "inline-grid": "inline-grid", "table": "table",
+		"contents": "contents", "list-item": "list-item", "hidden": "none",
+	})...)
+	add(exact("aspect-square", "aspect-ratio:1 / 1"), exact("aspect-video", "aspect-ratio:16 / 9"))
+
+	// Sizing
+	add(prefix("size", property(sizing("100%"), "width", "height")))
+	add(prefix("h", property(sizing("100vh"), "height")))
+	add(prefix("max-h", property(sizing("100vh"), "max-height")))
+	add(prefix("min-h", property(fromMap(map[string]string{"0": "0px", "full": "100%", "screen": "100vh", "fit": "fit-content"}), "min-height")))
+	add(prefix("w", property(sizing("100vw"), "width")))
+	add(prefix("min-w", property(fromMap(map[string]string{"0": "0px", "full": "100%", "min": "min-content", "max": "max-content", "fit": "fit-content"}), "min-width")))
+	add(prefix("max-w", property(fromMap(maxWidths), "max-width")))
+
+	// Flexbox and grid
+	add(exacts("flex", map[string]string{"flex-1": "1 1 0%", "flex-auto": "1 1 auto", "flex-initial": "0 1 auto", "flex-none": "none"})...)
+	add(exacts("flex-shrink", map[string]string{"shrink": "1", "shrink-0": "0", "flex-shrink": "1", "flex-shrink-0": "0"})...)
+	add(exacts("flex-grow", map[string]string{"grow": "1", "grow-0": "0", "flex-grow": "1", "flex-grow-0": "0"})...)
+	add(exacts("list-style-type", map[string]string{"list-none": "none", "list-disc": "disc", "list-decimal": "decimal"})...)
+	add(prefix("grid-cols", gridCols))
+	add(exacts("flex-direction", map[string]string{"flex-row": "row", "flex-row-reverse": "row-reverse", "flex-col": "column", "flex-col-reverse": "column-reverse"})...)
+	add(exacts("flex-wrap", map[string]string{"flex-wrap": "wrap", "flex-wrap-reverse": "wrap-reverse", "flex-nowrap": "nowrap"})...)
+	add(exacts("align-items", map[string]string{"items-start": "flex-start", "items-end": "flex-end", "items-center": "center", "items-baseline": "baseline", "items-stretch": "stretch"})...)
+	add(exacts("justify-content", map[string]string{
+		"justify-normal": "normal", "justify-start": "flex-start", "justify-end": "flex-end", "justify-center": "center",
+		"justify-between": "space-between", "justify-around": "space-around", "justify-evenly": "space-evenly",
+	})...)
+	add(prefix("gap", property(spacing, "gap")))
+	add(prefix("gap-x", property(spacing, "column-gap")))
+	add(prefix("gap-y", property(spacing, "row-gap")))
+	add(rule{name: "space-x", value: property(spacing, "margin-left"), suffix: " > :not([hidden]) ~ :not([hidden])"})
+	add(rule{name: "space-y", value: property(spacing, "margin-top"), suffix: " > :not([hidden]) ~ :not([hidden])"})
+	add(exacts("align-self", map[string]string{"self-auto": "auto", "self-start": "flex-start", "self-end": "flex-end", "self-center": "center", "self-stretch": "stretch"})...)
+
+	// Overflow and text wrapping
+	add(exacts("overflow", map[string]string{"overflow-auto": "auto", "overflow-hidden": "hidden", "overflow-visible": "visible", "overflow-scroll": "scroll"})...)
+	add(exacts("overflow-x", map[string]string{"overflow-x-auto": "auto", "overflow-x-hidden": "hidden"})...)
+	add(exacts("overflow-y", map[string]string{"overflow-y-auto": "auto", "overflow-y-hidden": "hidden"})...)
+	add(exact("truncate", "overflow:hidden;text-overflow:ellipsis;white-space:nowrap"))
+	add(exacts("white-space", map[string]string{"whitespace-normal": "normal", "whitespace-nowrap": "nowrap", "whitespace-pre": "pre", "whitespace-pre-line": "pre-line", "whitespace-pre-wrap": "pre-wrap"})...)
+	add(exacts("overflow-wrap", map[string]string{"break-words": "break-word"})...)
+
+	// Borders
+	add(prefix("rounded", property(themed(radii, themeRadii), "border-radius")))
+	for _, side := range []struct {
+		name    string
+		corners []string
+	}{
+		{"rounded-t", []string{"border-top-left-radius", "border-top-right-radius"}},
+		{"rounded-r", []string{"border-top-right-radius", "border-bottom-right-radius"}},
+		{"rounded-b", []string{"border-bottom-right-radius", "border-bottom-left-radius"}},
+		{"rounded-l", []string{"border-top-left-radius", "border-bottom-left-radius"}},
+	} {
+		add(prefix(side.name, property(themed(radii, themeRadii), side.corners...)))
+	}
+	for _, side := range []struct {
+		name  string
+		props []string
+	}{
+		{"border", []string{"border-width"}},
+		{"border-x", []string{"border-left-width", "border-right-width"}},
+		{"border-y", []string{"border-top-width", "border-bottom-width"}},
+		{"border-t", []string{"border-top-width"}},
+		{"border-r", []string{"border-right-width"}},
+		{"border-b", []string{"border-bottom-width"}},
+		{"border-l", []string{"border-left-width"}},
+	} {
+		add(prefix(side.name, property(borderWidth, side.props...)))
+	}
+	add(exacts("border-style", map[string]string{"border-solid": "solid", "border-dashed": "dashed", "border-dotted": "dotted", "border-none": "none"})...)
+	add(prefix("border", property(color, "border-color")))
+
+	// Backgrounds
+	add(prefix("bg", property(color, "background-color")))
+	add(exacts("object-fit", map[string]string{"object-contain": "contain", "object-cover": "cover", "object-fill": "fill", "object-none": "none"})...)
+	add(exacts("object-position", map[string]string{"object-center": "center", "object-top": "top", "object-bottom": "bottom"})...)
+
+	// Padding
+	for _, p := range []struct {
+		name  string
+		props []string
+	}{
+		{"p", []string{"padding"}},
+		{"px", []string{"padding-left", "padding-right"}},
+		{"py", []string{"padding-top", "padding-bottom"}},
+		{"pt", []string{"padding-top"}},
+		{"pr", []string{"padding-right"}},
+		{"pb", []string{"padding-bottom"}},
+		{"pl", []string{"padding-left"}},
+	} {
+		add(prefix(p.name, property(spacing, p.props...)))
+	}
+
+	// Typography
+	add(exacts("text-align", map[string]string{"text-left": "left", "text-center": "center", "text-right": "right", "text-justify": "justify"})...)
+	add(prefix("font", fontFamily))
+	add(prefix("text", fontSize))
+	add(prefix("font", property(fromMap(fontWeights), "font-weight")))
+	add(exacts("text-transform", map[string]string{"uppercase": "uppercase", "lowercase": "lowercase", "capitalize": "capitalize", "normal-case": "none"})...)
+	add(exacts("font-style", map[string]string{"italic": "italic", "not-italic": "normal"})...)
+	add(prefix("leading", property(themed(lineHeights, themeLineHeights), "line-height")))
+	add(prefix("tracking", property(fromMap(letterSpacings), "letter-spacing")))
+	add(prefix("text", property(color, "color")))
+	add(exacts("text-decoration-line", map[string]string{"underline": "underline", "overline": "overline", "line-through": "line-through", "no-underline": "none"})...)
+
+	// Effects
+	add(prefix("opacity", opacity))
+	add(prefix("shadow", property(themed(shadows, themeShadows), "box-shadow")))
+	add(exact("outline-none", "outline:2px solid transparent;outline-offset:2px"))
+	add(prefix("ring", ringWidth))
+	add(prefix("ring", property(color, "--tw-ring-color")))
+
+	// Transitions and interactivity
+	add(prefix("transition", transition))
+	add(exact("transition-none", "transition-property:none"))
+	add(prefix("duration", duration))
+	add(exacts("transition-timing-function", map[string]string{
+		"ease-linear": "linear", "ease-in": "cubic-bezier(0.4, 0, 1, 1)",
+		"ease-out": "cubic-bezier(0, 0, 0.2, 1)", "ease-in-out": "cubic-bezier(0.4, 0, 0.2, 1)",
+	})...)
+	add(exacts("cursor", map[string]string{"cursor-pointer": "pointer", "cursor-default": "default", "cursor-not-allowed": "not-allowed"})...)
+	add(exacts("user-select", map[string]string{"select-none": "none", "select-text": "text", "select-all": "all"})...)
+
+	return list
+}
+
+// generator resolves utilities against a project's theme
+type generator struct {
+	theme models.Theme
+	// breakpoints are the responsive prefixes in the order their media
+	// queries are emitted
+	breakpoints []breakpoint
+	darkMode    string
+}
+
+type breakpoint struct {
+	name  string
+	width string
+	px    float64
+}
+
+func newGenerator(theme models.Theme) *generator {
+	g := &generator{
+		theme:    theme,
+		darkMode: theme.DarkMode(),
+	}
+	if g.darkMode == "" {
+		g.darkMode = models.DarkModeMedia
+	}
+
+	widths := make(map[string]string, len(defaultBreakpoints))
+	for name, width := range defaultBreakpoints {
+		widths[name] = width
+	}
+	for name, width := range theme.Breakpoints {
+		if models.IsTokenName(name) && safeValue(width) {
+			widths[name] = width
+		}
+	}
+	for name, width := range widths {
+		if px, ok := pixels(width); ok {
+			g.breakpoints = append(g.breakpoints, breakpoint{name, width, px})
+		}
+	}
+	sort.Slice(g.breakpoints, func(i, j int) bool {
+		a, b := g.breakpoints[i], g.breakpoints[j]
+		if a.px != b.px {
+			return a.px < b.px
+		}
+		return a.name < b.name
+	})
+
+	return g
+}
+
+var lengthValue = regexp.MustCompile(`^(\d*\.?\d+)(px|rem|em)$`)
+
+// pixels converts a breakpoint width to pixels so breakpoints can be ordered
+func pixels(width string) (float64, bool) {
+	m := lengthValue.FindStringSubmatch(width)
+	if m == nil {
+		return 0, false
+	}
+	n, _ := strconv.ParseFloat(m[1], 64)
+	if m[2] != "px" {
+		n *= 16
+	}
+	return n, true
+}
+
+// utility resolves a class name without variants to its rank and blocks
+func (g *generator) utility(name string) (int, []block, bool) {
+	if i, ok := exactRules[name]; ok {
+		return i, rules[i].blocks, true
+	}
+
+	name, negative := strings.CutPrefix(name, "-")
+	for i, r := range rules {
+		if r.value == nil || (negative && !r.negative) {
+			continue
+		}
+
+		var value string
+		switch {
+		case name == r.name:
+		case strings.HasPrefix(name, r.name+"-"):
+			value = name[len(r.name)+1:]
+		default:
+			continue
+		}
+
+		if negative {
+			value = "-" + value
+		}
+		body, ok := r.value(g, value)
+		if ok {
+			return i, []block{{suffix: r.suffix, body: body}}, true
+		}
+	}
+	return 0, nil, false
+}
+
+// sansFonts returns the font stack of font-sans and of the page
+func (g *generator) sansFonts() string {
+	if family := g.theme.FontFamilyStacks()["sans"]; family != "" && safeValue(family) {
+		if strings.HasSuffix(family, "sans-serif") {
+			return family
+		}
+		return family + ", sans-serif"
+	}
+	return defaultSansFonts
+}
+
+// themeColors maps the theme's color names to their values
+func (g *generator) themeColors() map[string]string {
+	return map[string]string{
+		"primary":    g.theme.Colors.Primary,
+		"secondary":  g.theme.Colors.Secondary,
+		"background": g.theme.Colors.Background,
+		"text":       g.theme.Colors.Text,
+	}
+}
+
+// rootVariables declares the theme tokens as custom properties, which the
+// theme's color utilities refer to, and overrides the colors in dark mode
+func (g *generator) rootVariables() string {
+	css := declarations(":root", g.theme.Properties())
+	dark := g.theme.DarkProperties()
+	switch g.theme.DarkMode() {
+	case models.DarkModeMedia:
+		if block := declarations(":root", dark); block != "" {
+			css += "@media (prefers-color-scheme:dark){" + block + "}"
+		}
+	case models.DarkModeClass:
+		css += declarations(".dark", dark)
+	}
+	return css
+}
+
+// declarations writes a rule declaring the properties with safe values
+func declarations(selector string, props []models.Property) string {
+	var decls []string
+	for _, prop := range props {
+		if safeValue(prop.Value) {
+			decls = append(decls, prop.Name+":"+prop.Value)
+		}
+	}
+	if len(decls) == 0 {
+		return ""
+	}
+	return selector + "{" + strings.Join(decls, ";") + "}"
+}
+
+// unsafeValue matches theme values that could end a declaration or rule
+var unsafeValue = regexp.MustCompile(`[;{}<>\\]|/\*|\n`)
+
+// safeValue reports whether a theme value can be written into a declaration
+func safeValue(value string) bool {
+	return !unsafeValue.MatchString(value)
+}
+
+var spacingNumber = regexp.MustCompile(`^-?(\d+(\.5)?)$`)
+
+// spacing resolves the spacing scale, where each unit is 0.25rem, plus the
+// theme's named spacing
+func spacing(g *generator, value string) (string, bool) {
+	switch value {
+	case "0", "-0":
+		return "0px", true
+	case "px":
+		return "1px", true
+	case "-px":
+		return "-1px", true
+	}
+
+	if m := spacingNumber.FindStringSubmatch(value); m != nil {
+		n, _ := strconv.ParseFloat(m[1], 64)
+		if n > 96 {
+			return "", false
+		}
+		return strings.TrimSuffix(value, m[1]) + formatNumber(n*0.25) + "rem", true
+	}
+
+	named := map[string]string{
+		"sm": g.theme.Spacing.Small,
+		"md": g.theme.Spacing.Medium,
+		"lg": g.theme.Spacing.Large,
+		"xl": g.theme.Spacing.XLarge,
+	}
+	if v := named[value]; v != "" && safeValue(v) {
+		return v, true
+	}
+	return "", false
+}
+
+// margin resolves spacing plus auto
+func margin(g *generator, value string) (string, bool) {
+	if value == "auto" {
+		return "auto", true
+	}
+	return spacing(g, value)
+}
+
+// inset resolves spacing plus auto, full and fractions for positioned elements
+func inset(g *generator, value string) (string, bool) {
+	switch value {
+	case "auto":
+		return "auto", true
+	case "full":
+		return "100%", true
+	case "-full":
+		return "-100%", true
+	}
+	if v, ok := fraction(value); ok {
+		return v, true
+	}
+	return spacing(g, value)
+}
+
+// sizing builds a resolver for widths and heights, with screen as the
+// viewport size along the axis
+func sizing(screen string) func(*generator, string) (string, bool) {
+	return func(g *generator, value string) (string, bool) {
+		switch value {
+		case "auto":
+			return "auto", true
+		case "full":
+			return "100%", true
+		case "screen":
+			return screen, true
+		case "min":
+			return "min-content", true
+		case "max":
+			return "max-content", true
+		case "fit":
+			return "fit-content", true
+		}
+		if strings.HasPrefix(value, "-") {
+			return "", false
+		}
+		if v, ok := fraction(value); ok {
+			return v, true
+		}
+		return spacing(g, value)
+	}
+}
+
+var fractionValue = regexp.MustCompile(`^(-?)(\d{1,2})/(\d{1,2})$`)
+
+// fraction resolves values such as 1/2 to a percentage
+func fraction(value string) (string, bool) {
+	m := fractionValue.FindStringSubmatch(value)
+	if m == nil {
+		return "", false
+	}
+	num, _ := strconv.Atoi(m[2])
+	den, _ := strconv.Atoi(m[3])
+	if den == 0 || num > den {
+		return "", false
+	}
+	percent := math.Round(float64(num)/float64(den)*100*1e6) / 1e6
+	return m[1] + formatNumber(percent) + "%", true
+}
+
+// color resolves the theme colors and palettes, which refer to their custom
+// properties, the fixed colors and the default palette scales
+func color(g *generator, value string) (string, bool) {
+	if v, ok := g.themeColors()[value]; ok {
+		if v == "" || !safeValue(v) {
+			return "", false
+		}
+		return "var(" + models.ColorProperty(value, "") + ")", true
+	}
+	for name, scale := range g.theme.Palettes {
+		shade := models.DefaultToken
+		if value != name {
+			rest, found := strings.CutPrefix(value, name+"-")
+			if !found {
+				continue
+			}
+			shade = rest
+		}
+		if v := scale[shade]; v != "" && safeValue(v) && models.IsTokenName(name) {
+			return "var(" + models.ColorProperty(name, shade) + ")", true
+		}
+	}
+	if v, ok := fixedColors[value]; ok {
+		return v, true
+	}
+	name, shade, found := strings.Cut(value, "-")
+	if !found {
+		return "", false
+	}
+	v, ok := palette[name][shade]
+	return v, ok
+}
+
+func borderWidth(_ *generator, value string) (string, bool) {
+	switch value {
+	case "":
+		return "1px", true
+	case "0", "2", "4", "8":
+		return value + "px", true
+	}
+	return "", false
+}
+
+func fontFamily(g *generator, value string) (string, bool) {
+	if stack, ok := g.theme.FontFamilyStacks()[value]; ok && value != "sans" && safeValue(stack) {
+		return "font-family:" + stack, true
+	}
+	switch value {
+	case "sans":
+		return "font-family:" + g.sansFonts(), true
+	case "serif":
+		return `font-family:ui-serif, Georgia, Cambria, "Times New Roman", Times, serif`, true
+	case "mono":
+		return `font-family:ui-monospace, SFMono-Regular, Menlo, Monaco, Consolas, monospace`, true
+	}
+	return "", false
+}
+
+// fontSize resolves text sizes. Sizes set by the theme replace the default
+// size and, as with Tailwind, leave the line height alone.
+func fontSize(g *generator, value string) (string, bool) {
+	themed := map[string]string{
+		"sm":   g.theme.Typography.FontSizes.Small,
+		"base": g.theme.Typography.FontSizes.Base,
+		"lg":   g.theme.Typography.FontSizes.Large,
+		"xl":   g.theme.Typography.FontSizes.XLarge,
+		"2xl":  g.theme.Typography.FontSizes.XXLarge,
+	}
+	if v := themed[value]; v != "" && safeValue(v) {
+		return "font-size:" + v, true
+	}
+	if size, ok := fontSizes[value]; ok {
+		return "font-size:" + size[0] + ";line-height:" + size[1], true
+	}
+	return "", false
+}
+
+func gridCols(_ *generator, value string) (string, bool) {
+	if value == "none" {
+		return "grid-template-columns:none", true
+	}
+	if n, err := strconv.Atoi(value); err == nil && n >= 1 && n <= 12 {
+		return "grid-template-columns:repeat(" + value + ", minmax(0, 1fr))", true
+	}
+	return "", false
+}
+
+func colSpan(_ *generator, value string) (string, bool) {
+	if value == "full" {
+		return "grid-column:1 / -1", true
+	}
+	if n, err := strconv.Atoi(value); err == nil && n >= 1 && n <= 12 {
+		return "grid-column:span " + value + " / span " + value, true
+	}
+	return "", false
+}
+
+func opacity(_ *generator, value string) (string, bool) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > 100 || n%5 != 0 {
+		return "", false
+	}
+	return "opacity:" + formatNumber(float64(n)/100), true
+}
+
+// ringWidth draws a focus ring with box-shadow, colored by the ring color
+// utilities
+func ringWidth(_ *generator, value string) (string, bool) {
+	width := "3"
+	switch value {
+	case "":
+	case "0", "1", "2", "4", "8":
+		width = value
+	default:
+		return "", false
+	}
+	return "box-shadow:0 0 0 " + width + "px var(--tw-ring-color, rgb(59 130 246 / 0.5))", true
+}
+
+func transition(_ *generator, value string) (string, bool) {
+	properties, ok := transitions[value]
+	if !ok {
+		return "", false
+	}
+	return "transition-property:" + properties + ";transition-timing-function:cubic-bezier(0.4, 0, 0.2, 1);transition-duration:150ms", true
+}
+
+func duration(_ *generator, value string) (string, bool) {
+	switch value {
+	case "0", "75", "100", "150", "200", "300", "500", "700", "1000":
+		return "transition-duration:" + value + "ms", true
+	}
+	return "", false
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+func sortedNames(values map[string]string) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// proseBlocks are the typography plugin's default prose styles
+var proseBlocks = []block{
+	{body: "color:#374151;max-width:65ch;font-size:1rem;line-height:1.75"},
+	{suffix: " :where(p)", body: "margin-top:1.25em;margin-bottom:1.25em"},
+	{suffix: " :where(.lead)", body: "color:#4b5563;font-size:1.25em;line-height:1.6;margin-top:1.2em;margin-bottom:1.2em"},
+	{suffix: " :where(a)", body: "color:#111827;text-decoration:underline;font-weight:500"},
+	{suffix: " :where(strong)", body: "color:#111827;font-weight:600"},
+	{suffix: " :where(ol)", body: "list-style-type:decimal;margin-top:1.25em;margin-bottom:1.25em;padding-left:1.625em"},
+	{suffix: " :where(ul)", body: "list-style-type:disc;margin-top:1.25em;margin-bottom:1.25em;padding-left:1.625em"},
+	{suffix: " :where(li)", body: "margin-top:0.5em;margin-bottom:0.5em"},
+	{suffix: " :where(blockquote)", body: "font-weight:500;font-style:italic;color:#111827;border-left:0.25rem solid #e5e7eb;margin-top:1.6em;margin-bottom:1.6em;padding-left:1em"},
+	{suffix: " :where(h1)", body: "color:#111827;font-weight:800;font-size:2.25em;margin-top:0;margin-bottom:0.8888889em;line-height:1.1111111"},
+	{suffix: " :where(h2)", body: "color:#111827;font-weight:700;font-size:1.5em;margin-top:2em;margin-bottom:1em;line-height:1.3333333"},
+	{suffix: " :where(h3)", body: "color:#111827;font-weight:600;font-size:1.25em;margin-top:1.6em;margin-bottom:0.6em;line-height:1.6"},
+	{suffix: " :where(h4)", body: "color:#111827;font-weight:600;margin-top:1.5em;margin-bottom:0.5em;line-height:1.5"},
+	{suffix: " :where(img)", body: "margin-top:2em;margin-bottom:2em"},
+	{suffix: " :where(code)", body: "color:#111827;font-weight:600;font-size:0.875em"},
+	{suffix: " :where(hr)", body: "border-color:#e5e7eb;border-top-width:1px;margin-top:3em;margin-bottom:3em"},
+}
@@ -0,0 +1,188 @@
+package gocss
+
+// palette holds the default Tailwind color scales available to color utilities
+var palette = map[string]map[string]string{
+	"slate": {
+		"50": "#f8fafc", "100": "#f1f5f9", "200": "#e2e8f0", "300": "#cbd5e1", "400": "#94a3b8", "500": "#64748b",
+		"600": "#475569", "700": "#334155", "800": "#1e293b", "900": "#0f172a", "950": "#020617",
+	},
+	"gray": {
+		"50": "#f9fafb", "100": "#f3f4f6", "200": "#e5e7eb", "300": "#d1d5db", "400": "#9ca3af", "500": "#6b7280",
+		"600": "#4b5563", "700": "#374151", "800": "#1f2937", "900": "#111827", "950": "#030712",
+	},
+	"red": {
+		"50": "#fef2f2", "100": "#fee2e2", "200": "#fecaca", "300": "#fca5a5", "400": "#f87171", "500": "#ef4444",
+		"600": "#dc2626", "700": "#b91c1c", "800": "#991b1b", "900": "#7f1d1d", "950": "#450a0a",
+	},
+	"orange": {
+		"50": "#fff7ed", "100": "#ffedd5", "200": "#fed7aa", "300": "#fdba74", "400": "#fb923c", "500": "#f97316",
+		"600": "#ea580c", "700": "#c2410c", "800": "#9a3412", "900": "#7c2d12", "950": "#431407",
+	},
+	"yellow": {
+		"50": "#fefce8", "100": "#fef9c3", "200": "#fef08a", "300": "#fde047", "400": "#facc15", "500": "#eab308",
+		"600": "#ca8a04", "700": "#a16207", "800": "#854d0e", "900": "#713f12", "950": "#422006",
+	},
+	"green": {
+		"50": "#f0fdf4", "100": "#dcfce7", "200": "#bbf7d0", "300": "#86efac", "400": "#4ade80", "500": "#22c55e",
+		"600": "#16a34a", "700": "#15803d", "800": "#166534", "900": "#14532d", "950": "#052e16",
+	},
+	"teal": {
+		"50": "#f0fdfa", "100": "#ccfbf1", "200": "#99f6e4", "300": "#5eead4", "400": "#2dd4bf", "500": "#14b8a6",
+		"600": "#0d9488", "700": "#0f766e", "800": "#115e59", "900": "#134e4a", "950": "#042f2e",
+	},
+	"blue": {
+		"50": "#eff6ff", "100": "#dbeafe", "200": "#bfdbfe", "300": "#93c5fd", "400": "#60a5fa", "500": "#3b82f6",
+		"600": "#2563eb", "700": "#1d4ed8", "800": "#1e40af", "900": "#1e3a8a", "950": "#172554",
+	},
+	"indigo": {
+		"50": "#eef2ff", "100": "#e0e7ff", "200": "#c7d2fe", "300": "#a5b4fc", "400": "#818cf8", "500": "#6366f1",
+		"600": "#4f46e5", "700": "#4338ca", "800": "#3730a3", "900": "#312e81", "950": "#1e1b4b",
+	},
+	"purple": {
+		"50": "#faf5ff", "100": "#f3e8ff", "200": "#e9d5ff", "300": "#d8b4fe", "400": "#c084fc", "500": "#a855f7",
+		"600": "#9333ea", "700": "#7e22ce", "800": "#6b21a8", "900": "#581c87", "950": "#3b0764",
+	},
+	"pink": {
+		"50": "#fdf2f8", "100": "#fce7f3", "200": "#fbcfe8", "300": "#f9a8d4", "400": "#f472b6", "500": "#ec4899",
+		"600": "#db2777", "700": "#be185d", "800": "#9d174d", "900": "#831843", "950": "#500724",
+	},
+}
+
+// fixedColors are color names without a scale
+var fixedColors = map[string]string{
+	"white":       "#fff",
+	"black":       "#000",
+	"transparent": "transparent",
+	"current":     "currentColor",
+	"inherit":     "inherit",
+}
+
+// fontSizes maps text-* sizes to a font size and line height
+var fontSizes = map[string][2]string{
+	"xs":   {"0.75rem", "1rem"},
+	"sm":   {"0.875rem", "1.25rem"},
+	"base": {"1rem", "1.5rem"},
+	"lg":   {"1.125rem", "1.75rem"},
+	"xl":   {"1.25rem", "1.75rem"},
+	"2xl":  {"1.5rem", "2rem"},
+	"3xl":  {"1.875rem", "2.25rem"},
+	"4xl":  {"2.25rem", "2.5rem"},
+	"5xl":  {"3rem", "1"},
+	"6xl":  {"3.75rem", "1"},
+	"7xl":  {"4.5rem", "1"},
+	"8xl":  {"6rem", "1"},
+	"9xl":  {"8rem", "1"},
+}
+
+var fontWeights = map[string]string{
+	"thin":       "100",
+	"extralight": "200",
+	"light":      "300",
+	"normal":     "400",
+	"medium":     "500",
+	"semibold":   "600",
+	"bold":       "700",
+	"extrabold":  "800",
+	"black":      "900",
+}
+
+var lineHeights = map[string]string{
+	"none":    "1",
+	"tight":   "1.25",
+	"snug":    "1.375",
+	"normal":  "1.5",
+	"relaxed": "1.625",
+	"loose":   "2",
+	"3":       ".75rem",
+	"4":       "1rem",
+	"5":       "1.25rem",
+	"6":       "1.5rem",
+	"7":       "1.75rem",
+	"8":       "2rem",
+	"9":       "2.25rem",
+	"10":      "2.5rem",
+}
+
+var letterSpacings = map[string]string{
+	"tighter": "-0.05em",
+	"tight":   "-0.025em",
+	"normal":  "0em",
+	"wide":    "0.025em",
+	"wider":   "0.05em",
+	"widest":  "0.1em",
+}
+
+var maxWidths = map[string]string{
+	"none":  "none",
+	"xs":    "20rem",
+	"sm":    "24rem",
+	"md":    "28rem",
+	"lg":    "32rem",
+	"xl":    "36rem",
+	"2xl":   "42rem",
+	"3xl":   "48rem",
+	"4xl":   "56rem",
+	"5xl":   "64rem",
+	"6xl":   "72rem",
+	"7xl":   "80rem",
+	"full":  "100%",
+	"prose": "65ch",
+}
+
+var radii = map[string]string{
+	"none": "0px",
+	"sm":   "0.125rem",
+	"":     "0.25rem",
+	"md":   "0.375rem",
+	"lg":   "0.5rem",
+	"xl":   "0.75rem",
+	"2xl":  "1rem",
+	"3xl":  "1.5rem",
+	"full": "9999px",
+}
+
+var shadows = map[string]string{
+	"sm":   "0 1px 2px 0 rgb(0 0 0 / 0.05)",
+	"":     "0 1px 3px 0 rgb(0 0 0 / 0.1), 0 1px 2px -1px rgb(0 0 0 / 0.1)",
+	"md":   "0 4px 6px -1px rgb(0 0 0 / 0.1), 0 2px 4px -2px rgb(0 0 0 / 0.1)",
+	"lg":   "0 10px 15px -3px rgb(0 0 0 / 0.1), 0 4px 6px -4px rgb(0 0 0 / 0.1)",
+	"xl":   "0 20px 25px -5px rgb(0 0 0 / 0.1), 0 8px 10px -6px rgb(0 0 0 / 0.1)",
+	"2xl":  "0 25px 50px -12px rgb(0 0 0 / 0.25)",
+	"none": "0 0 #0000",
+}
+
+var transitions = map[string]string{
+	"":          "color, background-color, border-color, text-decoration-color, fill, stroke, opacity, box-shadow, transform, filter, backdrop-filter",
+	"all":       "all",
+	"colors":    "color, background-color, border-color, text-decoration-color, fill, stroke",
+	"opacity":   "opacity",
+	"shadow":    "box-shadow",
+	"transform": "transform",
+}
+
+// defaultBreakpoints are the responsive prefixes and their minimum widths
+var defaultBreakpoints = map[string]string{
+	"sm":  "640px",
+	"md":  "768px",
+	"lg":  "1024px",
+	"xl":  "1280px",
+	"2xl": "1536px",
+}
+
+// preflight is a compact version of Tailwind's base reset, formatted with the
+// font stack of the page
+const preflight = `*,::before,::after{box-sizing:border-box;border-width:0;border-style:solid;border-color:#e5e7eb}` +
+	`html{line-height:1.5;-webkit-text-size-adjust:100%%;tab-size:4;font-family:%s}` +
+	`body{margin:0;line-height:inherit}` +
+	`h1,h2,h3,h4,h5,h6{font-size:inherit;font-weight:inherit}` +
+	`a{color:inherit;text-decoration:inherit}` +
+	`b,strong{font-weight:bolder}` +
+	`blockquote,dl,dd,h1,h2,h3,h4,h5,h6,hr,figure,p,pre{margin:0}` +
+	`ol,ul{list-style:none;margin:0;padding:0}` +
+	`img,svg,video,canvas,audio,iframe,embed,object{display:block;vertical-align:middle}` +
+	`img,video{max-width:100%%;height:auto}` +
+	`button,input,optgroup,select,textarea{font-family:inherit;font-size:100%%;font-weight:inherit;line-height:inherit;color:inherit;margin:0;padding:0}` +
+	`button,[type=button],[type=reset],[type=submit]{-webkit-appearance:button;background-color:transparent;background-image:none}` +
+	`[hidden]{display:none}`
+
+const defaultSansFonts = `ui-sans-serif,system-ui,sans-serif,"Apple Color Emoji","Segoe UI Emoji"`
@@ -0,0 +1,77 @@
+// Long-running tailwind compiler used by the Go CSS compiler. It reads one
+// JSON-RPC 2.0 request per line on stdin and writes one response per line to
+// stdout, so the node startup and module loading cost is paid only once.
+'use strict';
+
+const readline = require('readline');
+const postcss = require('postcss');
+const tailwindcss = require('tailwindcss');
+
+// stdout carries the protocol; anything logged by plugins goes to stderr
+console.log = console.error;
+console.info = console.error;
+
+const plugins = [];
+try {
+  plugins.push(require('@tailwindcss/typography'));
+} catch (err) {
+  console.error('typography plugin unavailable:', err.message.split('\n')[0]);
+}
+
+// Minify like `tailwindcss --minify` when a minifier is installed
+let minify = async (css) => css;
+try {
+  const cssnano = require('cssnano')({ preset: 'default' });
+  minify = async (css) => (await postcss([cssnano]).process(css, { from: undefined })).css;
+} catch (err) {
+  try {
+    const lightningcss = require('lightningcss');
+    minify = async (css) =>
+      lightningcss.transform({ filename: 'styles.css', code: Buffer.from(css), minify: true }).code.toString();
+  } catch (err) {
+    console.error('no minifier available, output is not minified');
+  }
+}
+
+const methods = {
+  ping: async () => ({ ok: true }),
+
+  compile: async (params) => {
+    const config = Object.assign({}, params.config, {
+      content: [{ raw: params.html || '', extension: 'html' }],
+      plugins,
+    });
+    const result = await postcss([tailwindcss(config)]).process(params.css || '', { from: undefined });
+    const warnings = result.warnings().map((warning) => warning.toString());
+    return { css: params.minify ? await minify(result.css) : result.css, warnings };
+  },
+};
+
+function send(message) {
+  process.stdout.write(JSON.stringify(Object.assign({ jsonrpc: '2.0' }, message)) + '\n');
+}
+
+readline
+  .createInterface({ input: process.stdin })
+  .on('line', async (line) => {
+    let request;
+    try {
+      request = JSON.parse(line);
+    } catch (err) {
+      send({ id: null, error: { code: -32700, message: 'parse error' } });
+      return;
+    }
+
+    const method = methods[request.method];
+    if (!method) {
+      send({ id: request.id, error: { code: -32601, message: `method not found: ${request.method}` } });
+      return;
+    }
+
+    try {
+      send({ id: request.id, result: await method(request.params || {}) });
+    } catch (err) {
+      send({ id: request.id, error: { code: -32000, message: String((err && err.message) || err) } });
+    }
+  })
+  .on('close', () => process.exit(0));
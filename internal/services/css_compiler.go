@@ -1,177 +1,113 @@
 package services
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
 
 	"sawthet.go-press-server.net/internal/models"
-	"sawthet.go-press-server.net/internal/services/css/shared"
+	"sawthet.go-press-server.net/internal/services/validation"
+	"sawthet.go-press-server.net/internal/utils"
 )
 
-// CSSCompiler handles the compilation of Tailwind CSS
-type CSSCompiler struct {
-	tempDir string
-}
+// Names of the CSS backends a CSSCompiler can use
+const (
+	CSSBackendTailwind = "tailwind"
+	CSSBackendGo       = "go"
+)
 
-// NewCSSCompiler creates a new CSS compiler instance
-func NewCSSCompiler() (*CSSCompiler, error) {
-	// Setup shared node modules
-	if err := shared.Setup(shared.Config{
-		NodeDir: "internal/services/css/shared",
-	}); err != nil {
-		return nil, fmt.Errorf("failed to setup shared node modules: %v", err)
-	}
+// ErrUnknownCSSBackend is returned for a backend name that is not supported
+var ErrUnknownCSSBackend = errors.New("unknown CSS backend")
 
-	tempDir, err := os.MkdirTemp("", "css-compiler-*")
-	if err != nil {
-		return nil, err
-	}
+// ErrCSSToolchain marks failures of the CSS toolchain itself, such as a
+// process that cannot start, crashes or times out, or a disk error, as opposed
+// to errors in the project's styles. Only these are worth retrying.
+var ErrCSSToolchain = errors.New("CSS toolchain failure")
 
-	return &CSSCompiler{
-		tempDir: tempDir,
-	}, nil
-}
-
-// generateTailwindConfig creates a Tailwind config file with theme values
-func (c *CSSCompiler) generateTailwindConfig(project models.Project) error {
-	configContent := fmt.Sprintf(`module.exports = {
-  content: ["./**/*.html"],
-  theme: {
-    extend: {
-      colors: {
-        primary: "%s",
-        secondary: "%s",
-        background: "%s",
-        text: "%s"
-      },
-      fontFamily: {
-        sans: ["%s", "sans-serif"]
-      },
-      fontSize: {
-        sm: "%s",
-        base: "%s",
-        lg: "%s",
-        xl: "%s",
-        "2xl": "%s"
-      },
-      spacing: {
-        sm: "%s",
-        md: "%s",
-        lg: "%s",
-        xl: "%s"
-      }
-    }
-  },
-  plugins: [
-    require('@tailwindcss/typography'),
-  ],
-}`,
-		project.GlobalConfig.Theme.Colors.Primary,
-		project.GlobalConfig.Theme.Colors.Secondary,
-		project.GlobalConfig.Theme.Colors.Background,
-		project.GlobalConfig.Theme.Colors.Text,
-		project.GlobalConfig.Theme.Typography.FontFamily,
-		project.GlobalConfig.Theme.Typography.FontSizes.Small,
-		project.GlobalConfig.Theme.Typography.FontSizes.Base,
-		project.GlobalConfig.Theme.Typography.FontSizes.Large,
-		project.GlobalConfig.Theme.Typography.FontSizes.XLarge,
-		project.GlobalConfig.Theme.Typography.FontSizes.XXLarge,
-		project.GlobalConfig.Theme.Spacing.Small,
-		project.GlobalConfig.Theme.Spacing.Medium,
-		project.GlobalConfig.Theme.Spacing.Large,
-		project.GlobalConfig.Theme.Spacing.XLarge,
-	)
-
-	configPath := filepath.Join(c.tempDir, "tailwind.config.js")
-	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
-		return fmt.Errorf("failed to create config file: %v", err)
-	}
+// Levels of the diagnostics reported by a compilation
+const (
+	DiagnosticWarn  = "warn"
+	DiagnosticError = "error"
+)
 
-	return nil
+// DiagnosticFunc receives the messages printed by the CSS toolchain during a
+// compilation, such as tailwind's warnings, one line at a time
+type DiagnosticFunc func(level, message string)
+
+// CSSBackend turns the rendered HTML of a project into its minified
+// stylesheet. Implementations must support concurrent compilations.
+type CSSBackend interface {
+	// Name identifies the backend, so output of different backends is not mixed up
+	Name() string
+	// Compile returns the stylesheet for the classes used in htmlContent,
+	// reporting what the toolchain prints along the way
+	Compile(ctx context.Context, htmlContent []byte, project models.Project, report DiagnosticFunc) ([]byte, error)
+	// Close releases the backend's processes and files
+	Close() error
 }
 
-// Compile compiles the CSS using Tailwind CSS
-func (c *CSSCompiler) Compile(htmlContent []byte, project models.Project) ([]byte, error) {
-	// Create input HTML file
-	htmlPath := filepath.Join(c.tempDir, "input.html")
-	if err := os.WriteFile(htmlPath, htmlContent, 0644); err != nil {
-		return nil, err
-	}
-
-	// Create input CSS file with Tailwind directives
-	cssPath := filepath.Join(c.tempDir, "input.css")
-	cssContent := `@tailwind base;
-@tailwind components;
-@tailwind utilities;
-
-@layer base {
-  :root {
-    --color-primary: ` + project.GlobalConfig.Theme.Colors.Primary + `;
-    --color-secondary: ` + project.GlobalConfig.Theme.Colors.Secondary + `;
-    --color-background: ` + project.GlobalConfig.Theme.Colors.Background + `;
-    --color-text: ` + project.GlobalConfig.Theme.Colors.Text + `;
-  }
+// CSSCompiler handles the compilation of the site stylesheet. A single
+// compiler is shared by all builds and delegates to the backend chosen for
+// the deployment.
+type CSSCompiler struct {
+	backend CSSBackend
 }
 
-@layer components {
-  .bg-primary { background-color: var(--color-primary); }
-  .text-primary { color: var(--color-primary); }
-  .bg-secondary { background-color: var(--color-secondary); }
-  .text-secondary { color: var(--color-secondary); }
-  .bg-background { background-color: var(--color-background); }
-  .text-text { color: var(--color-text); }
-}`
-
-	if err := os.WriteFile(cssPath, []byte(cssContent), 0644); err != nil {
-		return nil, err
-	}
-
-	// Generate Tailwind config with theme values
-	if err := c.generateTailwindConfig(project); err != nil {
-		return nil, err
-	}
+// CSSCompilerConfig configures a CSSCompiler
+type CSSCompilerConfig struct {
+	// Backend is the name of the backend; empty uses tailwind
+	Backend string
+	// Daemons is the number of long-running tailwind processes; zero runs a
+	// one-shot tailwind process for every compilation
+	Daemons int
+	// ErrorLog receives daemon failures
+	ErrorLog *utils.ColoredLogger
+}
 
-	// Copy node_modules to temp directory
-	nodeModulesPath := shared.GetNodeModulesPath("")
-	tempNodeModules := filepath.Join(c.tempDir, "node_modules")
-	if err := os.MkdirAll(tempNodeModules, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create temp node_modules: %v", err)
+// NewCSSCompiler creates a new CSS compiler instance using the configured backend
+func NewCSSCompiler(config CSSCompilerConfig) (*CSSCompiler, error) {
+	if config.ErrorLog == nil {
+		config.ErrorLog = utils.NewColoredLogger("ERROR", "\033[31m")
 	}
 
-	// Copy the entire node_modules directory
-	cmd := exec.Command("cp", "-r", nodeModulesPath+"/.", tempNodeModules)
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to copy node_modules: %v", err)
+	var backend CSSBackend
+	switch config.Backend {
+	case "", CSSBackendTailwind:
+		tailwind, err := newTailwindBackend(config)
+		if err != nil {
+			return nil, err
+		}
+		backend = tailwind
+	case CSSBackendGo:
+		backend = goBackend{}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCSSBackend, config.Backend)
 	}
 
-	// Compile CSS using local node_modules with minification
-	outputPath := filepath.Join(c.tempDir, "output.css")
-	tailwindPath := filepath.Join(tempNodeModules, "tailwindcss", "lib", "cli.js")
-	cmd = exec.Command("node", tailwindPath, "-i", "input.css", "-o", "output.css", "--content", "input.html", "--minify")
-	cmd.Dir = c.tempDir
-	cmd.Env = append(os.Environ(), "NODE_PATH="+tempNodeModules)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	return &CSSCompiler{
+		backend: backend,
+	}, nil
+}
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to compile CSS: %v\nstdout: %s\nstderr: %s", err, stdout.String(), stderr.String())
-	}
+// Backend returns the name of the compiler's backend
+func (c *CSSCompiler) Backend() string {
+	return c.backend.Name()
+}
 
-	// Read compiled CSS
-	compiledCSS, err := os.ReadFile(outputPath)
-	if err != nil {
-		return nil, err
+// Compile compiles the minified CSS for the classes used in htmlContent.
+// Theme values that fail validation are dropped before the backend sees them.
+// Diagnostics go to report, which may be nil. Cancelling ctx stops the
+// compilation.
+func (c *CSSCompiler) Compile(ctx context.Context, htmlContent []byte, project models.Project, report DiagnosticFunc) ([]byte, error) {
+	if report == nil {
+		report = func(level, message string) {}
 	}
-
-	return compiledCSS, nil
+	project.GlobalConfig.Theme = validation.SanitizeTheme(project.GlobalConfig.Theme)
+	return c.backend.Compile(ctx, htmlContent, project, report)
 }
 
-// Cleanup removes temporary files
+// Cleanup releases the backend's processes and temporary files; call it once
+// no compilation is running
 func (c *CSSCompiler) Cleanup() error {
-	return os.RemoveAll(c.tempDir)
+	return c.backend.Close()
 }
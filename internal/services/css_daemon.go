@@ -0,0 +1,328 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"sawthet.go-press-server.net/internal/utils"
+)
+
+const (
+	// daemonStartTimeout bounds how long a new daemon may take to answer its first ping
+	daemonStartTimeout = 10 * time.Second
+	// daemonHealthInterval is how often idle daemons are pinged
+	daemonHealthInterval = 30 * time.Second
+	// daemonPingTimeout bounds a health check ping
+	daemonPingTimeout = 5 * time.Second
+)
+
+// errDaemonUnavailable marks failures of the daemon process itself, as opposed
+// to errors reported by tailwind, so the compiler can fall back to one-shot mode
+var errDaemonUnavailable = fmt.Errorf("%w: tailwind daemon unavailable", ErrCSSToolchain)
+
+// rpcRequest is a JSON-RPC 2.0 request sent to a daemon
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 response read from a daemon
+type rpcResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// rpcError is an error reported by the daemon, such as a tailwind failure
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// tailwindDaemon is a node process compiling CSS over JSON-RPC on its stdin
+// and stdout. It serves one request at a time.
+type tailwindDaemon struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	nextID int
+	exited chan struct{}
+}
+
+// startTailwindDaemon starts a daemon and waits until it answers a ping. Every
+// error it returns is errDaemonUnavailable.
+func startTailwindDaemon(script, nodeModules string) (*tailwindDaemon, error) {
+	cmd := exec.Command("node", script)
+	cmd.Env = append(os.Environ(), "NODE_PATH="+nodeModules)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errDaemonUnavailable, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errDaemonUnavailable, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%w: %v", errDaemonUnavailable, err)
+	}
+
+	d := &tailwindDaemon{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+		exited: make(chan struct{}),
+	}
+	go func() {
+		cmd.Wait()
+		close(d.exited)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), daemonStartTimeout)
+	defer cancel()
+	if err := d.ping(ctx); err != nil {
+		d.kill()
+		// A daemon that does not answer in time or answers with an error
+		// is as unusable as one that does not start
+		if errors.Is(err, errDaemonUnavailable) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", errDaemonUnavailable, err)
+	}
+
+	return d, nil
+}
+
+// alive reports whether the process is still running
+func (d *tailwindDaemon) alive() bool {
+	select {
+	case <-d.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+func (d *tailwindDaemon) kill() {
+	d.stdin.Close()
+	d.cmd.Process.Kill()
+}
+
+// stop asks the daemon to exit by closing its stdin, killing it if it does not
+func (d *tailwindDaemon) stop() {
+	d.stdin.Close()
+	select {
+	case <-d.exited:
+	case <-time.After(daemonPingTimeout):
+		d.cmd.Process.Kill()
+	}
+}
+
+func (d *tailwindDaemon) ping(ctx context.Context) error {
+	return d.call(ctx, "ping", nil, nil)
+}
+
+// call sends a request and waits for its response. Cancelling ctx kills the
+// daemon, as there is no way to abort a compilation already in progress.
+func (d *tailwindDaemon) call(ctx context.Context, method string, params, result any) error {
+	d.nextID++
+	request, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: d.nextID, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if _, err := d.stdin.Write(append(request, '\n')); err != nil {
+		return fmt.Errorf("%w: %v", errDaemonUnavailable, err)
+	}
+
+	type reply struct {
+		line []byte
+		err  error
+	}
+	replies := make(chan reply, 1)
+	go func() {
+		line, err := d.stdout.ReadBytes('\n')
+		replies <- reply{line, err}
+	}()
+
+	var r reply
+	select {
+	case r = <-replies:
+	case <-ctx.Done():
+		d.kill()
+		<-replies
+		return ctx.Err()
+	}
+	if r.err != nil {
+		return fmt.Errorf("%w: %v", errDaemonUnavailable, r.err)
+	}
+
+	var response rpcResponse
+	if err := json.Unmarshal(r.line, &response); err != nil || response.ID != d.nextID {
+		// The stream is out of sync; the daemon cannot be trusted any more
+		d.kill()
+		return fmt.Errorf("%w: invalid response %q", errDaemonUnavailable, r.line)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if result != nil {
+		return json.Unmarshal(response.Result, result)
+	}
+	return nil
+}
+
+// tailwindDaemonPool keeps a fixed number of daemons. Each slot holds a
+// daemon that is replaced when it crashes or fails a health check.
+type tailwindDaemonPool struct {
+	script      string
+	nodeModules string
+	size        int
+	idle        chan *tailwindDaemon
+	done        chan struct{}
+	closeOnce   sync.Once
+	errorLog    *utils.ColoredLogger
+}
+
+// newTailwindDaemonPool starts size daemons, failing if any cannot be started
+func newTailwindDaemonPool(size int, script, nodeModules string, errorLog *utils.ColoredLogger) (*tailwindDaemonPool, error) {
+	p := &tailwindDaemonPool{
+		script:      script,
+		nodeModules: nodeModules,
+		size:        size,
+		idle:        make(chan *tailwindDaemon, size),
+		done:        make(chan struct{}),
+		errorLog:    errorLog,
+	}
+
+	for i := 0; i < size; i++ {
+		d, err := startTailwindDaemon(script, nodeModules)
+		if err != nil {
+			for len(p.idle) > 0 {
+				(<-p.idle).stop()
+			}
+			return nil, err
+		}
+		p.idle <- d
+	}
+
+	go p.healthCheck()
+
+	return p, nil
+}
+
+// compile runs a compilation on an idle daemon, restarting the daemon first
+// if it has crashed since its last use. It returns the stylesheet and the
+// warnings tailwind raised.
+func (p *tailwindDaemonPool) compile(ctx context.Context, params any) ([]byte, []string, error) {
+	var d *tailwindDaemon
+	select {
+	case d = <-p.idle:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	defer func() {
+		p.idle <- d
+	}()
+
+	if !d.alive() {
+		// The dead daemon stays in its slot, so the next compilation tries
+		// to restart it again; this one falls back to one-shot mode
+		restarted, err := startTailwindDaemon(p.script, p.nodeModules)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to restart tailwind daemon: %w", err)
+		}
+		d = restarted
+	}
+
+	var result struct {
+		CSS      string   `json:"css"`
+		Warnings []string `json:"warnings"`
+	}
+	if err := d.call(ctx, "compile", params, &result); err != nil {
+		return nil, nil, err
+	}
+	return []byte(result.CSS), result.Warnings, nil
+}
+
+// healthCheck periodically pings idle daemons and replaces unresponsive ones
+func (p *tailwindDaemonPool) healthCheck() {
+	ticker := time.NewTicker(daemonHealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		for i := 0; i < p.size; i++ {
+			if !p.checkIdle() {
+				// The remaining daemons are busy, which proves them alive
+				break
+			}
+		}
+	}
+}
+
+// checkIdle pings one idle daemon, replacing it if it does not answer. It
+// reports false when no daemon is idle.
+func (p *tailwindDaemonPool) checkIdle() bool {
+	var d *tailwindDaemon
+	select {
+	case d = <-p.idle:
+	default:
+		return false
+	}
+	defer func() {
+		p.idle <- d
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), daemonPingTimeout)
+	defer cancel()
+	if err := d.ping(ctx); err != nil {
+		p.errorLog.Printf("Tailwind daemon failed health check, restarting: %v", err)
+		d.kill()
+
+		restarted, err := startTailwindDaemon(p.script, p.nodeModules)
+		if err != nil {
+			p.errorLog.Printf("Failed to restart tailwind daemon: %v", err)
+			return true
+		}
+		d = restarted
+	}
+	return true
+}
+
+// Close stops the health checks and every daemon, waiting briefly for
+// running compilations to hand their daemons back
+func (p *tailwindDaemonPool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+
+	timeout := time.After(daemonPingTimeout)
+	for i := 0; i < p.size; i++ {
+		select {
+		case d := <-p.idle:
+			d.stop()
+		case <-timeout:
+			return
+		}
+	}
+}
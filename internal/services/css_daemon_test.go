@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/utils"
+)
+
+// fakeDaemon speaks the daemon's JSON-RPC protocol. Compilations echo the
+// HTML back, except for a few HTML values that make it misbehave.
+const fakeDaemon = `const readline = require("readline");
+
+const lines = readline.createInterface({ input: process.stdin });
+lines.on("line", (line) => {
+  const request = JSON.parse(line);
+  const reply = (body) => process.stdout.write(JSON.stringify(Object.assign({ jsonrpc: "2.0", id: request.id }, body)) + "\n");
+  if (request.method === "ping") {
+    return reply({ result: "pong" });
+  }
+  switch (request.params.html) {
+  case "crash":
+    process.exit(1);
+  case "hang":
+    return;
+  case "reject":
+    return reply({ error: { code: 1, message: "The class 'bogus' does not exist\n  at input.css:3" } });
+  }
+  reply({ result: { css: "/* daemon " + request.params.html + " */", warnings: ["checked " + request.params.html] } });
+});
+lines.on("close", () => process.exit(0));
+`
+
+// fakeCLI stands in for the tailwind CLI of one-shot compilations
+const fakeCLI = `require("fs").writeFileSync("output.css", "/* one-shot */");
+`
+
+// writeScript writes a node script to a temporary directory
+func writeScript(t *testing.T, name, source string) string {
+	t.Helper()
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("node is not installed")
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestDaemonPool starts a pool of fake daemons
+func newTestDaemonPool(t *testing.T, size int) *tailwindDaemonPool {
+	t.Helper()
+	script := writeScript(t, "daemon.js", fakeDaemon)
+	logger := utils.NewColoredLogger("TEST", "")
+	p, err := newTailwindDaemonPool(size, script, "", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+// idleDaemon takes an idle daemon from the pool; callers put it back
+func idleDaemon(t *testing.T, p *tailwindDaemonPool) *tailwindDaemon {
+	t.Helper()
+	select {
+	case d := <-p.idle:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no daemon was handed back to the pool")
+		return nil
+	}
+}
+
+// waitForExit waits until a daemon process has exited
+func waitForExit(t *testing.T, d *tailwindDaemon) {
+	t.Helper()
+	select {
+	case <-d.exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon is still running")
+	}
+}
+
+func TestDaemonPoolCompiles(t *testing.T) {
+	p := newTestDaemonPool(t, 2)
+
+	css, warnings, err := p.compile(context.Background(), map[string]any{"html": "page"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(css) != "/* daemon page */" || !reflect.DeepEqual(warnings, []string{"checked page"}) {
+		t.Errorf("compile = %q, %v", css, warnings)
+	}
+
+	// Errors reported by tailwind keep the daemon
+	_, _, err = p.compile(context.Background(), map[string]any{"html": "reject"})
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) || errors.Is(err, errDaemonUnavailable) {
+		t.Errorf("rejected compile = %v, want the daemon's error", err)
+	}
+	var daemons []*tailwindDaemon
+	for i := 0; i < p.size; i++ {
+		daemons = append(daemons, idleDaemon(t, p))
+	}
+	for _, d := range daemons {
+		if !d.alive() {
+			t.Error("daemon died after reporting an error")
+		}
+		p.idle <- d
+	}
+
+	// Requests and responses stay in step across calls
+	for _, html := range []string{"a", "b", "c"} {
+		if css, _, err := p.compile(context.Background(), map[string]any{"html": html}); err != nil || string(css) != "/* daemon "+html+" */" {
+			t.Errorf("compile %s = %q, %v", html, css, err)
+		}
+	}
+}
+
+func TestDaemonPoolRestartsCrashedDaemon(t *testing.T) {
+	p := newTestDaemonPool(t, 1)
+
+	if _, _, err := p.compile(context.Background(), map[string]any{"html": "crash"}); !errors.Is(err, errDaemonUnavailable) {
+		t.Fatalf("compile on a crashing daemon = %v, want %v", err, errDaemonUnavailable)
+	}
+	crashed := idleDaemon(t, p)
+	waitForExit(t, crashed)
+	p.idle <- crashed
+
+	// The next compilation starts a new daemon in the slot
+	css, _, err := p.compile(context.Background(), map[string]any{"html": "page"})
+	if err != nil || string(css) != "/* daemon page */" {
+		t.Fatalf("compile after a crash = %q, %v", css, err)
+	}
+	if d := idleDaemon(t, p); d == crashed || !d.alive() {
+		t.Error("crashed daemon was not replaced")
+	} else {
+		p.idle <- d
+	}
+}
+
+func TestDaemonPoolHealthCheckReplacesDeadDaemon(t *testing.T) {
+	p := newTestDaemonPool(t, 1)
+
+	d := idleDaemon(t, p)
+	d.kill()
+	waitForExit(t, d)
+	p.idle <- d
+
+	if !p.checkIdle() {
+		t.Fatal("checkIdle found no idle daemon")
+	}
+	replaced := idleDaemon(t, p)
+	if replaced == d || !replaced.alive() {
+		t.Error("health check kept the dead daemon")
+	}
+	p.idle <- replaced
+
+	// A busy pool is left alone
+	busy := idleDaemon(t, p)
+	if p.checkIdle() {
+		t.Error("checkIdle reported an idle daemon while all were busy")
+	}
+	p.idle <- busy
+}
+
+func TestDaemonCallKillsDaemonOnCancel(t *testing.T) {
+	p := newTestDaemonPool(t, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := p.compile(ctx, map[string]any{"html": "hang"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("cancelled compile = %v, want %v", err, context.DeadlineExceeded)
+	}
+	d := idleDaemon(t, p)
+	waitForExit(t, d)
+	p.idle <- d
+
+	// The killed daemon is restarted by the next compilation
+	if css, _, err := p.compile(context.Background(), map[string]any{"html": "page"}); err != nil || string(css) != "/* daemon page */" {
+		t.Errorf("compile after cancelling = %q, %v", css, err)
+	}
+}
+
+func TestDaemonPoolFailsToStart(t *testing.T) {
+	script := writeScript(t, "daemon.js", `process.exit(1);`)
+	logger := utils.NewColoredLogger("TEST", "")
+	if _, err := newTailwindDaemonPool(2, script, "", logger); !errors.Is(err, errDaemonUnavailable) {
+		t.Errorf("pool of exiting daemons = %v, want %v", err, errDaemonUnavailable)
+	}
+}
+
+func TestTailwindBackendDaemonFailures(t *testing.T) {
+	p := newTestDaemonPool(t, 1)
+	b := &tailwindBackend{
+		tempDir:     t.TempDir(),
+		tailwindCLI: writeScript(t, "cli.js", fakeCLI),
+		daemons:     p,
+		errorLog:    utils.NewColoredLogger("TEST", ""),
+	}
+
+	tests := []struct {
+		html        string
+		css         string
+		diagnostics []string
+		err         string
+	}{
+		{html: "page", css: "/* daemon page */", diagnostics: []string{"warn checked page"}},
+		// A daemon that crashes hands the compilation over to one-shot mode
+		{html: "crash", css: "/* one-shot */"},
+		// Errors in the project are reported and not retried in one-shot mode
+		{
+			html:        "reject",
+			diagnostics: []string{"error The class 'bogus' does not exist", "error at input.css:3"},
+			err:         "failed to compile CSS: The class 'bogus' does not exist",
+		},
+	}
+	for _, tt := range tests {
+		var diagnostics []string
+		css, err := b.Compile(context.Background(), []byte(tt.html), models.Project{}, func(level, message string) {
+			diagnostics = append(diagnostics, level+" "+message)
+		})
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) || errors.Is(err, ErrCSSToolchain) {
+				t.Errorf("%s: error = %v, want %q that is not a toolchain failure", tt.html, err, tt.err)
+			}
+		} else if err != nil || string(css) != tt.css {
+			t.Errorf("%s: Compile = %q, %v; want %q", tt.html, css, err, tt.css)
+		}
+		if !reflect.DeepEqual(diagnostics, tt.diagnostics) {
+			t.Errorf("%s: diagnostics = %q, want %q", tt.html, diagnostics, tt.diagnostics)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package services
+
+import (
+	"context"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/services/css/gocss"
+)
+
+// goBackend generates the stylesheet in process with gocss, so deployments
+// without node can build sites. It supports the utilities used by the
+// templates and editor rather than all of Tailwind.
+type goBackend struct{}
+
+func (goBackend) Name() string { return CSSBackendGo }
+
+func (goBackend) Compile(ctx context.Context, htmlContent []byte, project models.Project, report DiagnosticFunc) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return gocss.Generate(htmlContent, project.GlobalConfig.Theme), nil
+}
+
+func (goBackend) Close() error { return nil }
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/services/css/shared"
+	"sawthet.go-press-server.net/internal/utils"
+)
+
+// tailwindBackend compiles CSS with Tailwind on node. Compilations go to a
+// pool of long-running tailwind daemons when one is configured; otherwise, or
+// when the daemons fail, each compilation runs the shared tailwind
+// installation once in its own working directory. Either way compilations can
+// run concurrently.
+type tailwindBackend struct {
+	tempDir     string
+	nodeModules string
+	tailwindCLI string
+	daemons     *tailwindDaemonPool
+	errorLog    *utils.ColoredLogger
+}
+
+// newTailwindBackend installs the shared node modules and starts the daemons.
+// If the daemons cannot be started the backend falls back to one-shot mode.
+func newTailwindBackend(config CSSCompilerConfig) (*tailwindBackend, error) {
+	// Setup shared node modules
+	if err := shared.Setup(shared.Config{
+		NodeDir: "internal/services/css/shared",
+	}); err != nil {
+		return nil, fmt.Errorf("failed to setup shared node modules: %v", err)
+	}
+
+	// Working directories change per compilation, so the installation is
+	// referenced by absolute path
+	nodeModules, err := filepath.Abs(shared.GetNodeModulesPath(""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve node_modules: %v", err)
+	}
+
+	tempDir, err := os.MkdirTemp("", "css-compiler-*")
+	if err != nil {
+		return nil, err
+	}
+
+	b := &tailwindBackend{
+		tempDir:     tempDir,
+		nodeModules: nodeModules,
+		tailwindCLI: filepath.Join(nodeModules, "tailwindcss", "lib", "cli.js"),
+		errorLog:    config.ErrorLog,
+	}
+
+	if config.Daemons > 0 {
+		script := filepath.Join(filepath.Dir(nodeModules), "tailwind-daemon.js")
+		b.daemons, err = newTailwindDaemonPool(config.Daemons, script, nodeModules, config.ErrorLog)
+		if err != nil {
+			b.errorLog.Printf("Failed to start tailwind daemons, compiling in one-shot mode: %v", err)
+		}
+	}
+
+	return b, nil
+}
+
+func (b *tailwindBackend) Name() string { return CSSBackendTailwind }
+
+// tailwindConfigShim is the tailwind.config.js of every one-shot compilation.
+// It loads the project's settings from theme.json as data, so theme values
+// are never spliced into JavaScript.
+const tailwindConfigShim = `const config = require("./theme.json");
+
+module.exports = Object.assign({}, config, {
+  content: ["./**/*.html"],
+  plugins: [require("@tailwindcss/typography")],
+});
+`
+
+// generateTailwindConfig writes the Tailwind config shim and the project's
+// theme.json to dir
+func (b *tailwindBackend) generateTailwindConfig(dir string, project models.Project) error {
+	config, err := json.MarshalIndent(tailwindConfig(project), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "theme.json"), config, 0644); err != nil {
+		return fmt.Errorf("failed to write theme: %v", err)
+	}
+
+	configPath := filepath.Join(dir, "tailwind.config.js")
+	if err := os.WriteFile(configPath, []byte(tailwindConfigShim), 0644); err != nil {
+		return fmt.Errorf("failed to create config file: %v", err)
+	}
+
+	return nil
+}
+
+// inputCSS returns the Tailwind entry stylesheet for a project. Every theme
+// token is declared as a custom property, which the Tailwind config refers to.
+func inputCSS(project models.Project) string {
+	theme := project.GlobalConfig.Theme
+
+	var css strings.Builder
+	css.WriteString(`@tailwind base;
+@tailwind components;
+@tailwind utilities;
+
+@layer base {
+  :root {
+`)
+	writeProperties(&css, theme.Properties(), "    ")
+	css.WriteString("  }\n")
+
+	switch theme.DarkMode() {
+	case models.DarkModeMedia:
+		css.WriteString("  @media (prefers-color-scheme: dark) {\n    :root {\n")
+		writeProperties(&css, theme.DarkProperties(), "      ")
+		css.WriteString("    }\n  }\n")
+	case models.DarkModeClass:
+		css.WriteString("  .dark {\n")
+		writeProperties(&css, theme.DarkProperties(), "    ")
+		css.WriteString("  }\n")
+	}
+
+	css.WriteString(`}
+
+@layer components {
+  .bg-primary { background-color: var(--color-primary); }
+  .text-primary { color: var(--color-primary); }
+  .bg-secondary { background-color: var(--color-secondary); }
+  .text-secondary { color: var(--color-secondary); }
+  .bg-background { background-color: var(--color-background); }
+  .text-text { color: var(--color-text); }
+}`)
+	return css.String()
+}
+
+func writeProperties(css *strings.Builder, props []models.Property, indent string) {
+	for _, prop := range props {
+		css.WriteString(indent + prop.Name + ": " + prop.Value + ";\n")
+	}
+}
+
+// tailwindConfig returns the Tailwind config for a project, without content
+// and plugins. Colors refer to the custom properties declared by inputCSS so
+// that dark mode only has to override the properties.
+func tailwindConfig(project models.Project) map[string]any {
+	theme := project.GlobalConfig.Theme
+
+	colors := map[string]any{}
+	for _, name := range []string{"primary", "secondary", "background", "text"} {
+		colors[name] = "var(" + models.ColorProperty(name, "") + ")"
+	}
+	for name, scale := range theme.Palettes {
+		shades := map[string]string{}
+		for shade := range scale {
+			shades[shade] = "var(" + models.ColorProperty(name, shade) + ")"
+		}
+		colors[name] = shades
+	}
+
+	fontFamily := map[string][]string{}
+	for name, families := range theme.Typography.FontFamilies {
+		fontFamily[name] = families
+	}
+	if _, ok := fontFamily["sans"]; !ok && theme.Typography.FontFamily != "" {
+		fontFamily["sans"] = []string{theme.Typography.FontFamily, "sans-serif"}
+	}
+
+	extend := map[string]any{
+		"colors":     colors,
+		"fontFamily": fontFamily,
+		"fontSize": nonEmpty(map[string]string{
+			"sm":   theme.Typography.FontSizes.Small,
+			"base": theme.Typography.FontSizes.Base,
+			"lg":   theme.Typography.FontSizes.Large,
+			"xl":   theme.Typography.FontSizes.XLarge,
+			"2xl":  theme.Typography.FontSizes.XXLarge,
+		}),
+		"spacing": nonEmpty(map[string]string{
+			"sm": theme.Spacing.Small,
+			"md": theme.Spacing.Medium,
+			"lg": theme.Spacing.Large,
+			"xl": theme.Spacing.XLarge,
+		}),
+		"lineHeight":   nonEmpty(theme.Typography.LineHeights),
+		"borderRadius": nonEmpty(theme.Radii),
+		"boxShadow":    nonEmpty(theme.Shadows),
+		"screens":      nonEmpty(theme.Breakpoints),
+	}
+
+	config := map[string]any{
+		"theme": map[string]any{"extend": extend},
+	}
+	if mode := theme.DarkMode(); mode != "" {
+		config["darkMode"] = mode
+	}
+	return config
+}
+
+// nonEmpty returns the entries of tokens that have a value
+func nonEmpty(tokens map[string]string) map[string]string {
+	values := make(map[string]string, len(tokens))
+	for name, value := range tokens {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// Compile compiles the CSS using Tailwind CSS. Cancelling ctx stops the
+// running tailwind process.
+func (b *tailwindBackend) Compile(ctx context.Context, htmlContent []byte, project models.Project, report DiagnosticFunc) ([]byte, error) {
+	if b.daemons != nil {
+		css, warnings, err := b.daemons.compile(ctx, map[string]any{
+			"css":    inputCSS(project),
+			"html":   string(htmlContent),
+			"config": tailwindConfig(project),
+			"minify": true,
+		})
+		switch {
+		case err == nil:
+			for _, warning := range warnings {
+				report(DiagnosticWarn, warning)
+			}
+			return css, nil
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case !errors.Is(err, errDaemonUnavailable):
+			// Tailwind rejected the project's styles or config, as a
+			// one-shot process exiting with status 1 does
+			return nil, compileFailure(err, err.Error(), report)
+		}
+		b.errorLog.Printf("Tailwind daemon failed, compiling in one-shot mode: %v", err)
+	}
+
+	return b.compileOnce(ctx, htmlContent, project, report)
+}
+
+// compileOnce runs a one-shot tailwind process in a fresh working directory
+func (b *tailwindBackend) compileOnce(ctx context.Context, htmlContent []byte, project models.Project, report DiagnosticFunc) ([]byte, error) {
+	// Give the compilation its own working directory
+	workDir, err := os.MkdirTemp(b.tempDir, "build-*")
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create working directory: %v", ErrCSSToolchain, err)
+	}
+	defer os.RemoveAll(workDir)
+
+	// Create input HTML file
+	htmlPath := filepath.Join(workDir, "input.html")
+	if err := os.WriteFile(htmlPath, htmlContent, 0644); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCSSToolchain, err)
+	}
+
+	// Create input CSS file with Tailwind directives
+	cssPath := filepath.Join(workDir, "input.css")
+	cssContent := inputCSS(project)
+
+	if err := os.WriteFile(cssPath, []byte(cssContent), 0644); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCSSToolchain, err)
+	}
+
+	// Generate Tailwind config with theme values
+	if err := b.generateTailwindConfig(workDir, project); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCSSToolchain, err)
+	}
+
+	// Compile CSS using the shared node_modules with minification; NODE_PATH
+	// lets the config's require() calls resolve outside the working directory
+	outputPath := filepath.Join(workDir, "output.css")
+	cmd := exec.CommandContext(ctx, "node", b.tailwindCLI, "-i", "input.css", "-o", "output.css", "--content", "input.html", "--minify")
+	cmd.Dir = workDir
+	cmd.Env = append(os.Environ(), "NODE_PATH="+b.nodeModules)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// Tailwind exits with status 1 when it rejects the project's styles
+		// or config; anything else, such as node failing to start or being
+		// killed, is a failure of the toolchain
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			err = fmt.Errorf("%w: %v", ErrCSSToolchain, err)
+		}
+		return nil, compileFailure(err, stderr.String()+stdout.String(), report)
+	}
+	for _, line := range diagnosticLines(stderr.String()) {
+		report(DiagnosticWarn, line)
+	}
+
+	// Read compiled CSS
+	compiledCSS, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCSSToolchain, err)
+	}
+
+	return compiledCSS, nil
+}
+
+// compileFailure reports the toolchain's output for a failed compilation
+// line by line and wraps err, keeping the line that explains the failure
+func compileFailure(err error, output string, report DiagnosticFunc) error {
+	lines := diagnosticLines(output)
+	for _, line := range lines {
+		report(DiagnosticError, line)
+	}
+	if len(lines) > 0 && !strings.Contains(err.Error(), lines[0]) {
+		return fmt.Errorf("failed to compile CSS: %w: %s", err, lines[0])
+	}
+	return fmt.Errorf("failed to compile CSS: %w", err)
+}
+
+// maxDiagnosticLines bounds the lines reported for one compilation, as a
+// failing node process may print a long stack trace
+const maxDiagnosticLines = 50
+
+// diagnosticLines splits the output of the tailwind CLI into the lines worth
+// reporting, leaving out blank lines and its progress messages
+func diagnosticLines(output string) []string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == "Rebuilding..." || strings.HasPrefix(line, "Done in ") {
+			continue
+		}
+		if len(lines) == maxDiagnosticLines {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Close stops the daemons and removes temporary files
+func (b *tailwindBackend) Close() error {
+	if b.daemons != nil {
+		b.daemons.Close()
+	}
+	return os.RemoveAll(b.tempDir)
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/models/modelstest"
+)
+
+// recordingBackend keeps the project of the last compilation
+type recordingBackend struct {
+	project models.Project
+}
+
+func (b *recordingBackend) Name() string { return "recording" }
+
+func (b *recordingBackend) Compile(ctx context.Context, htmlContent []byte, project models.Project, report DiagnosticFunc) ([]byte, error) {
+	b.project = project
+	return nil, nil
+}
+
+func (b *recordingBackend) Close() error { return nil }
+
+func TestTailwindOutputNeutralisesHostileTheme(t *testing.T) {
+	tests := []struct {
+		value string
+		// forbidden must not appear in the generated CSS or config
+		forbidden []string
+	}{
+		{`red; } body { display: none`, []string{"display: none"}},
+		{`red"`, []string{`red"`, `red\"`}},
+		{`'red'`, []string{`'red'`}},
+		{`red}`, []string{"red}"}},
+		{`{red`, []string{"{red"}},
+		{`red;`, []string{"red;"}},
+		{`red</style><script>alert(1)</script>`, []string{"</style", "<script", `\u003c/style`, `\u003cscript`}},
+		{`url(javascript:alert(1))`, []string{"url(", "javascript"}},
+		{`expression(alert(1))`, []string{"expression("}},
+		{"red\n}", []string{"red\n", `red\n`}},
+		{`\72 ed`, []string{`\72`, `\\72`}},
+		{`red\`, []string{`red\`}},
+		{`0 1px 2px red; }`, []string{"red; }"}},
+	}
+
+	backend := &recordingBackend{}
+	compiler := &CSSCompiler{backend: backend}
+
+	for _, tt := range tests {
+		project := models.Project{ID: "p"}
+		// A valid dark mode has the hostile dark colors written too
+		project.GlobalConfig.Theme = modelstest.HostileTheme(tt.value)
+		project.GlobalConfig.Theme.Dark.Mode = models.DarkModeClass
+		if _, err := compiler.Compile(context.Background(), nil, project, nil); err != nil {
+			t.Fatalf("Compile: %v", err)
+		}
+
+		dir := t.TempDir()
+		b := &tailwindBackend{}
+		if err := b.generateTailwindConfig(dir, backend.project); err != nil {
+			t.Fatalf("generateTailwindConfig: %v", err)
+		}
+		themeJSON, err := os.ReadFile(filepath.Join(dir, "theme.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !json.Valid(themeJSON) {
+			t.Errorf("theme.json for %q is not valid JSON: %s", tt.value, themeJSON)
+		}
+		shim, err := os.ReadFile(filepath.Join(dir, "tailwind.config.js"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(shim) != tailwindConfigShim {
+			t.Errorf("tailwind.config.js for %q is not the fixed shim:\n%s", tt.value, shim)
+		}
+
+		css := inputCSS(backend.project)
+		for _, output := range []struct {
+			name    string
+			content string
+		}{
+			{"input.css", css},
+			{"theme.json", string(themeJSON)},
+		} {
+			for _, forbidden := range append(tt.forbidden, tt.value) {
+				if strings.Contains(output.content, forbidden) {
+					t.Errorf("%s for theme value %q contains %q:\n%s", output.name, tt.value, forbidden, output.content)
+				}
+			}
+		}
+
+		// Every declaration must stay on its own line inside the root rules
+		if strings.Count(css, "{") != strings.Count(css, "}") {
+			t.Errorf("input.css for %q has unbalanced braces:\n%s", tt.value, css)
+		}
+	}
+}
+
+func TestTailwindOutputKeepsValidTheme(t *testing.T) {
+	project := models.Project{ID: "p"}
+	project.GlobalConfig.Theme = models.Theme{
+		Colors:     models.Colors{Primary: "#3b82f6"},
+		Typography: models.Typography{FontFamily: "Inter, sans-serif"},
+		Shadows:    map[string]string{"md": "0 1px 2px #0000001a"},
+	}
+
+	backend := &recordingBackend{}
+	if _, err := (&CSSCompiler{backend: backend}).Compile(context.Background(), nil, project, nil); err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	css := inputCSS(backend.project)
+	for _, want := range []string{"--color-primary: #3b82f6;", "0 1px 2px #0000001a"} {
+		if !strings.Contains(css, want) {
+			t.Errorf("input.css does not contain %q:\n%s", want, css)
+		}
+	}
+
+	config, err := json.Marshal(tailwindConfig(backend.project))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(config), `"Inter, sans-serif"`) {
+		t.Errorf("config does not keep the font family: %s", config)
+	}
+}
@@ -0,0 +1,108 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	jobsBucket = []byte("jobs")
+	// corruptJobsBucket holds the records set aside because they cannot be decoded
+	corruptJobsBucket = []byte("jobs" + corruptSuffix)
+)
+
+// BoltJobStore keeps job records in an embedded BoltDB database
+type BoltJobStore struct {
+	db *bolt.DB
+}
+
+// NewBoltJobStore opens (or creates) the database file at path
+func NewBoltJobStore(path string) (*BoltJobStore, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job database: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{jobsBucket, corruptJobsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create jobs buckets: %v", err)
+	}
+
+	return &BoltJobStore{
+		db: db,
+	}, nil
+}
+
+func (s *BoltJobStore) Save(record JobRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %w", record.ID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(record.ID), data)
+	})
+}
+
+func (s *BoltJobStore) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Delete([]byte(id))
+	})
+}
+
+func (s *BoltJobStore) LoadAll() ([]JobRecord, error) {
+	var records []JobRecord
+	var corrupt []error
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		jobs := tx.Bucket(jobsBucket)
+		var bad [][]byte
+		err := jobs.ForEach(func(k, v []byte) error {
+			var record JobRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				// Keys are only valid until the bucket is modified
+				bad = append(bad, append([]byte(nil), k...))
+				corrupt = append(corrupt, fmt.Errorf("%w %s: %v", ErrCorruptJob, k, err))
+				return nil
+			}
+			records = append(records, record)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Keep corrupt records for inspection in a bucket that is not loaded
+		for _, k := range bad {
+			v := append([]byte(nil), jobs.Get(k)...)
+			if err := tx.Bucket(corruptJobsBucket).Put(k, v); err != nil {
+				return err
+			}
+			if err := jobs.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, errors.Join(corrupt...)
+}
+
+func (s *BoltJobStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,156 @@
+package job
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/utils"
+)
+
+// errInvalidCacheID is returned for a project ID that cannot name a cache
+// directory
+var errInvalidCacheID = errors.New("invalid project ID for build cache")
+
+// Kinds of cached build output
+const (
+	cachePages = "pages"
+	cacheCSS   = "css"
+)
+
+// BuildCache keeps the output of a project's last build, keyed by content
+// hashes, so unchanged pages and stylesheets can be reused by the next build.
+// A nil *BuildCache is valid and caches nothing.
+type BuildCache struct {
+	dir string
+	mux sync.RWMutex
+}
+
+// NewBuildCache creates a build cache rooted at dir
+func NewBuildCache(dir string) (*BuildCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create build cache directory: %v", err)
+	}
+
+	return &BuildCache{
+		dir: dir,
+	}, nil
+}
+
+func (c *BuildCache) path(projectID, kind, key string) string {
+	return filepath.Join(c.dir, projectID, kind, key)
+}
+
+// Get returns cached output, reporting false on a miss
+func (c *BuildCache) Get(projectID, kind, key string) ([]byte, bool) {
+	if c == nil || !utils.ValidID(projectID) {
+		return nil, false
+	}
+
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	data, err := os.ReadFile(c.path(projectID, kind, key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Put stores output under its key
+func (c *BuildCache) Put(projectID, kind, key string, data []byte) error {
+	if c == nil {
+		return nil
+	}
+	if !utils.ValidID(projectID) {
+		return fmt.Errorf("%w: %q", errInvalidCacheID, projectID)
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	path := c.path(projectID, kind, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(path, data)
+}
+
+// Retain drops every cached entry of a project that is not in keep, which
+// maps each kind to the keys used by the build that just finished
+func (c *BuildCache) Retain(projectID string, keep map[string]map[string]bool) error {
+	if c == nil {
+		return nil
+	}
+	if !utils.ValidID(projectID) {
+		return fmt.Errorf("%w: %q", errInvalidCacheID, projectID)
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	root := filepath.Join(c.dir, projectID)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		kind := filepath.Base(filepath.Dir(path))
+		if keep[kind][entry.Name()] {
+			return nil
+		}
+		return os.Remove(path)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// SharedHash hashes everything besides the page itself that ends up in a
+// rendered page: the project's name, theme, header and footer, the template
+// sources, the year printed in the footer and whether it is a draft
+func SharedHash(project models.Project, templates string, draft bool) string {
+	return hashJSON(struct {
+		Name         string                  `json:"name"`
+		Description  string                  `json:"description"`
+		GlobalConfig models.GlobalConfig     `json:"globalConfig"`
+		Header       models.ComponentWrapper `json:"header"`
+		Footer       models.ComponentWrapper `json:"footer"`
+		Templates    string                  `json:"templates"`
+		Year         int                     `json:"year"`
+		Draft        bool                    `json:"draft"`
+	}{
+		Name:         project.Name,
+		Description:  project.Description,
+		GlobalConfig: project.GlobalConfig,
+		Header:       project.Header,
+		Footer:       project.Footer,
+		Templates:    templates,
+		Year:         time.Now().Year(),
+		Draft:        draft,
+	})
+}
+
+// PageHash hashes a page together with the shared hash of its project
+func PageHash(page models.Page, shared string) string {
+	return hashJSON(struct {
+		Shared string      `json:"shared"`
+		Page   models.Page `json:"page"`
+	}{shared, page})
+}
+
+func hashJSON(value any) string {
+	// Marshalling plain models cannot fail
+	data, _ := json.Marshal(value)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
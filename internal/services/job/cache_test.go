@@ -0,0 +1,227 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/services"
+)
+
+func TestBuildCache(t *testing.T) {
+	var disabled *BuildCache
+	if err := disabled.Put("site", cachePages, "k", []byte("x")); err != nil {
+		t.Errorf("nil cache Put: %v", err)
+	}
+	if _, ok := disabled.Get("site", cachePages, "k"); ok {
+		t.Error("nil cache Get hit")
+	}
+	if err := disabled.Retain("site", nil); err != nil {
+		t.Errorf("nil cache Retain: %v", err)
+	}
+
+	c, err := NewBuildCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("site", cachePages, "k"); ok {
+		t.Error("empty cache Get hit")
+	}
+	if err := c.Put("site", cachePages, "k", []byte("<p>home</p>")); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := c.Get("site", cachePages, "k"); !ok || string(data) != "<p>home</p>" {
+		t.Errorf("Get = %q, %t", data, ok)
+	}
+	if _, ok := c.Get("other", cachePages, "k"); ok {
+		t.Error("Get hit the entry of another project")
+	}
+
+	// IDs that could escape the cache directory are refused
+	for _, id := range []string{"", "../site", "a/b", "."} {
+		if err := c.Put(id, cachePages, "k", nil); !errors.Is(err, errInvalidCacheID) {
+			t.Errorf("Put(%q) = %v, want %v", id, err, errInvalidCacheID)
+		}
+		if _, ok := c.Get(id, cachePages, "k"); ok {
+			t.Errorf("Get(%q) hit", id)
+		}
+		if err := c.Retain(id, nil); !errors.Is(err, errInvalidCacheID) {
+			t.Errorf("Retain(%q) = %v, want %v", id, err, errInvalidCacheID)
+		}
+	}
+}
+
+func TestBuildCacheRetain(t *testing.T) {
+	c, err := NewBuildCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []struct{ project, kind, key string }{
+		{"site", cachePages, "a"},
+		{"site", cachePages, "b"},
+		{"site", cacheCSS, "a"},
+		{"site", cacheCSS, "c"},
+		{"other", cachePages, "b"},
+	}
+	for _, e := range entries {
+		if err := c.Put(e.project, e.kind, e.key, []byte(e.key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Keys are kept per kind
+	keep := map[string]map[string]bool{
+		cachePages: {"a": true},
+		cacheCSS:   {"c": true},
+	}
+	if err := c.Retain("site", keep); err != nil {
+		t.Fatal(err)
+	}
+	want := []bool{true, false, false, true, true}
+	for i, e := range entries {
+		if _, ok := c.Get(e.project, e.kind, e.key); ok != want[i] {
+			t.Errorf("%s %s %s cached = %t, want %t", e.project, e.kind, e.key, ok, want[i])
+		}
+	}
+
+	// A project without cached output has nothing to prune
+	if err := c.Retain("new", keep); err != nil {
+		t.Errorf("Retain of an uncached project: %v", err)
+	}
+}
+
+func TestHashes(t *testing.T) {
+	project := models.Project{
+		Name:  "Site",
+		Pages: []models.Page{{ID: "home", Title: "Home", Slug: "/"}},
+	}
+	shared := SharedHash(project, "templates", false)
+	page := PageHash(project.Pages[0], shared)
+
+	if SharedHash(project, "templates", false) != shared || PageHash(project.Pages[0], shared) != page {
+		t.Error("hashes of the same input differ")
+	}
+	if len(shared) != 64 || len(page) != 64 {
+		t.Errorf("hashes %q and %q are not SHA-256 hex digests", shared, page)
+	}
+
+	// Everything a page's HTML depends on changes its hash
+	changes := map[string]func(p *models.Project) (string, bool){
+		"name": func(p *models.Project) (string, bool) { p.Name = "Renamed"; return "templates", false },
+		"theme": func(p *models.Project) (string, bool) {
+			p.GlobalConfig.Theme.Colors.Primary = "red"
+			return "templates", false
+		},
+		"header":    func(p *models.Project) (string, bool) { p.Header.Component = text("nav"); return "templates", false },
+		"templates": func(p *models.Project) (string, bool) { return "edited", false },
+		"draft":     func(p *models.Project) (string, bool) { return "templates", true },
+		"page":      func(p *models.Project) (string, bool) { p.Pages[0].Title = "Welcome"; return "templates", false },
+	}
+	for name, change := range changes {
+		changed := project
+		changed.Pages = append([]models.Page(nil), project.Pages...)
+		templates, draft := change(&changed)
+		if PageHash(changed.Pages[0], SharedHash(changed, templates, draft)) == page {
+			t.Errorf("changing the %s keeps the page hash", name)
+		}
+	}
+
+	// Other pages do not affect a page's hash
+	other := project
+	other.Pages = append(other.Pages, models.Page{ID: "about", Title: "About", Slug: "/about"})
+	if PageHash(other.Pages[0], SharedHash(other, "templates", false)) != page {
+		t.Error("adding a page changes the hash of another")
+	}
+}
+
+// text returns a text component showing its ID
+func text(id string) *models.TextComponent {
+	return &models.TextComponent{BaseComponent: models.BaseComponent{Type: "text", ID: id, Content: id}}
+}
+
+// templateService parses the templates, which are looked up relative to the
+// repository root
+func templateService(t *testing.T) *services.TemplateService {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("../../.."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	templates, err := services.NewTemplateService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return templates
+}
+
+func TestRenderStageReusesUnchangedPages(t *testing.T) {
+	cache, err := NewBuildCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stage := RenderStage{Templates: templateService(t), Workers: 2}
+	project := models.Project{
+		ID:     "site",
+		Name:   "Site",
+		Header: models.ComponentWrapper{Component: &models.HeaderComponent{BaseComponent: models.BaseComponent{Type: "header"}}},
+		Footer: models.ComponentWrapper{Component: &models.FooterComponent{BaseComponent: models.BaseComponent{Type: "footer"}}},
+		Pages: []models.Page{
+			{ID: "home", Title: "Home", Slug: "/", Components: []models.ComponentWrapper{{Component: text("welcome")}}},
+			{ID: "about", Title: "About", Slug: "/about", Components: []models.ComponentWrapper{{Component: text("team")}}},
+		},
+	}
+
+	// build renders the project and keeps only the cache entries it used
+	build := func(project models.Project) *Build {
+		t.Helper()
+		b := &Build{Project: project, Cache: cache}
+		if err := stage.Run(context.Background(), b, func(int, string) {}); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.RetainCache(); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	first := build(project)
+	if !reflect.DeepEqual(first.Report, PageReport{Rebuilt: []string{"index.html", "about.html"}, Reused: []string{}}) {
+		t.Errorf("first build report = %+v", first.Report)
+	}
+
+	again := build(project)
+	if !reflect.DeepEqual(again.Report, PageReport{Rebuilt: []string{}, Reused: []string{"index.html", "about.html"}}) {
+		t.Errorf("unchanged build report = %+v", again.Report)
+	}
+	if !reflect.DeepEqual(again.Pages, first.Pages) {
+		t.Error("reused pages differ from the rendered ones")
+	}
+
+	edited := project
+	edited.Pages = []models.Page{project.Pages[0], project.Pages[1]}
+	edited.Pages[1].Title = "Team"
+	third := build(edited)
+	if !reflect.DeepEqual(third.Report, PageReport{Rebuilt: []string{"about.html"}, Reused: []string{"index.html"}}) {
+		t.Errorf("edited build report = %+v", third.Report)
+	}
+
+	// Changing what all pages share rebuilds every page, and the cache only
+	// keeps the output of the latest build
+	renamed := edited
+	renamed.Name = "Renamed"
+	fourth := build(renamed)
+	if len(fourth.Report.Rebuilt) != 2 {
+		t.Errorf("renamed build report = %+v", fourth.Report)
+	}
+	if older := build(edited); len(older.Report.Reused) != 0 {
+		t.Errorf("output of an older build was reused: %+v", older.Report)
+	}
+}
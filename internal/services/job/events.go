@@ -0,0 +1,80 @@
+package job
+
+// Event is an event of a job as streamed to clients: a progress update or,
+// when Log is set, a line of the job's build log
+type Event struct {
+	JobID     string `json:"jobId"`
+	ProjectID string `json:"projectId"`
+	ProgressUpdate
+	Log *LogEntry `json:"-"`
+}
+
+// maxJobEvents bounds the history kept per job; the oldest events are
+// dropped first, while sequence numbers keep counting
+const maxJobEvents = 10000
+
+// addEvent numbers an update, appends it to the job's history and returns
+// it; callers must hold jobsMux
+func (job *BuildJob) addEvent(update ProgressUpdate) ProgressUpdate {
+	update.Seq = 1
+	if n := len(job.Events); n > 0 {
+		update.Seq = job.Events[n-1].Seq + 1
+	}
+
+	// Events are never modified once added, so appending in place is safe
+	// for snapshots sharing the slice: they never look past their length
+	if len(job.Events) >= maxJobEvents {
+		job.Events = job.Events[len(job.Events)-maxJobEvents+1:]
+	}
+	job.Events = append(job.Events, update)
+	return update
+}
+
+// event tags an update with the job it belongs to
+func (job *BuildJob) event(update ProgressUpdate) Event {
+	return Event{JobID: job.ID, ProjectID: job.ProjectID, ProgressUpdate: update}
+}
+
+// logEvent tags a log line with the job it belongs to
+func (job *BuildJob) logEvent(entry LogEntry) Event {
+	return Event{JobID: job.ID, ProjectID: job.ProjectID, Log: &entry}
+}
+
+// startEvents returns the events a client should be sent first: when
+// resuming, the events after sequence number since; otherwise the job's
+// current state. Callers must hold jobsMux.
+func (job *BuildJob) startEvents(since uint64, resume bool) []Event {
+	var updates []ProgressUpdate
+	switch {
+	case resume:
+		updates = job.eventsSince(since)
+	case len(job.Events) > 0:
+		updates = job.Events[len(job.Events)-1:]
+	default:
+		// Jobs recorded before events were kept only have their state
+		updates = []ProgressUpdate{{
+			Status:   job.Status,
+			Progress: job.Progress,
+			Message:  job.Message,
+			Attempt:  job.Attempt,
+			At:       job.UpdatedAt,
+		}}
+	}
+
+	events := make([]Event, len(updates))
+	for i, update := range updates {
+		events[i] = job.event(update)
+	}
+	return events
+}
+
+// eventsSince returns the events with a sequence number above since;
+// callers must hold jobsMux
+func (job *BuildJob) eventsSince(since uint64) []ProgressUpdate {
+	for i, event := range job.Events {
+		if event.Seq > since {
+			return append([]ProgressUpdate(nil), job.Events[i:]...)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package job
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/utils"
+)
+
+// jobWithEvents returns a job whose history holds n events
+func jobWithEvents(n int) *BuildJob {
+	job := &BuildJob{ID: "j", ProjectID: "p", Status: StatusRunning}
+	for i := 0; i < n; i++ {
+		job.addEvent(ProgressUpdate{Status: StatusRunning, Progress: i})
+	}
+	return job
+}
+
+// seqs returns the sequence numbers of events in order
+func seqs(events []Event) []uint64 {
+	out := []uint64{}
+	for _, event := range events {
+		out = append(out, event.Seq)
+	}
+	return out
+}
+
+// seqRange returns the sequence numbers from first to last
+func seqRange(first, last uint64) []uint64 {
+	out := []uint64{}
+	for seq := first; seq <= last; seq++ {
+		out = append(out, seq)
+	}
+	return out
+}
+
+func TestStartEvents(t *testing.T) {
+	job := jobWithEvents(5)
+	tests := []struct {
+		name   string
+		since  uint64
+		resume bool
+		want   []uint64
+	}{
+		{"current state only", 0, false, []uint64{5}},
+		{"since is ignored without resume", 2, false, []uint64{5}},
+		{"whole timeline", 0, true, []uint64{1, 2, 3, 4, 5}},
+		{"after a seq", 3, true, []uint64{4, 5}},
+		{"up to date", 5, true, []uint64{}},
+		{"ahead of the job", 9, true, []uint64{}},
+	}
+	for _, tt := range tests {
+		events := job.startEvents(tt.since, tt.resume)
+		if got := seqs(events); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: since=%d resume=%v replays %v, want %v", tt.name, tt.since, tt.resume, got, tt.want)
+		}
+		for _, event := range events {
+			if event.JobID != "j" || event.ProjectID != "p" {
+				t.Errorf("%s: event is not tagged with its job: %+v", tt.name, event)
+			}
+		}
+	}
+}
+
+func TestStartEventsWithoutHistory(t *testing.T) {
+	// Jobs persisted before events were kept replay their state as one event
+	job := &BuildJob{ID: "j", ProjectID: "p", Status: StatusCompleted, Progress: 100, Message: "done"}
+	events := job.startEvents(0, false)
+	if len(events) != 1 || events[0].Status != StatusCompleted || events[0].Progress != 100 || events[0].Seq != 0 {
+		t.Errorf("events = %+v, want the job's state", events)
+	}
+	if events := job.startEvents(0, true); len(events) != 0 {
+		t.Errorf("resuming a job without history replays %+v, want nothing", events)
+	}
+}
+
+func TestEventRetention(t *testing.T) {
+	const extra = 25
+	job := jobWithEvents(maxJobEvents + extra)
+
+	if len(job.Events) != maxJobEvents {
+		t.Fatalf("history holds %d events, want %d", len(job.Events), maxJobEvents)
+	}
+	// The oldest events are dropped, while numbering continues without gaps
+	first, last := uint64(extra+1), uint64(maxJobEvents+extra)
+	if got := seqs(job.startEvents(0, true)); !reflect.DeepEqual(got, seqRange(first, last)) {
+		t.Fatalf("retained events run from %d to %d, want %d to %d", got[0], got[len(got)-1], first, last)
+	}
+
+	tests := []struct {
+		name        string
+		since       uint64
+		first, last uint64
+	}{
+		// A client that fell behind the retained history resumes from the
+		// oldest retained event; the jump in seq tells it events are missing
+		{"since before the retained history", 3, first, last},
+		{"since just before the retained history", first - 1, first, last},
+		{"since within the retained history", last - 10, last - 9, last},
+		{"since at the last event", last, 1, 0},
+	}
+	for _, tt := range tests {
+		got := seqs(job.startEvents(tt.since, true))
+		if want := seqRange(tt.first, tt.last); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: since=%d replays %d events, want %d to %d", tt.name, tt.since, len(got), tt.first, tt.last)
+		}
+	}
+
+	job.addEvent(ProgressUpdate{Status: StatusCompleted})
+	if n := len(job.Events); n != maxJobEvents || job.Events[n-1].Seq != last+1 {
+		t.Errorf("after one more event the history holds %d events ending at %d", n, job.Events[n-1].Seq)
+	}
+}
+
+func TestReplayedEventsAreCopies(t *testing.T) {
+	job := jobWithEvents(3)
+	events := job.eventsSince(0)
+	events[0].Message = "changed"
+	if job.Events[0].Message == "changed" {
+		t.Error("replayed events share the job's history")
+	}
+}
+
+// gateStage blocks every build until release is closed
+type gateStage struct {
+	release chan struct{}
+}
+
+func (s gateStage) Name() string { return "gate" }
+func (s gateStage) Weight() int  { return 1 }
+
+func (s gateStage) Run(ctx context.Context, build *Build, progress ProgressFunc) error {
+	select {
+	case <-s.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TestSubscribeReplaysWithoutGapsOrDuplicates subscribes while a job keeps
+// publishing and checks that the replayed events followed by the live ones
+// are exactly the job's timeline
+func TestSubscribeReplaysWithoutGapsOrDuplicates(t *testing.T) {
+	logger := utils.NewColoredLogger("TEST", "")
+	stage := gateStage{release: make(chan struct{})}
+	q := NewJobQueue(Config{Workers: 1, Stages: []Stage{stage}}, logger, logger)
+	defer q.Shutdown()
+
+	jobID, _, err := q.SubmitJob(models.Project{ID: "p"}, SubmitOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, q, jobID, StatusRunning)
+	q.jobsMux.RLock()
+	job := q.jobs[jobID]
+	q.jobsMux.RUnlock()
+
+	const updates = 500
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < updates; i++ {
+			q.updateJobStatus(job, StatusRunning, i%100, "working")
+			// Spread the updates out so subscribers join mid-stream
+			time.Sleep(20 * time.Microsecond)
+		}
+		close(stage.release)
+	}()
+
+	// Subscribers join at different points while the job publishes,
+	// resuming from different seqs
+	var wg sync.WaitGroup
+	for i, since := range []uint64{0, 1, 50, 200} {
+		wg.Add(1)
+		go func(delay time.Duration, since uint64) {
+			defer wg.Done()
+			time.Sleep(delay)
+			snapshot, backlog, sub, err := q.Subscribe(jobID, since, true, true)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			var got []uint64
+			for _, event := range backlog {
+				got = append(got, event.Seq)
+			}
+			var final Event
+			for event := range sub.C {
+				if event.Log == nil {
+					got = append(got, event.Seq)
+					final = event
+				}
+			}
+			if sub.Evicted() {
+				t.Errorf("since=%d: subscriber was evicted", since)
+				return
+			}
+			if !final.Status.IsFinal() && !snapshot.Status.IsFinal() {
+				t.Errorf("since=%d: stream ended without a final event", since)
+			}
+			if len(got) == 0 {
+				return
+			}
+			// A client ahead of the job continues with the job's next event
+			if want := min(since, snapshot.Events[len(snapshot.Events)-1].Seq) + 1; got[0] != want {
+				t.Errorf("since=%d: replay starts at seq %d, want %d", since, got[0], want)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i] != got[i-1]+1 {
+					t.Errorf("since=%d: seq %d follows %d", since, got[i], got[i-1])
+					return
+				}
+			}
+		}(time.Duration(i)*2*time.Millisecond, since)
+	}
+	wg.Wait()
+	<-published
+
+	// A subscriber to the finished job replays its history, then its
+	// subscription is closed
+	finished, backlog, sub, err := q.Subscribe(jobID, 0, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, open := <-sub.C; open {
+		t.Error("subscription to a finished job is open")
+	}
+	if n := len(backlog); n == 0 || backlog[n-1].Seq != finished.Events[len(finished.Events)-1].Seq || !backlog[n-1].Status.IsFinal() {
+		t.Errorf("replay of the finished job does not end with its final event")
+	}
+}
@@ -0,0 +1,253 @@
+package job
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	// subscriberBuffer is how many events a subscriber to one job may fall
+	// behind before it is evicted
+	subscriberBuffer = 64
+	// feedBuffer is how many events a feed, or a subscriber to build logs,
+	// may fall behind before it is evicted; feeds watch many jobs at once and
+	// builds log in bursts
+	feedBuffer = 1024
+)
+
+// Hub fans the events of jobs out to any number of subscribers, which watch
+// single jobs or all jobs of a project, and their build logs if they ask for
+// them. Publishing never blocks: a subscriber whose buffer is full is evicted
+// instead of holding up the build or the other subscribers.
+type Hub struct {
+	mu     sync.Mutex
+	topics map[string]map[*Subscription]struct{}
+}
+
+// Subscription receives the events of the jobs and projects it watches
+type Subscription struct {
+	// C delivers the events. It is closed when the subscriber is evicted or
+	// unsubscribes, and for a subscription to one job after its final event.
+	C <-chan Event
+
+	ch     chan Event
+	hub    *Hub
+	topics map[string]struct{}
+	// once subscriptions end with their job
+	once    bool
+	closed  bool
+	evicted bool
+}
+
+func jobTopic(jobID string) string { return "job:" + jobID }
+
+func projectTopic(projectID string) string { return "project:" + projectID }
+
+// logTopicPrefix marks the topics of build logs
+const logTopicPrefix = "logs:"
+
+// logTopic is the topic of the build logs of a job or project topic
+func logTopic(topic string) string { return logTopicPrefix + topic }
+
+// NewHub returns a hub without subscribers
+func NewHub() *Hub {
+	return &Hub{topics: make(map[string]map[*Subscription]struct{})}
+}
+
+// Subscribe starts receiving the events published for a job, and its log
+// lines when logs is set, until its final event
+func (h *Hub) Subscribe(jobID string, logs bool) *Subscription {
+	topics := []string{jobTopic(jobID)}
+	buffer := subscriberBuffer
+	if logs {
+		topics = append(topics, logTopic(jobTopic(jobID)))
+		buffer = feedBuffer
+	}
+	return h.subscribeOnce(buffer, topics...)
+}
+
+// SubscribeLogs starts receiving the log lines of a job, until its final
+// event
+func (h *Hub) SubscribeLogs(jobID string) *Subscription {
+	return h.subscribeOnce(feedBuffer, logTopic(jobTopic(jobID)))
+}
+
+func (h *Hub) subscribeOnce(buffer int, topics ...string) *Subscription {
+	sub := h.newSubscription(buffer)
+	sub.once = true
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, topic := range topics {
+		h.add(sub, topic)
+	}
+	return sub
+}
+
+// Feed returns a subscription that watches nothing until jobs or projects
+// are added to it, and stays open until it is unsubscribed
+func (h *Hub) Feed() *Subscription {
+	return h.newSubscription(feedBuffer)
+}
+
+func (h *Hub) newSubscription(buffer int) *Subscription {
+	ch := make(chan Event, buffer)
+	return &Subscription{C: ch, ch: ch, hub: h, topics: make(map[string]struct{})}
+}
+
+// watch queues backlog on a subscription and, when live, adds topic to it,
+// and the topic of its logs when logs is set, so that later events follow
+// the backlog
+func (h *Hub) watch(sub *Subscription, topic string, backlog []Event, live, logs bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if sub.closed {
+		return
+	}
+	for _, event := range backlog {
+		if !h.send(sub, event) {
+			return
+		}
+	}
+	if live {
+		h.add(sub, topic)
+		if logs {
+			h.add(sub, logTopic(topic))
+		} else {
+			h.drop(sub, logTopic(topic))
+		}
+	}
+}
+
+// UnwatchJob stops delivering the events and logs of a job watched directly
+func (s *Subscription) UnwatchJob(jobID string) {
+	s.hub.unwatch(s, jobTopic(jobID))
+}
+
+// UnwatchProject stops delivering the events and logs of a project's jobs
+func (s *Subscription) UnwatchProject(projectID string) {
+	s.hub.unwatch(s, projectTopic(projectID))
+}
+
+func (h *Hub) unwatch(sub *Subscription, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.drop(sub, topic)
+	h.drop(sub, logTopic(topic))
+}
+
+// Watching returns the number of jobs and projects a subscription watches
+func (s *Subscription) Watching() int {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	watching := 0
+	for topic := range s.topics {
+		if !strings.HasPrefix(topic, logTopicPrefix) {
+			watching++
+		}
+	}
+	return watching
+}
+
+// Unsubscribe stops a subscription and closes its channel; it is safe to
+// call more than once
+func (s *Subscription) Unsubscribe() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.close(s)
+}
+
+// Evicted reports whether the subscription was dropped for falling behind
+func (s *Subscription) Evicted() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	return s.evicted
+}
+
+// Publish delivers an event to every subscriber of its job or project, or
+// of their logs for a log line. A final event ends the subscriptions to the
+// job and its logs.
+func (h *Hub) Publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	job, project := jobTopic(event.JobID), projectTopic(event.ProjectID)
+	if event.Log != nil {
+		job, project = logTopic(job), logTopic(project)
+	}
+
+	jobSubs := h.topics[job]
+	delivered := make(map[*Subscription]bool, len(jobSubs))
+	for _, subs := range []map[*Subscription]struct{}{jobSubs, h.topics[project]} {
+		for sub := range subs {
+			if !delivered[sub] {
+				delivered[sub] = true
+				h.send(sub, event)
+			}
+		}
+	}
+
+	if event.Log == nil && event.Status.IsFinal() {
+		for _, topic := range []string{job, logTopic(job)} {
+			for sub := range h.topics[topic] {
+				if sub.once {
+					h.close(sub)
+				} else {
+					h.drop(sub, topic)
+				}
+			}
+		}
+	}
+}
+
+// send delivers an event without blocking, evicting a subscriber whose
+// buffer is full; callers must hold mu
+func (h *Hub) send(sub *Subscription, event Event) bool {
+	select {
+	case sub.ch <- event:
+		return true
+	default:
+		sub.evicted = true
+		h.close(sub)
+		return false
+	}
+}
+
+// add registers a subscription for a topic; callers must hold mu
+func (h *Hub) add(sub *Subscription, topic string) {
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[*Subscription]struct{})
+	}
+	h.topics[topic][sub] = struct{}{}
+	sub.topics[topic] = struct{}{}
+}
+
+// drop unregisters a subscription from a topic; callers must hold mu
+func (h *Hub) drop(sub *Subscription, topic string) {
+	delete(sub.topics, topic)
+	if subs, exists := h.topics[topic]; exists {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// close drops a subscription from all topics and closes its channel;
+// callers must hold mu
+func (h *Hub) close(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	for topic := range sub.topics {
+		h.drop(sub, topic)
+	}
+	sub.closed = true
+	close(sub.ch)
+}
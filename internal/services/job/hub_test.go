@@ -0,0 +1,209 @@
+package job
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// progressEvent is a running event of a job numbered seq
+func progressEvent(jobID, projectID string, seq uint64) Event {
+	return Event{JobID: jobID, ProjectID: projectID, ProgressUpdate: ProgressUpdate{Seq: seq, Status: StatusRunning}}
+}
+
+// drain reads a subscription until it is closed and returns what it received
+func drain(t *testing.T, sub *Subscription) []Event {
+	t.Helper()
+	var events []Event
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		case <-timeout:
+			t.Fatalf("subscription still open after %d events", len(events))
+		}
+	}
+}
+
+func TestHubEvictsSlowSubscriberWithoutBlocking(t *testing.T) {
+	hub := NewHub()
+	slow := hub.Subscribe("j", false)
+	fast := hub.Subscribe("j", false)
+
+	const total = 10 * subscriberBuffer
+	var received []Event
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range fast.C {
+			received = append(received, event)
+		}
+	}()
+
+	// The slow subscriber never reads, yet publishing must not wait for it
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for seq := uint64(1); seq <= total; seq++ {
+			hub.Publish(progressEvent("j", "p", seq))
+			// Let the fast subscriber catch up before its buffer fills
+			if seq%(subscriberBuffer/2) == 0 {
+				for len(fast.C) > 0 {
+					time.Sleep(100 * time.Microsecond)
+				}
+			}
+		}
+		final := progressEvent("j", "p", total+1)
+		final.Status = StatusCompleted
+		hub.Publish(final)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish blocked on a subscriber that does not read")
+	}
+
+	if !slow.Evicted() {
+		t.Error("slow subscriber was not evicted")
+	}
+	// The slow subscriber keeps what fit in its buffer, then its channel is closed
+	if events := drain(t, slow); len(events) != subscriberBuffer {
+		t.Errorf("slow subscriber received %d events, want %d", len(events), subscriberBuffer)
+	}
+
+	<-done
+	if fast.Evicted() {
+		t.Error("fast subscriber was evicted")
+	}
+	if len(received) != total+1 {
+		t.Fatalf("fast subscriber received %d events, want %d", len(received), total+1)
+	}
+	for i, event := range received {
+		if event.Seq != uint64(i+1) {
+			t.Fatalf("event %d has seq %d, want %d", i, event.Seq, i+1)
+		}
+	}
+}
+
+func TestHubEvictionDoesNotAffectOtherTopics(t *testing.T) {
+	hub := NewHub()
+	slow := hub.Subscribe("a", false)
+	other := hub.Subscribe("b", false)
+
+	for seq := uint64(1); seq <= subscriberBuffer+1; seq++ {
+		hub.Publish(progressEvent("a", "p", seq))
+	}
+	hub.Publish(progressEvent("b", "p", 1))
+
+	if !slow.Evicted() {
+		t.Fatal("slow subscriber was not evicted")
+	}
+	select {
+	case event := <-other.C:
+		if event.JobID != "b" {
+			t.Errorf("other subscriber received an event of job %q", event.JobID)
+		}
+	default:
+		t.Error("other subscriber received nothing")
+	}
+
+	// An evicted subscription no longer takes part in publishing
+	hub.mu.Lock()
+	_, stillSubscribed := hub.topics[jobTopic("a")]
+	hub.mu.Unlock()
+	if stillSubscribed {
+		t.Error("evicted subscriber is still registered for its topic")
+	}
+	slow.Unsubscribe()
+}
+
+func TestHubFinalEventEndsJobSubscriptions(t *testing.T) {
+	hub := NewHub()
+	sub := hub.Subscribe("j", true)
+	feed := hub.Feed()
+	hub.watch(feed, jobTopic("j"), nil, true, true)
+	hub.watch(feed, projectTopic("p"), nil, true, false)
+
+	hub.Publish(progressEvent("j", "p", 1))
+	hub.Publish(Event{JobID: "j", ProjectID: "p", Log: &LogEntry{Seq: 1, Level: LogInfo, Message: "line"}})
+	final := progressEvent("j", "p", 2)
+	final.Status = StatusFailed
+	hub.Publish(final)
+
+	// A subscription to one job ends with it, logs included
+	if events := drain(t, sub); len(events) != 3 {
+		t.Errorf("job subscription received %d events, want 3", len(events))
+	}
+	if sub.Evicted() {
+		t.Error("a subscription ended by its final event counts as evicted")
+	}
+
+	// A feed stays open, watching its project but no longer the job; it
+	// receives each event once although it watches both the job and its
+	// project, and log lines only of the job whose logs it asked for
+	var events []Event
+	for len(feed.C) > 0 {
+		events = append(events, <-feed.C)
+	}
+	if len(events) != 3 {
+		t.Errorf("feed received %d events, want 3", len(events))
+	}
+	if watching := feed.Watching(); watching != 1 {
+		t.Errorf("feed watches %d jobs and projects, want 1", watching)
+	}
+	hub.Publish(progressEvent("k", "p", 1))
+	hub.Publish(Event{JobID: "k", ProjectID: "p", Log: &LogEntry{Seq: 1, Level: LogInfo}})
+	if len(feed.C) != 1 {
+		t.Errorf("feed received %d events of another job of the project, want 1", len(feed.C))
+	}
+	feed.Unsubscribe()
+	feed.Unsubscribe()
+}
+
+func TestHubConcurrentPublishAndUnsubscribe(t *testing.T) {
+	hub := NewHub()
+	var wg sync.WaitGroup
+
+	// Subscribers come and go, read slowly or not at all, while several jobs
+	// publish concurrently; the race detector checks the hub's locking
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				sub := hub.Subscribe("j", i%2 == 0)
+				if i%3 == 0 {
+					select {
+					case <-sub.C:
+					case <-time.After(time.Millisecond):
+					}
+				}
+				sub.Unsubscribe()
+			}
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for seq := uint64(1); seq <= 500; seq++ {
+				hub.Publish(progressEvent("j", "p", seq))
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("publishers or subscribers are stuck")
+	}
+}
@@ -0,0 +1,138 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LogLevel is the severity of a line in a job's build log
+type LogLevel string
+
+const (
+	LogDebug LogLevel = "debug"
+	LogInfo  LogLevel = "info"
+	LogWarn  LogLevel = "warn"
+	LogError LogLevel = "error"
+)
+
+// ErrInvalidLogLevel is returned when parsing an unknown log level
+var ErrInvalidLogLevel = errors.New("invalid log level")
+
+var logSeverity = map[LogLevel]int{
+	LogDebug: 1,
+	LogInfo:  2,
+	LogWarn:  3,
+	LogError: 4,
+}
+
+// ParseLogLevel parses a log level name; an empty name is returned as is
+// and selects every level
+func ParseLogLevel(name string) (LogLevel, error) {
+	level := LogLevel(name)
+	if _, known := logSeverity[level]; !known && name != "" {
+		return "", fmt.Errorf("%w %q: must be %s, %s, %s or %s", ErrInvalidLogLevel, name, LogDebug, LogInfo, LogWarn, LogError)
+	}
+	return level, nil
+}
+
+// AtLeast reports whether the level is as severe as min or more; every level
+// is at least the empty level
+func (l LogLevel) AtLeast(min LogLevel) bool {
+	return logSeverity[l] >= logSeverity[min]
+}
+
+// LogEntry is a structured line of a job's build log
+type LogEntry struct {
+	// Seq numbers the log lines of a job from 1, without gaps; it is
+	// independent of the sequence numbers of progress events
+	Seq   uint64   `json:"seq"`
+	Level LogLevel `json:"level"`
+	// Stage is the pipeline stage that logged the line, if any
+	Stage   string `json:"stage,omitempty"`
+	Message string `json:"message"`
+	// Page is the output filename of the page the line is about
+	Page string `json:"page,omitempty"`
+	// Component is the ID of the component the line is about
+	Component string `json:"component,omitempty"`
+	// DurationMs is how long what the line reports took, such as a stage
+	DurationMs int64     `json:"durationMs,omitempty"`
+	Attempt    int       `json:"attempt,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+const (
+	// maxJobLogs bounds the log kept per job; the oldest lines are dropped
+	// first, while sequence numbers keep counting
+	maxJobLogs = 5000
+	// DefaultLogLimit is how many log lines a page of the log holds by default
+	DefaultLogLimit = 100
+	// MaxLogLimit is the most log lines a page of the log may hold
+	MaxLogLimit = 1000
+)
+
+// addLog numbers a log line, appends it to the job's log and returns it;
+// callers must hold jobsMux
+func (job *BuildJob) addLog(entry LogEntry) LogEntry {
+	entry.Seq = 1
+	if n := len(job.Logs); n > 0 {
+		entry.Seq = job.Logs[n-1].Seq + 1
+	}
+
+	// Like events, log lines are never modified once added
+	if len(job.Logs) >= maxJobLogs {
+		job.Logs = job.Logs[len(job.Logs)-maxJobLogs+1:]
+	}
+	job.Logs = append(job.Logs, entry)
+	return entry
+}
+
+// LogQuery selects lines of a job's log
+type LogQuery struct {
+	// After skips the lines up to and including this sequence number
+	After uint64
+	// Limit is the most lines returned, up to MaxLogLimit; zero uses
+	// DefaultLogLimit
+	Limit int
+	// Level leaves out lines less severe than it; empty keeps all lines
+	Level LogLevel
+}
+
+// Matches reports whether a log line is selected by the query's filters,
+// including lines up to After, which a follower that asked for lines ahead of
+// the log must not be sent as they are added
+func (query LogQuery) Matches(entry LogEntry) bool {
+	return entry.Seq > query.After && entry.Level.AtLeast(query.Level)
+}
+
+// LogPage is a page of a job's log
+type LogPage struct {
+	Logs []LogEntry `json:"logs"`
+	// Next is the sequence number to continue after for the next page
+	Next uint64 `json:"next"`
+	// More reports whether the log already holds lines after this page
+	More bool `json:"more"`
+	// Done reports whether the job has finished, so no lines will be added
+	Done bool `json:"done"`
+}
+
+// logPage returns up to limit lines selected by a query; callers must hold
+// jobsMux
+func (job *BuildJob) logPage(query LogQuery, limit int) LogPage {
+	page := LogPage{Logs: []LogEntry{}, Next: query.After, Done: job.Status.IsFinal()}
+	for _, entry := range job.Logs {
+		if entry.Seq <= query.After {
+			continue
+		}
+		if len(page.Logs) == limit {
+			page.More = true
+			break
+		}
+		// Lines left out by the filters are skipped by the next page too
+		page.Next = entry.Seq
+		if query.Matches(entry) {
+			page.Logs = append(page.Logs, entry)
+		}
+	}
+	return page
+}
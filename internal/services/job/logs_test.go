@@ -0,0 +1,372 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/utils"
+)
+
+// jobWithLogs returns a running job whose log holds a line of each level, in
+// order
+func jobWithLogs(levels ...LogLevel) *BuildJob {
+	job := &BuildJob{ID: "j", ProjectID: "p", Status: StatusRunning}
+	for i, level := range levels {
+		job.addLog(LogEntry{Level: level, Message: fmt.Sprintf("line %d", i+1)})
+	}
+	return job
+}
+
+// logSeqs returns the sequence numbers of log lines in order
+func logSeqs(entries []LogEntry) []uint64 {
+	out := []uint64{}
+	for _, entry := range entries {
+		out = append(out, entry.Seq)
+	}
+	return out
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    LogLevel
+		wantErr bool
+	}{
+		{"", "", false},
+		{"debug", LogDebug, false},
+		{"info", LogInfo, false},
+		{"warn", LogWarn, false},
+		{"error", LogError, false},
+		{"warning", "", true},
+		{"ERROR", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLogLevel(tt.name)
+		if got != tt.want || errors.Is(err, ErrInvalidLogLevel) != tt.wantErr {
+			t.Errorf("ParseLogLevel(%q) = %q, %v; want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLogLevelAtLeast(t *testing.T) {
+	tests := []struct {
+		level, min LogLevel
+		want       bool
+	}{
+		{LogDebug, "", true},
+		{LogDebug, LogDebug, true},
+		{LogDebug, LogInfo, false},
+		{LogWarn, LogInfo, true},
+		{LogWarn, LogError, false},
+		{LogError, LogWarn, true},
+		{LogError, LogError, true},
+	}
+	for _, tt := range tests {
+		if got := tt.level.AtLeast(tt.min); got != tt.want {
+			t.Errorf("%q.AtLeast(%q) = %v, want %v", tt.level, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestLogPage(t *testing.T) {
+	// Lines 1 to 10 cycle through debug, info, warn and error
+	job := jobWithLogs(LogDebug, LogInfo, LogWarn, LogError, LogDebug, LogInfo, LogWarn, LogError, LogDebug, LogInfo)
+	tests := []struct {
+		name  string
+		query LogQuery
+		limit int
+		want  []uint64
+		next  uint64
+		more  bool
+	}{
+		{"first page", LogQuery{}, 3, []uint64{1, 2, 3}, 3, true},
+		{"middle page", LogQuery{After: 3}, 3, []uint64{4, 5, 6}, 6, true},
+		{"last page fits exactly", LogQuery{After: 7}, 3, []uint64{8, 9, 10}, 10, false},
+		{"last page is short", LogQuery{After: 8}, 3, []uint64{9, 10}, 10, false},
+		{"after the last line", LogQuery{After: 10}, 3, []uint64{}, 10, false},
+		{"ahead of the log", LogQuery{After: 20}, 3, []uint64{}, 20, false},
+		{"whole log", LogQuery{}, 10, seqRange(1, 10), 10, false},
+		{"limit of one", LogQuery{After: 4}, 1, []uint64{5}, 5, true},
+
+		// Lines left out by the level are skipped, and the next page
+		// continues after them
+		{"level fills the page", LogQuery{Level: LogWarn}, 2, []uint64{3, 4}, 4, true},
+		{"level with lines left after the page", LogQuery{After: 4, Level: LogWarn}, 2, []uint64{7, 8}, 8, true},
+		{"level leaves nothing on the last page", LogQuery{After: 8, Level: LogWarn}, 2, []uint64{}, 10, false},
+		{"level over the whole log", LogQuery{Level: LogError}, 5, []uint64{4, 8}, 10, false},
+		{"debug keeps every line", LogQuery{After: 5, Level: LogDebug}, 10, []uint64{6, 7, 8, 9, 10}, 10, false},
+	}
+	for _, tt := range tests {
+		page := job.logPage(tt.query, tt.limit)
+		if got := logSeqs(page.Logs); !reflect.DeepEqual(got, tt.want) || page.Next != tt.next || page.More != tt.more {
+			t.Errorf("%s: page = %v next %d more %v, want %v next %d more %v",
+				tt.name, got, page.Next, page.More, tt.want, tt.next, tt.more)
+		}
+		if page.Done {
+			t.Errorf("%s: page of a running job is done", tt.name)
+		}
+		for _, entry := range page.Logs {
+			if !entry.Level.AtLeast(tt.query.Level) {
+				t.Errorf("%s: page holds a %s line", tt.name, entry.Level)
+			}
+		}
+	}
+
+	job.Status = StatusFailed
+	if page := job.logPage(LogQuery{After: 10}, 3); !page.Done {
+		t.Error("page of a finished job is not done")
+	}
+}
+
+// TestLogPagesCoverTheLog pages through a log with every limit and level and
+// checks that the pages together hold each selected line once
+func TestLogPagesCoverTheLog(t *testing.T) {
+	levels := []LogLevel{LogDebug, LogInfo, LogWarn, LogError}
+	var lines []LogLevel
+	for i := 0; i < 50; i++ {
+		lines = append(lines, levels[(i*7)%len(levels)])
+	}
+	job := jobWithLogs(lines...)
+
+	for _, level := range append([]LogLevel{""}, levels...) {
+		want := []uint64{}
+		for _, entry := range job.Logs {
+			if entry.Level.AtLeast(level) {
+				want = append(want, entry.Seq)
+			}
+		}
+		for limit := 1; limit <= 12; limit++ {
+			got := []uint64{}
+			query := LogQuery{Level: level}
+			for pages := 0; ; pages++ {
+				if pages > len(lines) {
+					t.Fatalf("level %q limit %d: paging does not end", level, limit)
+				}
+				page := job.logPage(query, limit)
+				got = append(got, logSeqs(page.Logs)...)
+				if !page.More {
+					break
+				}
+				query.After = page.Next
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("level %q limit %d: pages hold %v, want %v", level, limit, got, want)
+			}
+		}
+	}
+}
+
+func TestLogRetention(t *testing.T) {
+	const extra = 30
+	job := &BuildJob{ID: "j", ProjectID: "p", Status: StatusRunning}
+	for i := 0; i < maxJobLogs+extra; i++ {
+		job.addLog(LogEntry{Level: LogInfo})
+	}
+
+	if len(job.Logs) != maxJobLogs {
+		t.Fatalf("log holds %d lines, want %d", len(job.Logs), maxJobLogs)
+	}
+	// The oldest lines are dropped, while numbering continues without gaps
+	first, last := uint64(extra+1), uint64(maxJobLogs+extra)
+	if got := logSeqs(job.Logs); !reflect.DeepEqual(got, seqRange(first, last)) {
+		t.Fatalf("retained lines run from %d to %d, want %d to %d", got[0], got[len(got)-1], first, last)
+	}
+
+	tests := []struct {
+		name  string
+		after uint64
+		want  []uint64
+		next  uint64
+		more  bool
+	}{
+		// A client that fell behind continues with the oldest retained line;
+		// the jump in seq tells it lines are missing
+		{"after dropped lines", 5, seqRange(first, first+2), first + 2, true},
+		{"just before the retained log", first - 1, seqRange(first, first+2), first + 2, true},
+		{"end of the retained log", last - 2, seqRange(last-1, last), last, false},
+		{"at the last line", last, []uint64{}, last, false},
+	}
+	for _, tt := range tests {
+		page := job.logPage(LogQuery{After: tt.after}, 3)
+		if got := logSeqs(page.Logs); !reflect.DeepEqual(got, tt.want) || page.Next != tt.next || page.More != tt.more {
+			t.Errorf("%s: after=%d page = %v next %d more %v, want %v next %d more %v",
+				tt.name, tt.after, got, page.Next, page.More, tt.want, tt.next, tt.more)
+		}
+	}
+}
+
+// chattyStage logs lines lines, spread out over time, after waiting for
+// release
+type chattyStage struct {
+	lines   int
+	release chan struct{}
+}
+
+func (s chattyStage) Name() string { return "chatty" }
+func (s chattyStage) Weight() int  { return 1 }
+
+func (s chattyStage) Run(ctx context.Context, build *Build, progress ProgressFunc) error {
+	levels := []LogLevel{LogDebug, LogInfo, LogWarn, LogError}
+	build.Log(LogEntry{Level: LogInfo, Message: "waiting"})
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	for i := 0; i < s.lines; i++ {
+		build.Log(LogEntry{Level: levels[i%len(levels)], Message: fmt.Sprintf("line %d", i)})
+		// Spread the lines out so followers join mid-stream
+		time.Sleep(20 * time.Microsecond)
+	}
+	return nil
+}
+
+func TestQueueLogs(t *testing.T) {
+	logger := utils.NewColoredLogger("TEST", "")
+	stage := chattyStage{lines: MaxLogLimit + 200, release: make(chan struct{})}
+	close(stage.release)
+	q := NewJobQueue(Config{Workers: 1, Stages: []Stage{stage}}, logger, logger)
+	defer q.Shutdown()
+
+	if _, err := q.Logs("missing", LogQuery{}); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Logs of a missing job: %v, want %v", err, ErrJobNotFound)
+	}
+	if _, _, err := q.FollowLogs("missing", LogQuery{}); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("FollowLogs of a missing job: %v, want %v", err, ErrJobNotFound)
+	}
+
+	jobID, _, err := q.SubmitJob(models.Project{ID: "p"}, SubmitOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, q, jobID, StatusCompleted)
+
+	tests := []struct {
+		limit, want int
+	}{
+		{0, DefaultLogLimit},
+		{-1, DefaultLogLimit},
+		{7, 7},
+		{MaxLogLimit, MaxLogLimit},
+		{MaxLogLimit + 1, MaxLogLimit},
+	}
+	for _, tt := range tests {
+		page, err := q.Logs(jobID, LogQuery{Limit: tt.limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Logs) != tt.want || !page.More || !page.Done {
+			t.Errorf("limit %d: page holds %d lines, more %v, done %v; want %d lines, more, done",
+				tt.limit, len(page.Logs), page.More, page.Done, tt.want)
+		}
+	}
+
+	// Following a finished job returns its whole log, however long, and a
+	// closed subscription
+	page, sub, err := q.FollowLogs(jobID, LogQuery{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(page.Logs); n <= MaxLogLimit || page.More || !page.Done || page.Logs[n-1].Seq != page.Next {
+		t.Errorf("followed log of a finished job holds %d lines, more %v, done %v", n, page.More, page.Done)
+	}
+	if _, open := <-sub.C; open {
+		t.Error("subscription to the log of a finished job is open")
+	}
+}
+
+// TestFollowLogs follows a job's log while it is being written and checks
+// that the lines returned first followed by the live ones are exactly the
+// job's log
+func TestFollowLogs(t *testing.T) {
+	logger := utils.NewColoredLogger("TEST", "")
+	stage := chattyStage{lines: 600, release: make(chan struct{})}
+	q := NewJobQueue(Config{Workers: 1, Stages: []Stage{stage}}, logger, logger)
+	defer q.Shutdown()
+
+	jobID, _, err := q.SubmitJob(models.Project{ID: "p"}, SubmitOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, q, jobID, StatusRunning)
+	close(stage.release)
+
+	// Followers join at different points while the job logs, some asking
+	// for the lines after a seq or of a level only
+	type follower struct {
+		query LogQuery
+		delay time.Duration
+	}
+	followers := []follower{
+		{LogQuery{}, 0},
+		{LogQuery{After: 3}, time.Millisecond},
+		{LogQuery{Level: LogWarn}, 2 * time.Millisecond},
+		{LogQuery{After: 100, Limit: 1}, 4 * time.Millisecond},
+		{LogQuery{}, 8 * time.Millisecond},
+	}
+	results := make([][]LogEntry, len(followers))
+	var wg sync.WaitGroup
+	for i, f := range followers {
+		wg.Add(1)
+		go func(i int, f follower) {
+			defer wg.Done()
+			time.Sleep(f.delay)
+			page, sub, err := q.FollowLogs(jobID, f.query)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer sub.Unsubscribe()
+
+			// Lines on the subscription are not filtered, so the follower
+			// applies its query itself
+			lines := page.Logs
+			for event := range sub.C {
+				if event.Log != nil && f.query.Matches(*event.Log) {
+					lines = append(lines, *event.Log)
+				}
+			}
+			if sub.Evicted() {
+				t.Errorf("follower %d was evicted", i)
+			}
+			results[i] = lines
+		}(i, f)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("followers did not stop at the end of the job")
+	}
+	waitForStatus(t, q, jobID, StatusCompleted)
+
+	q.jobsMux.RLock()
+	all := append([]LogEntry(nil), q.jobs[jobID].Logs...)
+	q.jobsMux.RUnlock()
+	if len(all) < stage.lines {
+		t.Fatalf("job logged %d lines, want at least %d", len(all), stage.lines)
+	}
+
+	for i, f := range followers {
+		want := []uint64{}
+		for _, entry := range all {
+			if entry.Seq > f.query.After && f.query.Matches(entry) {
+				want = append(want, entry.Seq)
+			}
+		}
+		if got := logSeqs(results[i]); !reflect.DeepEqual(got, want) {
+			t.Errorf("follower %d (%+v) received %d lines, want %d without gaps or duplicates", i, f.query, len(got), len(want))
+		}
+	}
+}
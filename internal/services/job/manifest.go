@@ -0,0 +1,59 @@
+package job
+
+import "sawthet.go-press-server.net/internal/models"
+
+// How the pages of a build load their styles
+const (
+	// CSSModeLink links the shared stylesheet from every page
+	CSSModeLink = "link"
+	// CSSModeInline embeds the whole stylesheet in every page
+	CSSModeInline = "inline"
+	// CSSModeCritical embeds the rules used above the fold of each page and
+	// loads the shared stylesheet without blocking rendering
+	CSSModeCritical = "critical"
+)
+
+// cssMode returns the CSS mode chosen by a project's build config
+func cssMode(config *models.BuildConfig) string {
+	switch {
+	case config == nil:
+		return CSSModeLink
+	case config.InlineCSS:
+		return CSSModeInline
+	case config.CriticalCSS:
+		return CSSModeCritical
+	}
+	return CSSModeLink
+}
+
+// Manifest describes the output of a build and what each page loads
+type Manifest struct {
+	// CSSMode is how pages load their styles; empty when no CSS was compiled
+	CSSMode string `json:"cssMode,omitempty"`
+	// Stylesheet is the path of the shared stylesheet, if pages load one
+	Stylesheet      string `json:"stylesheet,omitempty"`
+	StylesheetBytes int    `json:"stylesheetBytes,omitempty"`
+	// Pages maps output filenames to their sizes
+	Pages map[string]PageStats `json:"pages"`
+}
+
+// PageStats reports the size of a page and of the CSS it loads
+type PageStats struct {
+	HTMLBytes int `json:"htmlBytes"`
+	// InlineCSSBytes is the CSS embedded in the page
+	InlineCSSBytes int `json:"inlineCssBytes"`
+	// BlockingCSSBytes is the linked CSS the browser loads before rendering
+	BlockingCSSBytes int `json:"blockingCssBytes"`
+	// DeferredCSSBytes is the linked CSS loaded after the page has rendered
+	DeferredCSSBytes int `json:"deferredCssBytes"`
+}
+
+// updatePage changes the stats of one page
+func (m *Manifest) updatePage(filename string, update func(*PageStats)) {
+	if m.Pages == nil {
+		m.Pages = make(map[string]PageStats)
+	}
+	stats := m.Pages[filename]
+	update(&stats)
+	m.Pages[filename] = stats
+}
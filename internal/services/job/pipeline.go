@@ -0,0 +1,346 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"sawthet.go-press-server.net/internal/models"
+)
+
+// ErrUnknownStage is returned when a project's build config names a stage
+// the pipeline does not know
+var ErrUnknownStage = errors.New("unknown build stage")
+
+// ErrInvalidStages is returned when a project's build config lists a stage
+// twice, out of order, or leaves out or skips a required stage
+var ErrInvalidStages = errors.New("invalid build stages")
+
+// requiredStages must run in every build whose pipeline has them: without
+// rendering or packaging there is no site to download
+var requiredStages = []string{StageRender, StagePackage}
+
+// ProgressFunc reports progress from 0 to 100 together with a status message
+type ProgressFunc func(progress int, message string)
+
+// Stage is one step of a build, such as rendering pages or packaging the site
+type Stage interface {
+	// Name identifies the stage in build configs, progress messages and records
+	Name() string
+	// Weight is the stage's share of the overall build progress relative to
+	// the other stages
+	Weight() int
+	// Run executes the stage, reporting its own progress from 0 to 100
+	Run(ctx context.Context, build *Build, progress ProgressFunc) error
+}
+
+// Build is the state handed from stage to stage during one build
+type Build struct {
+	JobID   string
+	Project models.Project
+	// Draft renders preview pages styled by the Tailwind CDN
+	Draft bool
+	// Pages maps output filenames to rendered HTML
+	Pages map[string][]byte
+	// Assets maps output paths to every other file of the site, such as the stylesheet
+	Assets map[string][]byte
+	// Artifact is the path of the packaged site once it has been written
+	Artifact string
+	// Cache holds the output of the project's previous build; it may be nil
+	Cache *BuildCache
+	// Report lists which pages were rendered and which were reused
+	Report PageReport
+	// Manifest reports the size of the pages and of the CSS they load
+	Manifest Manifest
+
+	// stage is the name of the running stage
+	stage string
+	logs  []StageLog
+	// onLog receives every line logged during the build
+	onLog     func(LogEntry)
+	cacheKeys map[string]map[string]bool
+}
+
+// PageReport lists the output filenames of rebuilt and reused pages
+type PageReport struct {
+	Rebuilt []string `json:"rebuilt"`
+	Reused  []string `json:"reused"`
+}
+
+// cached looks up earlier output of this project and remembers the key as
+// used by this build
+func (b *Build) cached(kind, key string) ([]byte, bool) {
+	data, ok := b.Cache.Get(b.Project.ID, kind, key)
+	if ok {
+		b.useCacheKey(kind, key)
+	}
+	return data, ok
+}
+
+// cache stores output for the next build; failing to do so only costs a
+// rebuild later, so errors are logged rather than returned
+func (b *Build) cache(kind, key string, data []byte) {
+	if b.Cache == nil {
+		return
+	}
+	if err := b.Cache.Put(b.Project.ID, kind, key, data); err != nil {
+		b.Log(LogEntry{Level: LogWarn, Message: fmt.Sprintf("Failed to cache %s %s: %v", kind, key, err)})
+		return
+	}
+	b.useCacheKey(kind, key)
+}
+
+func (b *Build) useCacheKey(kind, key string) {
+	if b.cacheKeys == nil {
+		b.cacheKeys = make(map[string]map[string]bool)
+	}
+	if b.cacheKeys[kind] == nil {
+		b.cacheKeys[kind] = make(map[string]bool)
+	}
+	b.cacheKeys[kind][key] = true
+}
+
+// RetainCache drops cached output not used by this build, so the cache only
+// ever holds the latest build of each project
+func (b *Build) RetainCache() error {
+	return b.Cache.Retain(b.Project.ID, b.cacheKeys)
+}
+
+// Logf adds an info line to the log of the running stage
+func (b *Build) Logf(format string, args ...any) {
+	b.Log(LogEntry{Level: LogInfo, Message: fmt.Sprintf(format, args...)})
+}
+
+// Log adds a structured line to the job's build log, attributed to the
+// running stage. Lines of info level and above are also kept on the stage's
+// record.
+func (b *Build) Log(entry LogEntry) {
+	if entry.Stage == "" {
+		entry.Stage = b.stage
+	}
+	if entry.At.IsZero() {
+		entry.At = time.Now()
+	}
+	if entry.Level.AtLeast(LogInfo) {
+		b.logs = append(b.logs, StageLog{At: entry.At, Message: entry.Message})
+	}
+	if b.onLog != nil {
+		b.onLog(entry)
+	}
+}
+
+// StageStatus is the state of a single stage within a build
+type StageStatus string
+
+const (
+	StagePending   StageStatus = "pending"
+	StageRunning   StageStatus = "running"
+	StageCompleted StageStatus = "completed"
+	StageSkipped   StageStatus = "skipped"
+	StageFailed    StageStatus = "failed"
+)
+
+// StageLog is a line logged by a stage
+type StageLog struct {
+	At      time.Time `json:"at"`
+	Message string    `json:"message"`
+}
+
+// StageRecord is the outcome of a stage, kept on the job record
+type StageRecord struct {
+	Name       string      `json:"name"`
+	Status     StageStatus `json:"status"`
+	Weight     int         `json:"weight"`
+	StartedAt  time.Time   `json:"startedAt"`
+	FinishedAt time.Time   `json:"finishedAt"`
+	Error      string      `json:"error,omitempty"`
+	Logs       []StageLog  `json:"logs,omitempty"`
+}
+
+// Duration returns how long the stage ran, or zero when it has not finished
+func (r StageRecord) Duration() time.Duration {
+	if r.StartedAt.IsZero() || r.FinishedAt.IsZero() {
+		return 0
+	}
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// Pipeline runs a sequence of stages, skipping those it was told to skip
+type Pipeline struct {
+	stages []Stage
+	skip   map[string]bool
+}
+
+// NewPipeline creates a pipeline running stages in the given order
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{
+		stages: stages,
+		skip:   make(map[string]bool),
+	}
+}
+
+// NewProjectPipeline arranges the available stages for a project. A project's
+// build config may select stages by name and skip others; selected stages
+// run in the order of the available stages, and required stages may neither
+// be left out nor skipped. Without a config every available stage runs in
+// its default order.
+func NewProjectPipeline(available []Stage, config *models.BuildConfig) (*Pipeline, error) {
+	if config == nil {
+		return NewPipeline(available...), nil
+	}
+
+	order := make(map[string]int, len(available))
+	for i, stage := range available {
+		order[stage.Name()] = i
+	}
+
+	stages := available
+	if len(config.Stages) > 0 {
+		stages = make([]Stage, 0, len(config.Stages))
+		for _, name := range config.Stages {
+			i, exists := order[name]
+			if !exists {
+				return nil, fmt.Errorf("%w %q", ErrUnknownStage, name)
+			}
+			// Listing stages in increasing order also rules out duplicates
+			if n := len(stages); n > 0 {
+				previous := stages[n-1].Name()
+				if previous == name {
+					return nil, fmt.Errorf("%w: stage %q is listed more than once", ErrInvalidStages, name)
+				}
+				if order[previous] > i {
+					return nil, fmt.Errorf("%w: stage %q must run before %q", ErrInvalidStages, name, previous)
+				}
+			}
+			stages = append(stages, available[i])
+		}
+	}
+
+	pipeline := NewPipeline(stages...)
+	for _, name := range config.Skip {
+		if _, exists := order[name]; !exists {
+			return nil, fmt.Errorf("%w %q", ErrUnknownStage, name)
+		}
+		pipeline.Skip(name)
+	}
+
+	for _, name := range requiredStages {
+		if _, exists := order[name]; !exists {
+			continue
+		}
+		if !pipeline.has(name) {
+			return nil, fmt.Errorf("%w: stage %q is required", ErrInvalidStages, name)
+		}
+		if pipeline.skip[name] {
+			return nil, fmt.Errorf("%w: stage %q cannot be skipped", ErrInvalidStages, name)
+		}
+	}
+
+	return pipeline, nil
+}
+
+// has reports whether a stage is part of the pipeline
+func (p *Pipeline) has(name string) bool {
+	for _, stage := range p.stages {
+		if stage.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Skip marks stages that should be recorded as skipped instead of run
+func (p *Pipeline) Skip(names ...string) {
+	for _, name := range names {
+		p.skip[name] = true
+	}
+}
+
+// Records returns the initial record of every stage, in run order
+func (p *Pipeline) Records() []StageRecord {
+	records := make([]StageRecord, len(p.stages))
+	for i, stage := range p.stages {
+		records[i] = StageRecord{
+			Name:   stage.Name(),
+			Status: StagePending,
+			Weight: stage.Weight(),
+		}
+		if p.skip[stage.Name()] {
+			records[i].Status = StageSkipped
+		}
+	}
+	return records
+}
+
+// Run executes the stages in order, stopping at the first error or when ctx
+// is cancelled. Overall progress is the weighted sum of the stages' own
+// progress. onStage is called with the index and record of a stage whenever
+// the stage starts or finishes.
+func (p *Pipeline) Run(ctx context.Context, build *Build, progress ProgressFunc, onStage func(int, StageRecord)) error {
+	records := p.Records()
+
+	total := 0
+	for i, stage := range p.stages {
+		if records[i].Status != StageSkipped {
+			total += stage.Weight()
+		}
+	}
+	if total == 0 {
+		total = 1
+	}
+
+	done := 0
+	for i, stage := range p.stages {
+		if records[i].Status == StageSkipped {
+			build.Log(LogEntry{Level: LogInfo, Stage: stage.Name(), Message: "Stage skipped"})
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		record := &records[i]
+		record.Status = StageRunning
+		record.StartedAt = time.Now()
+		onStage(i, *record)
+
+		build.stage = stage.Name()
+		build.logs = nil
+		build.Log(LogEntry{Level: LogDebug, Message: "Stage started"})
+		weight := stage.Weight()
+		err := stage.Run(ctx, build, func(stageProgress int, message string) {
+			stageProgress = min(max(stageProgress, 0), 100)
+			progress((done*100+weight*stageProgress)/total, message)
+		})
+
+		record.FinishedAt = time.Now()
+		record.Logs = build.logs
+		// The stage's timing is on its record already, so the closing line is
+		// only added to the job's log
+		build.logs = nil
+		duration := record.Duration()
+		if err != nil {
+			record.Status = StageFailed
+			record.Error = err.Error()
+			onStage(i, *record)
+
+			entry := LogEntry{Level: LogError, Message: fmt.Sprintf("Stage failed after %s: %v", duration.Round(time.Millisecond), err), DurationMs: duration.Milliseconds()}
+			if ctx.Err() != nil {
+				entry.Level = LogWarn
+				entry.Message = fmt.Sprintf("Stage stopped after %s: %v", duration.Round(time.Millisecond), err)
+			}
+			build.Log(entry)
+			build.stage = ""
+			return err
+		}
+		record.Status = StageCompleted
+		onStage(i, *record)
+		build.Log(LogEntry{Level: LogInfo, Message: fmt.Sprintf("Stage completed in %s", duration.Round(time.Millisecond)), DurationMs: duration.Milliseconds()})
+		build.stage = ""
+
+		done += weight
+	}
+
+	return nil
+}
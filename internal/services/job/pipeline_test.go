@@ -0,0 +1,204 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sawthet.go-press-server.net/internal/models"
+)
+
+// stubStage reports the given progress steps and then returns err
+type stubStage struct {
+	name   string
+	weight int
+	steps  []int
+	err    error
+}
+
+func (s stubStage) Name() string { return s.name }
+func (s stubStage) Weight() int  { return s.weight }
+
+func (s stubStage) Run(ctx context.Context, build *Build, progress ProgressFunc) error {
+	for _, step := range s.steps {
+		progress(step, s.name)
+	}
+	return s.err
+}
+
+// stageStatuses returns the name and status of every record, in order
+func stageStatuses(records []StageRecord) []string {
+	out := []string{}
+	for _, record := range records {
+		out = append(out, record.Name+" "+string(record.Status))
+	}
+	return out
+}
+
+func TestNewProjectPipeline(t *testing.T) {
+	available := []Stage{
+		stubStage{name: StageRender, weight: 1},
+		stubStage{name: StageCSS, weight: 1},
+		stubStage{name: "minify", weight: 1},
+		stubStage{name: StagePackage, weight: 1},
+	}
+
+	tests := []struct {
+		name    string
+		config  *models.BuildConfig
+		want    []string
+		err     error
+		message string
+	}{
+		{
+			name:   "no config",
+			config: nil,
+			want:   []string{"render pending", "css pending", "minify pending", "package pending"},
+		},
+		{
+			name:   "empty config",
+			config: &models.BuildConfig{},
+			want:   []string{"render pending", "css pending", "minify pending", "package pending"},
+		},
+		{
+			name:   "selected stages",
+			config: &models.BuildConfig{Stages: []string{StageRender, StagePackage}},
+			want:   []string{"render pending", "package pending"},
+		},
+		{
+			name:   "skipped stages",
+			config: &models.BuildConfig{Skip: []string{"minify", StageCSS}},
+			want:   []string{"render pending", "css skipped", "minify skipped", "package pending"},
+		},
+		{
+			name:   "skipped stage that is not selected",
+			config: &models.BuildConfig{Stages: []string{StageRender, StagePackage}, Skip: []string{StageCSS}},
+			want:   []string{"render pending", "package pending"},
+		},
+		{
+			name:    "unknown selected stage",
+			config:  &models.BuildConfig{Stages: []string{StageRender, "deploy", StagePackage}},
+			err:     ErrUnknownStage,
+			message: `"deploy"`,
+		},
+		{
+			name:    "unknown skipped stage",
+			config:  &models.BuildConfig{Skip: []string{"deploy"}},
+			err:     ErrUnknownStage,
+			message: `"deploy"`,
+		},
+		{
+			name:    "duplicate stage",
+			config:  &models.BuildConfig{Stages: []string{StageRender, StageCSS, StageCSS, StagePackage}},
+			err:     ErrInvalidStages,
+			message: "more than once",
+		},
+		{
+			name:    "stages out of order",
+			config:  &models.BuildConfig{Stages: []string{StageRender, StagePackage, StageCSS}},
+			err:     ErrInvalidStages,
+			message: `"css" must run before "package"`,
+		},
+		{
+			name:    "required stage left out",
+			config:  &models.BuildConfig{Stages: []string{StageRender, StageCSS}},
+			err:     ErrInvalidStages,
+			message: `"package" is required`,
+		},
+		{
+			name:    "required stage skipped",
+			config:  &models.BuildConfig{Skip: []string{StageRender}},
+			err:     ErrInvalidStages,
+			message: `"render" cannot be skipped`,
+		},
+	}
+
+	for _, tt := range tests {
+		pipeline, err := NewProjectPipeline(available, tt.config)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("%s: error = %v, want %v mentioning %s", tt.name, err, tt.err, tt.message)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := stageStatuses(pipeline.Records()); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: stages = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Required stages the queue does not offer are not required
+	pipeline, err := NewProjectPipeline(available[:2], &models.BuildConfig{Stages: []string{StageRender}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stageStatuses(pipeline.Records()); !reflect.DeepEqual(got, []string{"render pending"}) {
+		t.Errorf("stages without package = %v", got)
+	}
+}
+
+func TestPipelineRunWeighsProgress(t *testing.T) {
+	pipeline := NewPipeline(
+		stubStage{name: "a", weight: 3, steps: []int{0, 50, 100}},
+		stubStage{name: "b", weight: 5, steps: []int{100}},
+		stubStage{name: "c", weight: 1, steps: []int{-10, 150}},
+	)
+	pipeline.Skip("b")
+
+	var progress []int
+	var stages []string
+	err := pipeline.Run(context.Background(), &Build{}, func(p int, message string) {
+		progress = append(progress, p)
+	}, func(i int, record StageRecord) {
+		stages = append(stages, record.Name+" "+string(record.Status))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The skipped stage's weight is left out, so a counts for 3/4 of the
+	// build and c for 1/4; c's steps are clamped to 0 and 100
+	if want := []int{0, 37, 75, 75, 100}; !reflect.DeepEqual(progress, want) {
+		t.Errorf("progress = %v, want %v", progress, want)
+	}
+	if want := []string{"a running", "a completed", "c running", "c completed"}; !reflect.DeepEqual(stages, want) {
+		t.Errorf("stage updates = %v, want %v", stages, want)
+	}
+}
+
+func TestPipelineRunStopsAtFailure(t *testing.T) {
+	failure := errors.New("template error")
+	pipeline := NewPipeline(
+		stubStage{name: "a", weight: 1, err: failure},
+		stubStage{name: "b", weight: 1},
+	)
+
+	var stages []StageRecord
+	err := pipeline.Run(context.Background(), &Build{}, func(int, string) {}, func(i int, record StageRecord) {
+		stages = append(stages, record)
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Run = %v, want %v", err, failure)
+	}
+	if got := stageStatuses(stages); !reflect.DeepEqual(got, []string{"a running", "a failed"}) {
+		t.Errorf("stage updates = %v", got)
+	}
+	if stages[1].Error != failure.Error() || stages[1].FinishedAt.IsZero() {
+		t.Errorf("failed record = %+v", stages[1])
+	}
+
+	// A cancelled build does not start the next stage
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stages = nil
+	if err := NewPipeline(stubStage{name: "a", weight: 1}).Run(ctx, &Build{}, func(int, string) {}, func(i int, record StageRecord) {
+		stages = append(stages, record)
+	}); !errors.Is(err, context.Canceled) || len(stages) != 0 {
+		t.Errorf("cancelled Run = %v after %d stage updates", err, len(stages))
+	}
+}
@@ -1,16 +1,16 @@
 package job
 
 import (
-	"archive/zip"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
 	"sawthet.go-press-server.net/internal/models"
-	"sawthet.go-press-server.net/internal/services"
 	"sawthet.go-press-server.net/internal/utils"
 )
 
@@ -21,23 +21,76 @@ const (
 	StatusRunning   JobStatus = "running"
 	StatusCompleted JobStatus = "completed"
 	StatusFailed    JobStatus = "failed"
+	StatusCancelled JobStatus = "cancelled"
 )
 
+var (
+	// ErrJobNotFound is returned when no job exists with the given ID
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobFinished is returned when cancelling a job that already finished
+	ErrJobFinished = errors.New("job already finished")
+	// ErrProjectIDRequired is returned when submitting a project without an ID
+	ErrProjectIDRequired = errors.New("project ID is required")
+	// ErrQueueFull is returned when the backlog of pending jobs is at capacity
+	ErrQueueFull = errors.New("job queue is full")
+)
+
+// IsFinal reports whether a job in this status will not change any more
+func (s JobStatus) IsFinal() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCancelled
+}
+
+// ProgressUpdate is an event in a job's history, published to its
+// subscribers whenever its state changes
+type ProgressUpdate struct {
+	// Seq numbers the events of a job from 1, without gaps
+	Seq      uint64    `json:"seq"`
+	Status   JobStatus `json:"status"`
+	Progress int       `json:"progress"`
+	Message  string    `json:"message"`
+	Attempt  int       `json:"attempt,omitempty"`
+	At       time.Time `json:"at"`
+}
+
 type BuildJob struct {
-	ID           string
-	Project      models.Project
-	Status       JobStatus
-	Progress     int
-	Message      string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
-	ExpiresAt    time.Time
-	Result       *BuildResult
-	ProgressChan chan struct {
-		Status   JobStatus
-		Progress int
-		Message  string
-	}
+	ID        string
+	ProjectID string
+	Project   models.Project
+	Status    JobStatus
+	Progress  int
+	Message   string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// ExpiresAt is when a finished job is removed; it is zero until the job
+	// reaches a final status
+	ExpiresAt time.Time
+	Result    *BuildResult
+
+	Priority Priority
+	// Draft builds are previews styled by the Tailwind CDN; they skip the CSS stage
+	Draft bool
+	// QueuedAt is when the job last entered the backlog
+	QueuedAt time.Time
+	// Attempt is the number of the current (or last) attempt, starting at 1
+	Attempt int
+	Retry   RetryPolicy
+	// Interruptions counts how often a server restart cut a running build short
+	Interruptions int
+	Transitions   []StatusTransition
+	// Stages records the pipeline stages of the current (or last) attempt
+	Stages []StageRecord
+	// Pages lists the pages rebuilt and reused by the last attempt
+	Pages *PageReport
+	// Manifest describes the output of the last attempt
+	Manifest *Manifest
+	// Events is the job's progress history, oldest first
+	Events []ProgressUpdate
+	// Logs is the job's structured build log across all attempts, oldest first
+	Logs []LogEntry
+
+	// ctx is cancelled when the job is cancelled or the queue shuts down
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 type BuildResult struct {
@@ -45,228 +98,869 @@ type BuildResult struct {
 	Error   error
 }
 
+// Config configures a JobQueue
+type Config struct {
+	// Workers is the number of builds run concurrently
+	Workers int
+	// Backlog is the maximum number of pending jobs waiting for a worker
+	Backlog int
+	// Store persists jobs across restarts; nil keeps jobs in memory only
+	Store JobStore
+	// Retry is the policy given to every submitted job
+	Retry RetryPolicy
+	// Stages are the available build stages in their default order; nil
+	// uses DefaultStages
+	Stages []Stage
+	// Cache keeps the output of each project's last build for incremental
+	// builds; nil renders every page on every build
+	Cache *BuildCache
+}
+
+const (
+	DefaultWorkers = 2
+	DefaultBacklog = 100
+)
+
 type JobQueue struct {
 	jobs           map[string]*BuildJob
 	jobsMux        sync.RWMutex
 	workers        int
-	workChan       chan *BuildJob
+	backlog        int
+	pending        []*BuildJob
+	served         map[string]uint64
+	serveSeq       uint64
+	workReady      *sync.Cond
+	avgDuration    time.Duration
+	retry          RetryPolicy
+	stages         []Stage
+	cache          *BuildCache
 	ctx            context.Context
 	cancel         context.CancelFunc
 	cleanupRunning bool
+	store          JobStore
+	hub            *Hub
 	infoLog        *utils.ColoredLogger
 	errorLog       *utils.ColoredLogger
 }
 
-func NewJobQueue(workers int, infoLog, errorLog *utils.ColoredLogger) *JobQueue {
+// maxInterruptions is how many restarts a running build survives before it is
+// marked as failed instead of being queued again
+const maxInterruptions = 1
+
+// jobRetention is how long a finished job and its artifact are kept
+const jobRetention = 30 * time.Minute
+
+// defaultBuildDuration is assumed for wait estimates until a build has finished
+const defaultBuildDuration = 10 * time.Second
+
+// NewJobQueue starts a queue with the configured number of workers. Jobs
+// are persisted to and reloaded from the configured store on startup.
+func NewJobQueue(config Config, infoLog, errorLog *utils.ColoredLogger) *JobQueue {
+	if config.Workers <= 0 {
+		config.Workers = DefaultWorkers
+	}
+	if config.Backlog <= 0 {
+		config.Backlog = DefaultBacklog
+	}
+	if config.Retry.MaxAttempts <= 0 {
+		config.Retry = DefaultRetryPolicy
+	}
+	if config.Stages == nil {
+		config.Stages = DefaultStages()
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	q := &JobQueue{
-		jobs:     make(map[string]*BuildJob),
-		workers:  workers,
-		workChan: make(chan *BuildJob),
-		ctx:      ctx,
-		cancel:   cancel,
-		infoLog:  infoLog,
-		errorLog: errorLog,
+		jobs:        make(map[string]*BuildJob),
+		served:      make(map[string]uint64),
+		workers:     config.Workers,
+		backlog:     config.Backlog,
+		avgDuration: defaultBuildDuration,
+		retry:       config.Retry,
+		stages:      config.Stages,
+		cache:       config.Cache,
+		ctx:         ctx,
+		cancel:      cancel,
+		store:       config.Store,
+		hub:         NewHub(),
+		infoLog:     infoLog,
+		errorLog:    errorLog,
 	}
+	q.workReady = sync.NewCond(&q.jobsMux)
 
 	// Start worker goroutines
-	for i := 0; i < workers; i++ {
+	for i := 0; i < q.workers; i++ {
 		go q.worker()
 	}
 
+	q.restore()
+
 	return q
 }
 
-func (q *JobQueue) SubmitJob(project models.Project) string {
-	if project.ID == "" {
-		q.errorLog.Printf("Project ID is required")
-		return ""
-	}
+// newJobContext gives a job its own context derived from the queue's
+func (q *JobQueue) newJobContext(job *BuildJob) {
+	job.ctx, job.cancel = context.WithCancel(q.ctx)
+}
 
-	// Check if job exists
-	q.jobsMux.Lock()
-	existingJob, exists := q.jobs[project.ID]
-	if exists {
-		// If job is running, return error
-		if existingJob.Status == StatusRunning {
-			q.jobsMux.Unlock()
-			q.errorLog.Printf("Project %s is already being built", project.ID)
-			return ""
-		}
+// ZipPath returns where the build artifact of a job is stored
+func ZipPath(jobID string) string {
+	return filepath.Join("static", "sites", jobID+".zip")
+}
 
-		// Clean up old job files if they exist
-		jobDir := filepath.Join("static", "sites", project.ID)
-		if err := os.RemoveAll(jobDir); err != nil {
-			q.errorLog.Printf("Failed to cleanup old job directory %s: %v", jobDir, err)
-		}
+// SubmitOptions configures a submitted build
+type SubmitOptions struct {
+	// Priority is the scheduling priority; empty means normal
+	Priority Priority
+	// Draft builds a preview styled by the Tailwind CDN
+	Draft bool
+}
+
+// SubmitJob adds a build to the backlog without waiting for a worker. It
+// returns the job ID and where the scheduler placed it, or ErrQueueFull when
+// the backlog is at capacity.
+func (q *JobQueue) SubmitJob(project models.Project, options SubmitOptions) (string, Placement, error) {
+	if project.ID == "" {
+		return "", Placement{}, ErrProjectIDRequired
+	}
+	priority := options.Priority
+	if priority == "" {
+		priority = PriorityNormal
 	}
-	q.jobsMux.Unlock()
 
+	// Every build gets its own ID so that several builds of one project can
+	// run and be downloaded side by side
+	now := time.Now()
 	job := &BuildJob{
-		ID:        project.ID,
-		Project:   project,
-		Status:    StatusPending,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(30 * time.Minute),
-		ProgressChan: make(chan struct {
-			Status   JobStatus
-			Progress int
-			Message  string
-		}, 100),
+		ID:          utils.NewID(),
+		ProjectID:   project.ID,
+		Project:     project,
+		Status:      StatusPending,
+		Priority:    priority,
+		Draft:       options.Draft,
+		QueuedAt:    now,
+		Retry:       q.retry,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Transitions: []StatusTransition{{Status: StatusPending, At: now}},
 	}
+	job.addEvent(ProgressUpdate{Status: StatusPending, At: now})
+	q.newJobContext(job)
 
 	q.jobsMux.Lock()
+	if len(q.pending) >= q.backlog {
+		q.jobsMux.Unlock()
+		job.cancel()
+		return "", Placement{}, ErrQueueFull
+	}
 	q.jobs[job.ID] = job
+	q.pending = append(q.pending, job)
+	// Feeds watching the project learn about the job from its first event
+	q.hub.Publish(job.event(job.Events[0]))
+	placement, _ := q.placementOf(job.ID, now)
+	record := job.record()
+	q.workReady.Signal()
 	q.jobsMux.Unlock()
 
-	if !q.cleanupRunning {
-		q.cleanupRunning = true
-		go q.startCleanupRoutine()
+	q.persist(record)
+
+	return job.ID, placement, nil
+}
+
+// Placement returns where the scheduler currently places a pending job, or
+// false when the job is not waiting for a worker
+func (q *JobQueue) Placement(jobID string) (Placement, bool) {
+	q.jobsMux.RLock()
+	defer q.jobsMux.RUnlock()
+
+	return q.placementOf(jobID, time.Now())
+}
+
+// placementOf finds a job in the simulated run order; callers must hold jobsMux
+func (q *JobQueue) placementOf(jobID string, now time.Time) (Placement, bool) {
+	for i, job := range q.runOrder(now) {
+		if job.ID == jobID {
+			return q.placement(i+1, now), true
+		}
 	}
+	return Placement{}, false
+}
 
-	// Send to work channel
-	q.workChan <- job
+// RetryAfter estimates how long until the backlog has room for another job
+func (q *JobQueue) RetryAfter() time.Duration {
+	q.jobsMux.RLock()
+	defer q.jobsMux.RUnlock()
 
-	return job.ID
+	// A slot frees up whenever any worker finishes a build
+	return q.avgDuration / time.Duration(q.workers)
 }
 
+// GetJobStatus returns a snapshot of a job, which workers do not modify
 func (q *JobQueue) GetJobStatus(jobID string) (*BuildJob, error) {
 	q.jobsMux.RLock()
 	defer q.jobsMux.RUnlock()
 
 	job, exists := q.jobs[jobID]
 	if !exists {
-		return nil, fmt.Errorf("job not found")
+		return nil, ErrJobNotFound
+	}
+
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// Subscribe returns a snapshot of a job, the events a client should be sent
+// first and a subscription to every later event, including the lines later
+// added to its log when logs is set. When resuming, the first events are
+// those after sequence number since; otherwise it is the job's current state.
+// The subscription to a finished job is closed already; callers must
+// Unsubscribe when they stop reading.
+func (q *JobQueue) Subscribe(jobID string, since uint64, resume, logs bool) (BuildJob, []Event, *Subscription, error) {
+	q.jobsMux.RLock()
+	defer q.jobsMux.RUnlock()
+
+	job, exists := q.jobs[jobID]
+	if !exists {
+		return BuildJob{}, nil, nil, ErrJobNotFound
+	}
+
+	sub := q.hub.Subscribe(jobID, logs)
+	if job.Status.IsFinal() {
+		sub.Unsubscribe()
+	}
+	return *job, job.startEvents(since, resume), sub, nil
+}
+
+// NewFeed returns a subscription for watching any number of jobs and
+// projects, added with WatchJob and WatchProject; callers must Unsubscribe
+// when they stop reading
+func (q *JobQueue) NewFeed() *Subscription {
+	return q.hub.Feed()
+}
+
+// WatchJob adds a job to a feed, and the lines later added to its log when
+// logs is set. The events a client should be sent first (see Subscribe) are
+// queued on the feed ahead of the job's later events.
+func (q *JobQueue) WatchJob(feed *Subscription, jobID string, since uint64, resume, logs bool) error {
+	q.jobsMux.RLock()
+	defer q.jobsMux.RUnlock()
+
+	job, exists := q.jobs[jobID]
+	if !exists {
+		return ErrJobNotFound
+	}
+
+	q.hub.watch(feed, jobTopic(jobID), job.startEvents(since, resume), !job.Status.IsFinal(), logs)
+	return nil
+}
+
+// maxProjectBacklog bounds how many of a project's existing jobs are
+// replayed to a feed that starts watching it, so a long history cannot
+// overflow the feed
+const maxProjectBacklog = 100
+
+// WatchProject adds all current and future jobs of a project to a feed, and
+// the lines later added to their logs when logs is set. The current state of
+// its most recent jobs is queued on the feed first, oldest job first.
+func (q *JobQueue) WatchProject(feed *Subscription, projectID string, logs bool) {
+	q.jobsMux.RLock()
+	defer q.jobsMux.RUnlock()
+
+	var jobs []*BuildJob
+	for _, job := range q.jobs {
+		if job.ProjectID == projectID {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	if len(jobs) > maxProjectBacklog {
+		jobs = jobs[len(jobs)-maxProjectBacklog:]
+	}
+
+	var backlog []Event
+	for _, job := range jobs {
+		backlog = append(backlog, job.startEvents(0, false)...)
+	}
+	q.hub.watch(feed, projectTopic(projectID), backlog, true, logs)
+}
+
+// Logs returns a page of a job's build log
+func (q *JobQueue) Logs(jobID string, query LogQuery) (LogPage, error) {
+	q.jobsMux.RLock()
+	defer q.jobsMux.RUnlock()
+
+	job, exists := q.jobs[jobID]
+	if !exists {
+		return LogPage{}, ErrJobNotFound
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultLogLimit
+	}
+	return job.logPage(query, min(limit, MaxLogLimit)), nil
+}
+
+// FollowLogs returns every line of a job's log selected by the query, ignoring
+// its limit, and a subscription to the lines added later; the subscription
+// ends with the job and is closed already for a finished job. Lines on the
+// subscription are not filtered. Callers must Unsubscribe when they stop
+// reading.
+func (q *JobQueue) FollowLogs(jobID string, query LogQuery) (LogPage, *Subscription, error) {
+	q.jobsMux.RLock()
+	defer q.jobsMux.RUnlock()
+
+	job, exists := q.jobs[jobID]
+	if !exists {
+		return LogPage{}, nil, ErrJobNotFound
+	}
+
+	sub := q.hub.SubscribeLogs(jobID)
+	if job.Status.IsFinal() {
+		sub.Unsubscribe()
+	}
+	return job.logPage(query, maxJobLogs), sub, nil
+}
+
+// CancelJob stops a pending or running job and returns its status afterwards.
+// Pending jobs are cancelled immediately; running jobs keep running until
+// their build pipeline notices the cancellation.
+func (q *JobQueue) CancelJob(jobID string) (JobStatus, error) {
+	// Check and act under one lock, so the job cannot start or finish in
+	// between
+	q.jobsMux.Lock()
+	job, exists := q.jobs[jobID]
+	if !exists {
+		q.jobsMux.Unlock()
+		return "", ErrJobNotFound
+	}
+	status := job.Status
+	if status.IsFinal() {
+		q.jobsMux.Unlock()
+		return status, ErrJobFinished
+	}
+
+	job.cancel()
+	if status != StatusPending {
+		q.jobsMux.Unlock()
+		return status, nil
+	}
+
+	q.removePending(job)
+	record, _ := q.setStatus(job, StatusCancelled, 0, "Build cancelled")
+	q.jobsMux.Unlock()
+
+	q.persist(record)
+	return StatusCancelled, nil
+}
+
+// ListProjectJobs returns snapshots of all jobs for a project, newest first
+func (q *JobQueue) ListProjectJobs(projectID string) []BuildJob {
+	q.jobsMux.RLock()
+	defer q.jobsMux.RUnlock()
+
+	jobs := []BuildJob{}
+	for _, job := range q.jobs {
+		if job.ProjectID == projectID {
+			jobs = append(jobs, *job)
+		}
 	}
 
-	return job, nil
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+
+	return jobs
 }
 
 func (q *JobQueue) worker() {
-	for job := range q.workChan {
+	for {
+		job := q.nextJob()
+		if job == nil {
+			return
+		}
+
+		// Skip jobs cancelled while waiting in the queue
+		if job.ctx.Err() != nil {
+			continue
+		}
+
+		started := time.Now()
 		q.processJob(job)
+		q.recordDuration(time.Since(started))
+	}
+}
+
+// nextJob blocks until a pending job is available, returning nil once the
+// queue shuts down
+func (q *JobQueue) nextJob() *BuildJob {
+	q.jobsMux.Lock()
+	defer q.jobsMux.Unlock()
+
+	for len(q.pending) == 0 && q.ctx.Err() == nil {
+		q.workReady.Wait()
+	}
+	if q.ctx.Err() != nil {
+		return nil
+	}
+
+	i := pickNext(q.pending, q.served, time.Now())
+	job := q.pending[i]
+	q.pending = append(q.pending[:i], q.pending[i+1:]...)
+
+	q.serveSeq++
+	q.served[job.ProjectID] = q.serveSeq
+	return job
+}
+
+// removePending drops a job from the backlog; callers must hold jobsMux
+func (q *JobQueue) removePending(job *BuildJob) {
+	for i, pending := range q.pending {
+		if pending == job {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// recordDuration folds a finished build's duration into the moving average
+// used for wait estimates
+func (q *JobQueue) recordDuration(duration time.Duration) {
+	q.jobsMux.Lock()
+	defer q.jobsMux.Unlock()
+
+	q.avgDuration = (q.avgDuration*4 + duration) / 5
+}
+
+// abortIfCancelled reports whether a job's context is done. Cancelled jobs are
+// marked as such; jobs stopped by a shutdown keep their running status so
+// they are recovered on the next start.
+func (q *JobQueue) abortIfCancelled(job *BuildJob, progress int) bool {
+	if job.ctx.Err() == nil {
+		return false
+	}
+	if q.ctx.Err() == nil {
+		q.updateJobStatus(job, StatusCancelled, progress, "Build cancelled")
 	}
+	return true
 }
 
 func (q *JobQueue) processJob(job *BuildJob) {
-	q.updateJobStatus(job, StatusRunning, 0, "Starting build process...")
+	q.jobsMux.Lock()
+	job.Attempt++
+	attempt := job.Attempt
+	q.jobsMux.Unlock()
 
-	// Initialize services
-	templateService, err := services.NewTemplateService()
-	if err != nil {
-		q.updateJobStatus(job, StatusFailed, 0, fmt.Sprintf("Failed to initialize template service: %v", err))
-		return
+	message := "Starting build process..."
+	if attempt > 1 {
+		message = fmt.Sprintf("Starting build process (attempt %d of %d)...", attempt, job.Retry.MaxAttempts)
 	}
+	q.updateJobStatus(job, StatusRunning, 0, message)
 
-	cssCompiler, err := services.NewCSSCompiler()
-	if err != nil {
-		q.updateJobStatus(job, StatusFailed, 0, fmt.Sprintf("Failed to initialize CSS compiler: %v", err))
+	started := time.Now()
+	err := q.build(job)
+	if err == nil {
+		q.log(job, LogEntry{
+			Level:      LogInfo,
+			Message:    fmt.Sprintf("Build completed in %s", time.Since(started).Round(time.Millisecond)),
+			DurationMs: time.Since(started).Milliseconds(),
+		})
+		q.updateJobStatus(job, StatusCompleted, 100, "Build completed successfully!")
 		return
 	}
-	defer cssCompiler.Cleanup()
 
-	// Generate HTML
-	q.updateJobStatus(job, StatusRunning, 25, "Starting HTML generation...")
-	htmlFiles, err := templateService.GenerateHTML(job.Project, func(progress int, message string) {
-		q.updateJobStatus(job, StatusRunning, 25+progress/2, message)
-	})
-	if err != nil {
-		q.updateJobStatus(job, StatusFailed, 25, fmt.Sprintf("Failed to generate HTML: %v", err))
-		return
+	// Never leave a partial artifact behind
+	if err := os.Remove(ZipPath(job.ID)); err != nil && !os.IsNotExist(err) {
+		q.errorLog.Printf("Failed to remove partial zip file for job %s: %v", job.ID, err)
 	}
 
-	// Compile CSS
-	q.updateJobStatus(job, StatusRunning, 75, "Compiling CSS...")
+	q.jobsMux.RLock()
+	progress := job.Progress
+	q.jobsMux.RUnlock()
 
-	// Combine all HTML content for CSS compilation
-	var combinedHTML []byte
-	for _, content := range htmlFiles {
-		combinedHTML = append(combinedHTML, content...)
+	if q.abortIfCancelled(job, progress) {
+		return
 	}
 
-	// Compile minified CSS
-	cssContent, err := cssCompiler.Compile(combinedHTML, job.Project)
-	if err != nil {
-		q.updateJobStatus(job, StatusFailed, 75, fmt.Sprintf("Failed to compile CSS: %v", err))
+	if IsRetryable(err) && attempt < job.Retry.MaxAttempts {
+		delay := job.Retry.Backoff(attempt)
+		q.log(job, LogEntry{Level: LogWarn, Message: fmt.Sprintf("Attempt %d failed, retrying in %s: %v", attempt, delay, err)})
+		q.updateJobStatus(job, StatusPending, 0, fmt.Sprintf("Attempt %d of %d failed: %v. Retrying in %s...", attempt, job.Retry.MaxAttempts, err, delay))
+		time.AfterFunc(delay, func() {
+			q.requeue(job)
+		})
 		return
 	}
 
-	// Create sites directory if it doesn't exist
-	sitesDir := filepath.Join("static", "sites")
-	if err := os.MkdirAll(sitesDir, 0755); err != nil {
-		q.updateJobStatus(job, StatusFailed, 75, fmt.Sprintf("Failed to create sites directory: %v", err))
+	q.log(job, LogEntry{Level: LogError, Message: fmt.Sprintf("Build failed: %v", err)})
+	q.updateJobStatus(job, StatusFailed, progress, err.Error())
+}
+
+// requeue puts a job that is waiting for a retry back into the backlog
+func (q *JobQueue) requeue(job *BuildJob) {
+	q.jobsMux.Lock()
+	defer q.jobsMux.Unlock()
+
+	if job.ctx.Err() != nil || job.Status != StatusPending {
 		return
 	}
+	job.QueuedAt = time.Now()
+	q.pending = append(q.pending, job)
+	q.workReady.Signal()
+}
 
-	// Create zip file directly in sites directory
-	zipPath := filepath.Join(sitesDir, job.ID+".zip")
-	zipFile, err := os.Create(zipPath)
+// Pipeline returns the build pipeline the queue would run for a project
+func (q *JobQueue) Pipeline(project models.Project) (*Pipeline, error) {
+	return NewProjectPipeline(q.stages, project.Build)
+}
+
+// build runs the project's pipeline for a job, keeping the stage records on
+// the job up to date. Failures of the build infrastructure, such as the
+// tailwind process or the disk, are marked Transient by the stages so the
+// job can be retried; failures caused by the project itself are not.
+func (q *JobQueue) build(job *BuildJob) error {
+	pipeline, err := q.Pipeline(job.Project)
 	if err != nil {
-		q.updateJobStatus(job, StatusFailed, 75, fmt.Sprintf("Failed to create zip file: %v", err))
-		return
+		return fmt.Errorf("Failed to plan build: %w", err)
+	}
+	if job.Draft {
+		// Draft pages are styled in the browser
+		pipeline.Skip(StageCSS)
 	}
-	defer zipFile.Close()
 
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+	q.jobsMux.Lock()
+	job.Stages = pipeline.Records()
+	q.jobsMux.Unlock()
 
-	// Add all HTML files to zip
-	for filename, content := range htmlFiles {
-		htmlWriter, err := zipWriter.Create(filename)
-		if err != nil {
-			q.updateJobStatus(job, StatusFailed, 75, fmt.Sprintf("Failed to create HTML entry in zip: %v", err))
-			return
-		}
-		if _, err := htmlWriter.Write(content); err != nil {
-			q.updateJobStatus(job, StatusFailed, 75, fmt.Sprintf("Failed to write HTML to zip: %v", err))
-			return
-		}
+	build := &Build{
+		JobID:   job.ID,
+		Project: job.Project,
+		Draft:   job.Draft,
+		Cache:   q.cache,
+		onLog: func(entry LogEntry) {
+			q.log(job, entry)
+		},
 	}
+	err = pipeline.Run(job.ctx, build, func(progress int, message string) {
+		q.updateJobStatus(job, StatusRunning, progress, message)
+	}, func(i int, record StageRecord) {
+		q.updateStage(job, i, record)
+	})
+
+	q.jobsMux.Lock()
+	job.Pages = &build.Report
+	job.Manifest = &build.Manifest
+	q.jobsMux.Unlock()
 
-	// Add CSS directory and file to zip
-	cssWriter, err := zipWriter.Create("css/styles.css")
 	if err != nil {
-		q.updateJobStatus(job, StatusFailed, 75, fmt.Sprintf("Failed to create CSS entry in zip: %v", err))
-		return
+		return err
+	}
+
+	// Only a successful build becomes the base of the next incremental build
+	if err := build.RetainCache(); err != nil {
+		q.errorLog.Printf("Failed to prune build cache of project %s: %v", job.ProjectID, err)
 	}
-	if _, err := cssWriter.Write(cssContent); err != nil {
-		q.updateJobStatus(job, StatusFailed, 75, fmt.Sprintf("Failed to write CSS to zip: %v", err))
+	return nil
+}
+
+// updateStage stores the latest record of a pipeline stage on a job. Finished
+// stages are persisted so their timing and logs survive restarts.
+func (q *JobQueue) updateStage(job *BuildJob, i int, record StageRecord) {
+	q.jobsMux.Lock()
+	// A removed job is not persisted again
+	if i >= len(job.Stages) || q.jobs[job.ID] != job {
+		q.jobsMux.Unlock()
 		return
 	}
 
-	// Update job status
-	q.updateJobStatus(job, StatusCompleted, 100, "Build completed successfully!")
+	// Copy on write, as snapshots handed out by the queue share the slice
+	stages := append([]StageRecord(nil), job.Stages...)
+	stages[i] = record
+	job.Stages = stages
+	snapshot := job.record()
+	q.jobsMux.Unlock()
+
+	if record.Status != StageRunning {
+		q.persist(snapshot)
+	}
 }
 
 func (q *JobQueue) updateJobStatus(job *BuildJob, status JobStatus, progress int, message string) {
 	q.jobsMux.Lock()
-	defer q.jobsMux.Unlock()
+	record, transition := q.setStatus(job, status, progress, message)
+	q.jobsMux.Unlock()
 
+	if transition {
+		q.persist(record)
+	}
+}
+
+// setStatus moves a job to a status and publishes the change. It returns the
+// job's record to persist and whether the status changed; only status
+// changes are persisted, as progress within a status is persisted with the
+// next change. Callers must hold jobsMux.
+func (q *JobQueue) setStatus(job *BuildJob, status JobStatus, progress int, message string) (JobRecord, bool) {
+	// A finished job never changes again, e.g. a cancelled job whose worker
+	// picked it up just before the cancellation
+	if job.Status.IsFinal() {
+		return JobRecord{}, false
+	}
+
+	transition := job.Status != status
 	job.Status = status
 	job.Progress = progress
 	job.Message = message
 	job.UpdatedAt = time.Now()
+	if transition {
+		job.Transitions = append(job.Transitions, StatusTransition{Status: status, Message: message, At: job.UpdatedAt})
+	}
+
+	// Jobs only expire once they are finished, so live jobs are never
+	// removed from under their workers
+	if status.IsFinal() {
+		job.ExpiresAt = job.UpdatedAt.Add(jobRetention)
+		q.scheduleCleanup()
+	}
+
+	// Publish while holding the lock so Subscribe sees each event either in
+	// its snapshot or on its subscription, never both or neither
+	event := job.addEvent(ProgressUpdate{
+		Status:   status,
+		Progress: progress,
+		Message:  message,
+		Attempt:  job.Attempt,
+		At:       job.UpdatedAt,
+	})
+	q.hub.Publish(job.event(event))
+
+	if !transition {
+		return JobRecord{}, false
+	}
+	return job.record(), true
+}
+
+// log adds a line to a job's build log and publishes it to the log's
+// subscribers. The log is persisted with the job's next record.
+func (q *JobQueue) log(job *BuildJob, entry LogEntry) {
+	q.jobsMux.Lock()
+	defer q.jobsMux.Unlock()
+
+	if entry.At.IsZero() {
+		entry.At = time.Now()
+	}
+	entry.Attempt = job.Attempt
+	q.hub.Publish(job.logEvent(job.addLog(entry)))
+}
+
+// record returns the persisted form of a job; callers must hold jobsMux. A
+// live job's record keeps only its latest event and log line, which carry
+// the sequence numbers to continue from after a restart, so saving it costs
+// the same however much the job has logged; the whole history is written
+// once the job finishes.
+func (job *BuildJob) record() JobRecord {
+	events, logs := job.Events, job.Logs
+	if !job.Status.IsFinal() {
+		if n := len(events); n > 1 {
+			events = events[n-1:]
+		}
+		if n := len(logs); n > 1 {
+			logs = logs[n-1:]
+		}
+	}
+
+	return JobRecord{
+		ID:            job.ID,
+		ProjectID:     job.ProjectID,
+		Project:       job.Project,
+		Status:        job.Status,
+		Progress:      job.Progress,
+		Message:       job.Message,
+		CreatedAt:     job.CreatedAt,
+		UpdatedAt:     job.UpdatedAt,
+		ExpiresAt:     job.ExpiresAt,
+		Attempt:       job.Attempt,
+		Priority:      job.Priority,
+		Draft:         job.Draft,
+		Retry:         job.Retry,
+		Interruptions: job.Interruptions,
+		Transitions:   append([]StatusTransition(nil), job.Transitions...),
+		Stages:        append([]StageRecord(nil), job.Stages...),
+		Pages:         job.Pages,
+		Manifest:      job.Manifest,
+		Events:        append([]ProgressUpdate(nil), events...),
+		Logs:          append([]LogEntry(nil), logs...),
+	}
+}
+
+// persist saves a job record when the queue has a store
+func (q *JobQueue) persist(record JobRecord) {
+	if q.store == nil {
+		return
+	}
+	if err := q.store.Save(record); err != nil {
+		q.errorLog.Printf("Failed to persist job %s: %v", record.ID, err)
+	}
+}
+
+// restore reloads persisted jobs after a restart. Finished jobs are kept
+// until they expire, pending jobs are queued again, and jobs interrupted
+// while running are retried up to maxInterruptions times before failing.
+func (q *JobQueue) restore() {
+	if q.store == nil {
+		return
+	}
+
+	// Corrupt records have been set aside; every other job is restored
+	records, err := q.store.LoadAll()
+	if err != nil {
+		q.errorLog.Printf("Failed to load persisted jobs: %v", err)
+		if !errors.Is(err, ErrCorruptJob) {
+			return
+		}
+	}
+
+	// Re-queue in submission order
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+
+	now := time.Now()
+	var requeue []*BuildJob
+
+	q.jobsMux.Lock()
+	for _, record := range records {
+		if record.Status.IsFinal() && now.After(record.ExpiresAt) {
+			q.removeJob(record.ID)
+			continue
+		}
+
+		job := &BuildJob{
+			ID:            record.ID,
+			ProjectID:     record.ProjectID,
+			Project:       record.Project,
+			Status:        record.Status,
+			Progress:      record.Progress,
+			Message:       record.Message,
+			CreatedAt:     record.CreatedAt,
+			UpdatedAt:     record.UpdatedAt,
+			ExpiresAt:     record.ExpiresAt,
+			Attempt:       record.Attempt,
+			Priority:      record.Priority,
+			Draft:         record.Draft,
+			QueuedAt:      record.UpdatedAt,
+			Retry:         record.Retry,
+			Interruptions: record.Interruptions,
+			Transitions:   record.Transitions,
+			Stages:        record.Stages,
+			Pages:         record.Pages,
+			Manifest:      record.Manifest,
+			Events:        record.Events,
+			Logs:          record.Logs,
+		}
+		q.newJobContext(job)
+
+		// Records written before retries and priorities existed have neither
+		if job.Retry.MaxAttempts <= 0 {
+			job.Retry = q.retry
+		}
+		if job.Priority == "" {
+			job.Priority = PriorityNormal
+		}
+
+		switch job.Status {
+		case StatusRunning:
+			job.Interruptions++
+			if job.Interruptions > maxInterruptions {
+				job.Status = StatusFailed
+				job.Message = "Build interrupted by server restart"
+				job.ExpiresAt = now.Add(jobRetention)
+			} else {
+				job.Status = StatusPending
+				job.Progress = 0
+				job.Message = "Re-queued after server restart"
+				job.QueuedAt = now
+				requeue = append(requeue, job)
+			}
+			job.UpdatedAt = now
+			job.Transitions = append(job.Transitions, StatusTransition{Status: job.Status, Message: job.Message, At: now})
+			job.addEvent(ProgressUpdate{Status: job.Status, Message: job.Message, Attempt: job.Attempt, At: now})
+			q.persist(job.record())
+		case StatusPending:
+			requeue = append(requeue, job)
+		}
 
-	// Send update to channel (blocking)
-	job.ProgressChan <- struct {
-		Status   JobStatus
-		Progress int
-		Message  string
-	}{status, progress, message}
+		q.jobs[job.ID] = job
+	}
+	restored := len(q.jobs)
+
+	// Restored jobs were accepted before the restart, so they may exceed the backlog
+	q.pending = append(q.pending, requeue...)
+	q.workReady.Broadcast()
+
+	if restored > 0 {
+		q.scheduleCleanup()
+	}
+	q.jobsMux.Unlock()
+
+	if restored > 0 {
+		q.infoLog.Printf("Restored %d jobs (%d re-queued)", restored, len(requeue))
+	}
+}
+
+// removeJob deletes a job's artifact and persisted record; callers must hold
+// jobsMux. A live job is cancelled first, so its worker stops and its
+// subscribers receive a final event.
+func (q *JobQueue) removeJob(id string) {
+	if job, exists := q.jobs[id]; exists {
+		q.removePending(job)
+		if !job.Status.IsFinal() {
+			job.cancel()
+			q.setStatus(job, StatusCancelled, job.Progress, "Build removed")
+		}
+	}
+	delete(q.jobs, id)
+
+	zipPath := ZipPath(id)
+	if err := os.Remove(zipPath); err != nil && !os.IsNotExist(err) {
+		q.errorLog.Printf("Failed to cleanup zip file %s: %v", zipPath, err)
+	}
+
+	if q.store != nil {
+		if err := q.store.Delete(id); err != nil {
+			q.errorLog.Printf("Failed to delete job record %s: %v", id, err)
+		}
+	}
+}
+
+// scheduleCleanup starts the cleanup routine unless it is already running;
+// callers must hold jobsMux
+func (q *JobQueue) scheduleCleanup() {
+	if q.cleanupRunning || q.ctx.Err() != nil {
+		return
+	}
+	q.cleanupRunning = true
+	go q.startCleanupRoutine()
 }
 
-// startCleanupRoutine runs a background routine to clean up expired jobs
+// startCleanupRoutine runs a background routine to clean up expired jobs. It
+// stops when no finished job is left to expire.
 func (q *JobQueue) startCleanupRoutine() {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
 
 	for {
-		// Get the next expiration time
+		// Get the next expiration time, stopping under the lock so a job
+		// finishing meanwhile starts a new routine
+		q.jobsMux.Lock()
 		nextExpiration := q.getNextExpirationTime()
-
 		if nextExpiration.IsZero() {
 			q.cleanupRunning = false
+		}
+		q.jobsMux.Unlock()
+
+		if nextExpiration.IsZero() {
 			return
 		}
 
@@ -282,7 +976,9 @@ func (q *JobQueue) startCleanupRoutine() {
 			case <-ticker.C:
 				q.cleanupExpiredJobs()
 			case <-q.ctx.Done():
+				q.jobsMux.Lock()
 				q.cleanupRunning = false
+				q.jobsMux.Unlock()
 				return
 			}
 		} else {
@@ -291,17 +987,14 @@ func (q *JobQueue) startCleanupRoutine() {
 	}
 }
 
-// getNextExpirationTime returns the earliest expiration time among all jobs
+// getNextExpirationTime returns the earliest expiration time among finished
+// jobs, or zero when there is none; callers must hold jobsMux
 func (q *JobQueue) getNextExpirationTime() time.Time {
-	q.jobsMux.RLock()
-	defer q.jobsMux.RUnlock()
-
-	if len(q.jobs) == 0 {
-		return time.Time{}
-	}
-
 	var nextExpiration time.Time
 	for _, job := range q.jobs {
+		if !job.Status.IsFinal() {
+			continue
+		}
 		if nextExpiration.IsZero() || job.ExpiresAt.Before(nextExpiration) {
 			nextExpiration = job.ExpiresAt
 		}
@@ -309,7 +1002,7 @@ func (q *JobQueue) getNextExpirationTime() time.Time {
 	return nextExpiration
 }
 
-// cleanupExpiredJobs removes jobs that have expired
+// cleanupExpiredJobs removes finished jobs that have expired
 func (q *JobQueue) cleanupExpiredJobs() {
 	q.jobsMux.Lock()
 	defer q.jobsMux.Unlock()
@@ -317,23 +1010,26 @@ func (q *JobQueue) cleanupExpiredJobs() {
 	now := time.Now()
 
 	for id, job := range q.jobs {
-		if now.After(job.ExpiresAt) {
-			// Remove job from memory
-			delete(q.jobs, id)
-
-			// Remove zip file from disk
-			zipPath := filepath.Join("static", "sites", id+".zip")
-			if err := os.Remove(zipPath); err != nil {
-				q.errorLog.Printf("Failed to cleanup zip file %s: %v", zipPath, err)
-			}
+		if job.Status.IsFinal() && now.After(job.ExpiresAt) {
+			// Remove job from memory, its zip file and persisted record
+			q.removeJob(id)
 		}
 	}
 }
 
-// CleanupAllJobs stops the cleanup routine and removes all jobs
-func (q *JobQueue) CleanupAllJobs() {
-	// Stop the cleanup routine
+// Shutdown stops the cleanup routine. With a store, job records and build
+// artifacts are kept so they are served again after a restart; without one,
+// they are removed since nothing could ever reference them again.
+func (q *JobQueue) Shutdown() {
+	// Stop the cleanup routine and idle workers
 	q.cancel()
+	q.jobsMux.Lock()
+	q.workReady.Broadcast()
+	q.jobsMux.Unlock()
+
+	if q.store != nil {
+		return
+	}
 
 	// Remove all zip files
 	sitesDir := filepath.Join("static", "sites")
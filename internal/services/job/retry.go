@@ -0,0 +1,64 @@
+package job
+
+import (
+	"errors"
+	"time"
+)
+
+// RetryPolicy controls how often and how quickly failed builds are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int `json:"maxAttempts"`
+	// InitialBackoff is the delay before the second attempt
+	InitialBackoff time.Duration `json:"initialBackoff"`
+	// MaxBackoff caps the exponentially growing delay between attempts
+	MaxBackoff time.Duration `json:"maxBackoff"`
+}
+
+// DefaultRetryPolicy retries transient failures twice, after 2s and 4s
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 2 * time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+// Backoff returns the delay before the attempt following the given one
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return min(delay, p.MaxBackoff)
+}
+
+// transientError marks a failure caused by the build infrastructure, such as
+// a crashed node process or a disk error, rather than by the project itself
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transientError) Unwrap() error {
+	return e.err
+}
+
+// Transient marks err as worth retrying
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientError{err: err}
+}
+
+// IsRetryable reports whether err was marked as transient. Anything else,
+// such as a template execution error, fails the same way on every attempt.
+func IsRetryable(err error) bool {
+	var transient *transientError
+	return errors.As(err, &transient)
+}
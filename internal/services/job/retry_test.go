@@ -0,0 +1,186 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/services"
+	"sawthet.go-press-server.net/internal/utils"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{100, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+
+	// The initial delay is capped too
+	capped := RetryPolicy{InitialBackoff: time.Minute, MaxBackoff: time.Second}
+	if got := capped.Backoff(1); got != time.Second {
+		t.Errorf("Backoff(1) above the cap = %s, want 1s", got)
+	}
+	if got := DefaultRetryPolicy.Backoff(1) + DefaultRetryPolicy.Backoff(2); got != 6*time.Second {
+		t.Errorf("default policy waits %s in total, want 6s", got)
+	}
+}
+
+func TestTransient(t *testing.T) {
+	if Transient(nil) != nil {
+		t.Error("Transient(nil) is not nil")
+	}
+
+	cause := errors.New("node crashed")
+	err := Transient(cause)
+	if !errors.Is(err, cause) || err.Error() != cause.Error() {
+		t.Errorf("Transient(%v) = %v, want the error unchanged", cause, err)
+	}
+
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err, true},
+		{fmt.Errorf("stage css: %w", err), true},
+		{cause, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrorRetriesOnlyToolchainFailures(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("%w: tailwind exited", services.ErrCSSToolchain), true},
+		{context.DeadlineExceeded, true},
+		{errors.New("unknown utility class"), false},
+		{context.Canceled, false},
+	}
+	for _, tt := range tests {
+		err := compileError(tt.err)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("compileError(%v) = %v, want it wrapped", tt.err, err)
+		}
+		if got := IsRetryable(err); got != tt.want {
+			t.Errorf("compileError(%v) retryable = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+// failStage fails every build with err, counting the builds it runs
+type failStage struct {
+	err  error
+	runs *atomic.Int32
+}
+
+func (s failStage) Name() string { return "fail" }
+func (s failStage) Weight() int  { return 1 }
+
+func (s failStage) Run(ctx context.Context, build *Build, progress ProgressFunc) error {
+	s.runs.Add(1)
+	return s.err
+}
+
+func TestQueueRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		attempts int32
+	}{
+		{"transient failure", Transient(errors.New("disk full")), 3},
+		{"project failure", errors.New("template error"), 1},
+	}
+	for _, tt := range tests {
+		stage := failStage{err: tt.err, runs: new(atomic.Int32)}
+		logger := utils.NewColoredLogger("TEST", "")
+		q := NewJobQueue(Config{
+			Workers: 1,
+			Stages:  []Stage{stage},
+			Retry:   RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		}, logger, logger)
+
+		jobID, _, err := q.SubmitJob(models.Project{ID: "p"}, SubmitOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitForStatus(t, q, jobID, StatusFailed)
+
+		job, _ := q.GetJobStatus(jobID)
+		if runs := stage.runs.Load(); runs != tt.attempts || job.Attempt != int(tt.attempts) {
+			t.Errorf("%s: ran %d times over %d attempts, want %d", tt.name, runs, job.Attempt, tt.attempts)
+		}
+		retries := 0
+		for _, entry := range job.Logs {
+			if entry.Level == LogWarn {
+				retries++
+			}
+		}
+		if retries != int(tt.attempts)-1 {
+			t.Errorf("%s: logged %d retries, want %d", tt.name, retries, tt.attempts-1)
+		}
+		q.Shutdown()
+	}
+}
+
+func TestCancelWhileWaitingForRetry(t *testing.T) {
+	stage := failStage{err: Transient(errors.New("disk full")), runs: new(atomic.Int32)}
+	backoff := 50 * time.Millisecond
+	logger := utils.NewColoredLogger("TEST", "")
+	q := NewJobQueue(Config{
+		Workers: 1,
+		Stages:  []Stage{stage},
+		Retry:   RetryPolicy{MaxAttempts: 3, InitialBackoff: backoff, MaxBackoff: backoff},
+	}, logger, logger)
+	defer q.Shutdown()
+
+	jobID, _, err := q.SubmitJob(models.Project{ID: "p"}, SubmitOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait until the first attempt failed and the job waits for the next
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, _ := q.GetJobStatus(jobID)
+		if job.Attempt == 1 && job.Status == StatusPending {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job is %s after %d attempts, want waiting for a retry", job.Status, job.Attempt)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if status, err := q.CancelJob(jobID); err != nil || status != StatusCancelled {
+		t.Fatalf("CancelJob = %s, %v; want %s", status, err, StatusCancelled)
+	}
+
+	// The pending retry does not run the job again
+	time.Sleep(3 * backoff)
+	job, _ := q.GetJobStatus(jobID)
+	if runs := stage.runs.Load(); runs != 1 || job.Status != StatusCancelled {
+		t.Errorf("cancelled job ran %d times and is %s, want 1 run and %s", runs, job.Status, StatusCancelled)
+	}
+}
@@ -0,0 +1,143 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Priority tells the scheduler how urgently a build is needed
+type Priority string
+
+const (
+	// PriorityInteractive is for builds a user is waiting on, such as previews
+	PriorityInteractive Priority = "interactive"
+	// PriorityNormal is used when a submission does not ask for a priority
+	PriorityNormal Priority = "normal"
+	// PriorityBackground is for builds nobody is watching, such as scheduled publishes
+	PriorityBackground Priority = "background"
+)
+
+// ErrInvalidPriority is returned when parsing an unknown priority
+var ErrInvalidPriority = errors.New("invalid priority")
+
+// agingInterval is how long a job waits before it is scheduled as if it had
+// the next higher priority, so background builds are never starved
+const agingInterval = time.Minute
+
+// ParsePriority converts a priority name, defaulting to PriorityNormal when
+// the name is empty
+func ParsePriority(name string) (Priority, error) {
+	switch Priority(name) {
+	case "":
+		return PriorityNormal, nil
+	case PriorityInteractive, PriorityNormal, PriorityBackground:
+		return Priority(name), nil
+	}
+	return "", fmt.Errorf("%w %q: must be %s, %s or %s", ErrInvalidPriority, name, PriorityInteractive, PriorityNormal, PriorityBackground)
+}
+
+// level ranks priorities; higher levels are scheduled first
+func (p Priority) level() int {
+	switch p {
+	case PriorityInteractive:
+		return 2
+	case PriorityBackground:
+		return 0
+	}
+	return 1
+}
+
+// Placement is the scheduler's decision for a pending job
+type Placement struct {
+	// Position is the job's place in the run order (1 runs next)
+	Position int
+	// EstimatedStart is when a worker is expected to pick the job up
+	EstimatedStart time.Time
+}
+
+// effectiveLevel is a job's priority level raised by one for every
+// agingInterval it has been waiting
+func effectiveLevel(job *BuildJob, now time.Time) int {
+	level := job.Priority.level() + int(now.Sub(job.QueuedAt)/agingInterval)
+	return min(level, PriorityInteractive.level())
+}
+
+// pickNext chooses the job to run next. The highest effective priority wins;
+// among equal priorities the project that was served least recently goes
+// first, so one project submitting many builds cannot starve the others.
+// Within a project, jobs run in the order they were queued.
+func pickNext(pending []*BuildJob, served map[string]uint64, now time.Time) int {
+	best := -1
+	var bestLevel int
+	for i, job := range pending {
+		level := effectiveLevel(job, now)
+		if best == -1 {
+			best, bestLevel = i, level
+			continue
+		}
+
+		current := pending[best]
+		switch {
+		case level != bestLevel:
+			if level < bestLevel {
+				continue
+			}
+		case served[job.ProjectID] != served[current.ProjectID]:
+			if served[job.ProjectID] > served[current.ProjectID] {
+				continue
+			}
+		case !job.QueuedAt.Before(current.QueuedAt):
+			continue
+		}
+		best, bestLevel = i, level
+	}
+	return best
+}
+
+// runOrder simulates the scheduler over the current backlog and returns the
+// order in which the pending jobs will be picked; callers must hold jobsMux
+func (q *JobQueue) runOrder(now time.Time) []*BuildJob {
+	pending := append([]*BuildJob(nil), q.pending...)
+	served := make(map[string]uint64, len(q.served))
+	for projectID, seq := range q.served {
+		served[projectID] = seq
+	}
+	seq := q.serveSeq
+
+	order := make([]*BuildJob, 0, len(pending))
+	for len(pending) > 0 {
+		i := pickNext(pending, served, now)
+		job := pending[i]
+		pending = append(pending[:i], pending[i+1:]...)
+
+		seq++
+		served[job.ProjectID] = seq
+		order = append(order, job)
+	}
+	return order
+}
+
+// placement estimates when the job at position will start, assuming every
+// build takes the average duration; callers must hold jobsMux
+func (q *JobQueue) placement(position int, now time.Time) Placement {
+	running := 0
+	for _, job := range q.jobs {
+		if job.Status == StatusRunning {
+			running++
+		}
+	}
+
+	// Jobs ahead of this one plus the running builds occupy the workers in
+	// waves of q.workers builds each
+	var wait time.Duration
+	if busy := running + position; busy > q.workers {
+		waves := (busy - q.workers + q.workers - 1) / q.workers
+		wait = q.avgDuration * time.Duration(waves)
+	}
+
+	return Placement{
+		Position:       position,
+		EstimatedStart: now.Add(wait),
+	}
+}
@@ -0,0 +1,327 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/utils"
+)
+
+// pendingJob returns a job of a project that has waited in the backlog for waiting
+func pendingJob(id, projectID string, priority Priority, now time.Time, waiting time.Duration) *BuildJob {
+	return &BuildJob{ID: id, ProjectID: projectID, Priority: priority, QueuedAt: now.Add(-waiting)}
+}
+
+// ids returns the IDs of jobs in order
+func ids(jobs []*BuildJob) []string {
+	out := make([]string, len(jobs))
+	for i, job := range jobs {
+		out[i] = job.ID
+	}
+	return out
+}
+
+func TestEffectiveLevel(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		priority Priority
+		waiting  time.Duration
+		want     int
+	}{
+		{PriorityBackground, 0, 0},
+		{PriorityBackground, agingInterval - time.Second, 0},
+		{PriorityBackground, agingInterval, 1},
+		{PriorityBackground, 2 * agingInterval, 2},
+		{PriorityBackground, 10 * agingInterval, 2},
+		{PriorityNormal, 0, 1},
+		{PriorityNormal, agingInterval, 2},
+		{PriorityInteractive, 0, 2},
+		{PriorityInteractive, 5 * agingInterval, 2},
+	}
+	for _, tt := range tests {
+		job := pendingJob("j", "p", tt.priority, now, tt.waiting)
+		if got := effectiveLevel(job, now); got != tt.want {
+			t.Errorf("effectiveLevel(%s waiting %s) = %d, want %d", tt.priority, tt.waiting, got, tt.want)
+		}
+	}
+}
+
+func TestRunOrder(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		pending []*BuildJob
+		served  map[string]uint64
+		want    []string
+	}{
+		{
+			name: "priority first",
+			pending: []*BuildJob{
+				pendingJob("bg", "a", PriorityBackground, now, 3*time.Second),
+				pendingJob("normal", "b", PriorityNormal, now, 2*time.Second),
+				pendingJob("interactive", "c", PriorityInteractive, now, time.Second),
+			},
+			want: []string{"interactive", "normal", "bg"},
+		},
+		{
+			name: "aged background job overtakes normal jobs",
+			pending: []*BuildJob{
+				pendingJob("normal", "a", PriorityNormal, now, time.Second),
+				pendingJob("bg", "b", PriorityBackground, now, agingInterval+time.Second),
+			},
+			want: []string{"bg", "normal"},
+		},
+		{
+			name: "background job aged twice ties interactive jobs and wins by age",
+			pending: []*BuildJob{
+				pendingJob("interactive", "a", PriorityInteractive, now, time.Second),
+				pendingJob("bg", "b", PriorityBackground, now, 2*agingInterval),
+			},
+			want: []string{"bg", "interactive"},
+		},
+		{
+			name: "aging never exceeds interactive",
+			pending: []*BuildJob{
+				pendingJob("old-normal", "a", PriorityNormal, now, 10*agingInterval),
+				pendingJob("interactive", "b", PriorityInteractive, now, time.Second),
+			},
+			served: map[string]uint64{"a": 2, "b": 1},
+			want:   []string{"interactive", "old-normal"},
+		},
+		{
+			name: "round-robin across projects at equal priority",
+			pending: []*BuildJob{
+				pendingJob("a1", "a", PriorityNormal, now, 6*time.Second),
+				pendingJob("a2", "a", PriorityNormal, now, 5*time.Second),
+				pendingJob("a3", "a", PriorityNormal, now, 4*time.Second),
+				pendingJob("b1", "b", PriorityNormal, now, 3*time.Second),
+				pendingJob("c1", "c", PriorityNormal, now, 2*time.Second),
+				pendingJob("b2", "b", PriorityNormal, now, time.Second),
+			},
+			want: []string{"a1", "b1", "c1", "a2", "b2", "a3"},
+		},
+		{
+			name: "least recently served project goes first",
+			pending: []*BuildJob{
+				pendingJob("a1", "a", PriorityNormal, now, 2*time.Second),
+				pendingJob("b1", "b", PriorityNormal, now, time.Second),
+			},
+			served: map[string]uint64{"a": 5, "b": 3},
+			want:   []string{"b1", "a1"},
+		},
+		{
+			name: "never served project goes before served ones",
+			pending: []*BuildJob{
+				pendingJob("a1", "a", PriorityNormal, now, 2*time.Second),
+				pendingJob("b1", "b", PriorityNormal, now, time.Second),
+			},
+			served: map[string]uint64{"a": 1},
+			want:   []string{"b1", "a1"},
+		},
+		{
+			name: "fairness does not override priority",
+			pending: []*BuildJob{
+				pendingJob("a1", "a", PriorityInteractive, now, 3*time.Second),
+				pendingJob("a2", "a", PriorityInteractive, now, 2*time.Second),
+				pendingJob("b1", "b", PriorityNormal, now, 4*time.Second),
+			},
+			want: []string{"a1", "a2", "b1"},
+		},
+		{
+			name: "jobs of a project run in queue order",
+			pending: []*BuildJob{
+				pendingJob("a2", "a", PriorityNormal, now, time.Second),
+				pendingJob("a1", "a", PriorityNormal, now, 2*time.Second),
+				pendingJob("a3", "a", PriorityNormal, now, 0),
+			},
+			want: []string{"a1", "a2", "a3"},
+		},
+	}
+
+	for _, tt := range tests {
+		served := tt.served
+		if served == nil {
+			served = map[string]uint64{}
+		}
+		var seq uint64
+		for _, s := range served {
+			seq = max(seq, s)
+		}
+		q := &JobQueue{pending: tt.pending, served: served, serveSeq: seq}
+
+		if got := ids(q.runOrder(now)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: run order = %v, want %v", tt.name, got, tt.want)
+		}
+		// Simulating the order must leave the scheduler's state alone
+		if len(q.pending) != len(tt.pending) || q.serveSeq != seq {
+			t.Errorf("%s: runOrder changed the backlog or serve sequence", tt.name)
+		}
+	}
+}
+
+// TestRunOrderMatchesPicks checks that the order promised to clients is the
+// order in which pickNext really hands out the jobs
+func TestRunOrderMatchesPicks(t *testing.T) {
+	now := time.Now()
+	pending := []*BuildJob{
+		pendingJob("a1", "a", PriorityNormal, now, 5*time.Second),
+		pendingJob("a2", "a", PriorityBackground, now, agingInterval+time.Second),
+		pendingJob("b1", "b", PriorityNormal, now, 4*time.Second),
+		pendingJob("c1", "c", PriorityInteractive, now, time.Second),
+		pendingJob("b2", "b", PriorityBackground, now, 3*time.Second),
+	}
+	q := &JobQueue{pending: pending, served: map[string]uint64{}}
+	want := ids(q.runOrder(now))
+
+	var got []string
+	for len(q.pending) > 0 {
+		i := pickNext(q.pending, q.served, now)
+		job := q.pending[i]
+		q.pending = append(q.pending[:i], q.pending[i+1:]...)
+		q.serveSeq++
+		q.served[job.ProjectID] = q.serveSeq
+		got = append(got, job.ID)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("picked %v, run order promised %v", got, want)
+	}
+}
+
+// orderStage records the project names of the builds it runs, in order;
+// builds of the project "gate" wait until release is closed
+type orderStage struct {
+	mux     sync.Mutex
+	started []string
+	release chan struct{}
+}
+
+func (s *orderStage) Name() string { return "order" }
+func (s *orderStage) Weight() int  { return 1 }
+
+func (s *orderStage) Run(ctx context.Context, build *Build, progress ProgressFunc) error {
+	if build.Project.ID == "gate" {
+		<-s.release
+		return nil
+	}
+	s.mux.Lock()
+	s.started = append(s.started, build.Project.Name)
+	s.mux.Unlock()
+	return nil
+}
+
+func TestQueueRunsJobsFairly(t *testing.T) {
+	logger := utils.NewColoredLogger("TEST", "")
+	stage := &orderStage{release: make(chan struct{})}
+	q := NewJobQueue(Config{Workers: 1, Stages: []Stage{stage}}, logger, logger)
+	defer q.Shutdown()
+
+	// Occupy the only worker so every other job waits in the backlog
+	gate, _, err := q.SubmitJob(models.Project{ID: "gate"}, SubmitOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, q, gate, StatusRunning)
+
+	var last string
+	for _, job := range []struct {
+		project, name string
+		priority      Priority
+	}{
+		{"a", "a1", PriorityNormal},
+		{"a", "a2", PriorityNormal},
+		{"a", "a3", PriorityNormal},
+		{"b", "b1", PriorityNormal},
+		{"c", "c1", PriorityBackground},
+		{"b", "b2", PriorityInteractive},
+	} {
+		last, _, err = q.SubmitJob(models.Project{ID: job.project, Name: job.name}, SubmitOptions{Priority: job.priority})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stage.release)
+	waitForStatus(t, q, last, StatusCompleted)
+	for _, job := range q.ListProjectJobs("c") {
+		waitForStatus(t, q, job.ID, StatusCompleted)
+	}
+
+	// The interactive job first, then round-robin across a and b, which
+	// were served least recently, and the background job last
+	want := []string{"b2", "a1", "b1", "a2", "a3", "c1"}
+	stage.mux.Lock()
+	defer stage.mux.Unlock()
+	if !reflect.DeepEqual(stage.started, want) {
+		t.Errorf("jobs ran in order %v, want %v", stage.started, want)
+	}
+}
+
+// waitForStatus waits until a job reaches a status
+func waitForStatus(t *testing.T, q *JobQueue, jobID string, status JobStatus) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := q.GetJobStatus(jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == status {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is %s, want %s", jobID, job.Status, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPlacement(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		workers, running, position int
+		want                       time.Duration
+	}{
+		{workers: 2, running: 0, position: 1, want: 0},
+		{workers: 2, running: 1, position: 1, want: 0},
+		{workers: 2, running: 2, position: 1, want: 10 * time.Second},
+		{workers: 2, running: 2, position: 2, want: 10 * time.Second},
+		{workers: 2, running: 2, position: 3, want: 20 * time.Second},
+		{workers: 1, running: 1, position: 3, want: 30 * time.Second},
+	}
+	for _, tt := range tests {
+		q := &JobQueue{jobs: map[string]*BuildJob{}, workers: tt.workers, avgDuration: 10 * time.Second}
+		for i := 0; i < tt.running; i++ {
+			q.jobs[string(rune('a'+i))] = &BuildJob{Status: StatusRunning}
+		}
+		placement := q.placement(tt.position, now)
+		if placement.Position != tt.position || placement.EstimatedStart.Sub(now) != tt.want {
+			t.Errorf("%d workers, %d running, position %d: start in %s, want %s",
+				tt.workers, tt.running, tt.position, placement.EstimatedStart.Sub(now), tt.want)
+		}
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Priority
+		wantErr bool
+	}{
+		{"", PriorityNormal, false},
+		{"interactive", PriorityInteractive, false},
+		{"normal", PriorityNormal, false},
+		{"background", PriorityBackground, false},
+		{"urgent", "", true},
+		{"Normal", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePriority(tt.name)
+		if got != tt.want || errors.Is(err, ErrInvalidPriority) != tt.wantErr {
+			t.Errorf("ParsePriority(%q) = %q, %v; want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
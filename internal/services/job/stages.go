@@ -0,0 +1,377 @@
+package job
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/services"
+	"sawthet.go-press-server.net/internal/services/css/critical"
+	"sawthet.go-press-server.net/internal/services/css/gocss"
+)
+
+// Names of the built-in stages, as used in a project's build config
+const (
+	StageRender  = "render"
+	StageCSS     = "css"
+	StagePackage = "package"
+)
+
+// DefaultStages returns the built-in stages in their default order
+func DefaultStages() []Stage {
+	return []Stage{
+		RenderStage{},
+		CSSStage{},
+		PackageStage{},
+	}
+}
+
+// RenderStage renders every page of the project to HTML
+type RenderStage struct {
+	// Templates is the parsed template set shared by all builds; nil parses
+	// the templates again for every build
+	Templates *services.TemplateService
+	// Workers is the number of pages rendered concurrently; zero uses one per CPU
+	Workers int
+}
+
+func (RenderStage) Name() string { return StageRender }
+
+func (RenderStage) Weight() int { return 50 }
+
+func (stage RenderStage) Run(ctx context.Context, build *Build, progress ProgressFunc) error {
+	templateService := stage.Templates
+	if templateService == nil {
+		var err error
+		templateService, err = services.NewTemplateService()
+		if err != nil {
+			return fmt.Errorf("Failed to initialize template service: %w", err)
+		}
+	}
+
+	// Reuse the HTML of pages whose content, and everything shared between
+	// pages, is unchanged since the project's previous build
+	shared := SharedHash(build.Project, templateService.Fingerprint(), build.Draft)
+	build.Pages = make(map[string][]byte, len(build.Project.Pages))
+	build.Report = PageReport{Rebuilt: []string{}, Reused: []string{}}
+
+	keys := make(map[string]string)
+	var changed []models.Page
+	for _, page := range build.Project.Pages {
+		key := PageHash(page, shared)
+		if html, ok := build.cached(cachePages, key); ok {
+			build.Pages[page.Filename()] = html
+			build.Report.Reused = append(build.Report.Reused, page.Filename())
+			build.Log(LogEntry{Level: LogDebug, Page: page.Filename(), Message: "Reused unchanged page"})
+			continue
+		}
+		keys[page.Filename()] = key
+		changed = append(changed, page)
+	}
+
+	progress(0, "Starting HTML generation...")
+	project := build.Project
+	project.Pages = changed
+	pages, err := templateService.GenerateHTML(ctx, project, services.RenderOptions{
+		Workers: stage.Workers,
+		Draft:   build.Draft,
+		PageRendered: func(page models.Page, elapsed time.Duration) {
+			build.Log(LogEntry{
+				Level:      LogDebug,
+				Page:       page.Filename(),
+				Message:    fmt.Sprintf("Rendered page in %s", elapsed.Round(time.Microsecond)),
+				DurationMs: elapsed.Milliseconds(),
+			})
+		},
+	}, progress)
+	if err != nil {
+		// Every failed page is logged with the component at fault, if known
+		var renderErr *services.RenderError
+		if errors.As(err, &renderErr) {
+			for _, page := range renderErr.Pages {
+				build.Log(LogEntry{
+					Level:     LogError,
+					Page:      page.Filename,
+					Component: page.Component,
+					Message:   page.Err.Error(),
+				})
+			}
+		}
+		return fmt.Errorf("Failed to generate HTML: %w", err)
+	}
+
+	for _, page := range changed {
+		filename := page.Filename()
+		build.Pages[filename] = pages[filename]
+		build.Report.Rebuilt = append(build.Report.Rebuilt, filename)
+		build.cache(cachePages, keys[filename], pages[filename])
+	}
+
+	build.Logf("Rendered %d pages, reused %d unchanged pages", len(build.Report.Rebuilt), len(build.Report.Reused))
+	return nil
+}
+
+// StylesheetPath returns where a compiled stylesheet is stored in the site.
+// The name is fingerprinted with the content so browsers never use a stale copy.
+func StylesheetPath(css []byte) string {
+	sum := sha256.Sum256(css)
+	return "css/styles." + hex.EncodeToString(sum[:4]) + ".css"
+}
+
+// CSSStage compiles the stylesheet for the classes used by the rendered pages
+// and adds it to every page as chosen by the project's build config: linked,
+// inlined, or split into inlined critical CSS and a deferred stylesheet
+type CSSStage struct {
+	// Compiler is the CSS toolchain shared by all builds; nil sets up a
+	// compiler for every build
+	Compiler *services.CSSCompiler
+}
+
+func (CSSStage) Name() string { return StageCSS }
+
+func (CSSStage) Weight() int { return 35 }
+
+func (stage CSSStage) Run(ctx context.Context, build *Build, progress ProgressFunc) error {
+	if build.Assets == nil {
+		build.Assets = make(map[string][]byte)
+	}
+
+	// Combine all HTML content for CSS compilation
+	var combinedHTML []byte
+	for _, filename := range sortedKeys(build.Pages) {
+		combinedHTML = append(combinedHTML, build.Pages[filename]...)
+	}
+
+	// The stylesheet only depends on the classes used in the pages, on the
+	// theme and on the backend compiling it
+	backend := services.CSSBackendTailwind
+	if stage.Compiler != nil {
+		backend = stage.Compiler.Backend()
+	}
+	key := hashJSON(struct {
+		HTML    []byte       `json:"html"`
+		Theme   models.Theme `json:"theme"`
+		Backend string       `json:"backend"`
+	}{combinedHTML, build.Project.GlobalConfig.Theme, backend})
+
+	cssContent, ok := build.cached(cacheCSS, key)
+	if ok {
+		build.Logf("Reused unchanged stylesheet (%d bytes)", len(cssContent))
+	} else {
+		cssCompiler := stage.Compiler
+		if cssCompiler == nil {
+			var err error
+			cssCompiler, err = services.NewCSSCompiler(services.CSSCompilerConfig{})
+			if err != nil {
+				return Transient(fmt.Errorf("Failed to initialize CSS compiler: %w", err))
+			}
+			defer cssCompiler.Cleanup()
+		}
+
+		progress(0, "Compiling CSS...")
+
+		// Compile minified CSS; the levels of the toolchain's diagnostics
+		// are log levels
+		started := time.Now()
+		var err error
+		cssContent, err = cssCompiler.Compile(ctx, combinedHTML, build.Project, func(level, message string) {
+			build.Log(LogEntry{Level: LogLevel(level), Message: message})
+		})
+		if err != nil {
+			return compileError(err)
+		}
+
+		build.cache(cacheCSS, key, cssContent)
+		elapsed := time.Since(started)
+		build.Log(LogEntry{
+			Level:      LogInfo,
+			Message:    fmt.Sprintf("Compiled stylesheet (%d bytes) in %s", len(cssContent), elapsed.Round(time.Millisecond)),
+			DurationMs: elapsed.Milliseconds(),
+		})
+	}
+
+	build.Manifest.CSSMode = cssMode(build.Project.Build)
+	switch build.Manifest.CSSMode {
+	case CSSModeInline:
+		style := styleElement(cssContent)
+		replaceMarker(build.Pages, services.StylesheetPlaceholder, func(filename string) string {
+			build.Manifest.updatePage(filename, func(stats *PageStats) {
+				stats.InlineCSSBytes = len(cssContent)
+			})
+			return style
+		})
+		build.Logf("Inlined the stylesheet into %d pages", len(build.Pages))
+		return nil
+
+	case CSSModeCritical:
+		path := StylesheetPath(cssContent)
+		build.Assets[path] = cssContent
+		build.Manifest.Stylesheet = path
+		build.Manifest.StylesheetBytes = len(cssContent)
+
+		// The rules used above the fold are inlined; the full stylesheet is
+		// preloaded and applied once it arrives
+		sheet := critical.Parse(cssContent)
+		var criticalBytes int
+		replaceMarker(build.Pages, services.StylesheetPlaceholder, func(filename string) string {
+			criticalCSS := sheet.Extract(aboveFoldClasses(build.Pages[filename]))
+			criticalBytes += len(criticalCSS)
+			build.Manifest.updatePage(filename, func(stats *PageStats) {
+				stats.InlineCSSBytes = len(criticalCSS)
+				stats.DeferredCSSBytes = len(cssContent)
+			})
+
+			href := relativeRoot(filename) + path
+			return styleElement(criticalCSS) +
+				`<link rel="preload" href="` + href + `" as="style" onload="this.onload=null;this.rel='stylesheet'">` +
+				`<noscript><link rel="stylesheet" href="` + href + `"></noscript>`
+		})
+		if len(build.Pages) > 0 {
+			build.Logf("Inlined critical CSS into %d pages (%d bytes on average), deferred %s",
+				len(build.Pages), criticalBytes/len(build.Pages), path)
+		}
+		return nil
+
+	default:
+		path := StylesheetPath(cssContent)
+		build.Assets[path] = cssContent
+		build.Manifest.Stylesheet = path
+		build.Manifest.StylesheetBytes = len(cssContent)
+		replaceMarker(build.Pages, services.StylesheetPlaceholder, func(filename string) string {
+			build.Manifest.updatePage(filename, func(stats *PageStats) {
+				stats.BlockingCSSBytes = len(cssContent)
+			})
+			return `<link rel="stylesheet" href="` + relativeRoot(filename) + path + `">`
+		})
+		build.Logf("Linked %s from %d pages", path, len(build.Pages))
+		return nil
+	}
+}
+
+// compileError wraps a failed CSS compilation. Errors in the project's styles
+// fail the same way on every attempt; only toolchain failures and timeouts
+// are marked Transient.
+func compileError(err error) error {
+	err = fmt.Errorf("Failed to compile CSS: %w", err)
+	if errors.Is(err, services.ErrCSSToolchain) || errors.Is(err, context.DeadlineExceeded) {
+		return Transient(err)
+	}
+	return err
+}
+
+// styleElement wraps CSS in a style element. A closing tag inside the CSS
+// would end the element early, so it is escaped.
+func styleElement(css []byte) string {
+	return "<style>" + strings.ReplaceAll(string(css), "</", `<\/`) + "</style>"
+}
+
+// aboveFoldBytes is how much of the page content, after the header, is
+// assumed to be visible without scrolling
+const aboveFoldBytes = 4 << 10
+
+// aboveFoldClasses returns the classes used by a page up to aboveFoldBytes
+// into its content. A class attribute cut short by the limit is ignored.
+func aboveFoldClasses(html []byte) map[string]bool {
+	if i := bytes.Index(html, []byte(services.ContentMarker)); i >= 0 && i+aboveFoldBytes < len(html) {
+		html = html[:i+aboveFoldBytes]
+	}
+	classes := make(map[string]bool)
+	for _, class := range gocss.Classes(html) {
+		classes[class] = true
+	}
+	return classes
+}
+
+// replaceMarker replaces a marker in every page with the markup returned for
+// its filename
+func replaceMarker(pages map[string][]byte, marker string, markup func(filename string) string) {
+	for _, filename := range sortedKeys(pages) {
+		if bytes.Contains(pages[filename], []byte(marker)) {
+			pages[filename] = bytes.ReplaceAll(pages[filename], []byte(marker), []byte(markup(filename)))
+		}
+	}
+}
+
+// relativeRoot returns the relative path from a page to the root of the site,
+// such as "../" for blog/post.html
+func relativeRoot(filename string) string {
+	return strings.Repeat("../", strings.Count(filename, "/"))
+}
+
+// PackageStage writes the pages and assets into the job's zip archive
+type PackageStage struct{}
+
+func (PackageStage) Name() string { return StagePackage }
+
+func (PackageStage) Weight() int { return 15 }
+
+func (PackageStage) Run(ctx context.Context, build *Build, progress ProgressFunc) error {
+	progress(0, "Packaging site...")
+
+	// Create sites directory if it doesn't exist
+	sitesDir := filepath.Join("static", "sites")
+	if err := os.MkdirAll(sitesDir, 0755); err != nil {
+		return Transient(fmt.Errorf("Failed to create sites directory: %w", err))
+	}
+
+	// Create zip file directly in sites directory
+	zipPath := ZipPath(build.JobID)
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		return Transient(fmt.Errorf("Failed to create zip file: %w", err))
+	}
+	defer zipFile.Close()
+
+	zipWriter := zip.NewWriter(zipFile)
+
+	// Pages keep their markers when the CSS stage did not run
+	for _, marker := range []string{services.StylesheetPlaceholder, services.ContentMarker} {
+		replaceMarker(build.Pages, marker, func(string) string { return "" })
+	}
+	for filename, html := range build.Pages {
+		build.Manifest.updatePage(filename, func(stats *PageStats) {
+			stats.HTMLBytes = len(html)
+		})
+	}
+
+	for _, files := range []map[string][]byte{build.Pages, build.Assets} {
+		for _, filename := range sortedKeys(files) {
+			writer, err := zipWriter.Create(filename)
+			if err != nil {
+				return Transient(fmt.Errorf("Failed to create %s in zip: %w", filename, err))
+			}
+			if _, err := writer.Write(files[filename]); err != nil {
+				return Transient(fmt.Errorf("Failed to write %s to zip: %w", filename, err))
+			}
+		}
+	}
+
+	// Finish the archive before the job is reported as completed
+	if err := zipWriter.Close(); err != nil {
+		return Transient(fmt.Errorf("Failed to finalize zip file: %w", err))
+	}
+
+	build.Artifact = zipPath
+	build.Logf("Packaged %d files into %s", len(build.Pages)+len(build.Assets), zipPath)
+	return nil
+}
+
+// sortedKeys returns the keys of a file map in a stable order
+func sortedKeys(files map[string][]byte) []string {
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
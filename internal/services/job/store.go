@@ -0,0 +1,151 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/utils"
+)
+
+// StatusTransition records a change of a job's status
+type StatusTransition struct {
+	Status  JobStatus `json:"status"`
+	Message string    `json:"message,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// JobRecord is the persisted state of a build job
+type JobRecord struct {
+	ID            string             `json:"id"`
+	ProjectID     string             `json:"projectId"`
+	Project       models.Project     `json:"project"`
+	Status        JobStatus          `json:"status"`
+	Progress      int                `json:"progress"`
+	Message       string             `json:"message"`
+	CreatedAt     time.Time          `json:"createdAt"`
+	UpdatedAt     time.Time          `json:"updatedAt"`
+	ExpiresAt     time.Time          `json:"expiresAt"`
+	Priority      Priority           `json:"priority,omitempty"`
+	Draft         bool               `json:"draft,omitempty"`
+	Attempt       int                `json:"attempt,omitempty"`
+	Retry         RetryPolicy        `json:"retry"`
+	Interruptions int                `json:"interruptions,omitempty"`
+	Transitions   []StatusTransition `json:"transitions"`
+	Stages        []StageRecord      `json:"stages,omitempty"`
+	Pages         *PageReport        `json:"pages,omitempty"`
+	Manifest      *Manifest          `json:"manifest,omitempty"`
+	Events        []ProgressUpdate   `json:"events,omitempty"`
+	Logs          []LogEntry         `json:"logs,omitempty"`
+}
+
+// ErrCorruptJob is reported for a stored job record that cannot be decoded
+var ErrCorruptJob = errors.New("corrupt job record")
+
+// corruptSuffix marks a job record set aside because it cannot be decoded
+const corruptSuffix = ".corrupt"
+
+// JobStore persists job records so the queue survives restarts
+type JobStore interface {
+	// Save creates or replaces a job record
+	Save(record JobRecord) error
+	// Delete removes a job record; deleting a missing record is not an error
+	Delete(id string) error
+	// LoadAll returns every stored job record. Records that cannot be
+	// decoded are set aside, so they are not loaded again, and reported in
+	// an error wrapping ErrCorruptJob that is returned with the other records.
+	LoadAll() ([]JobRecord, error)
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// FileJobStore keeps each job record as a JSON file named after the job ID
+type FileJobStore struct {
+	dir string
+	mux sync.Mutex
+}
+
+// NewFileJobStore creates a file-backed job store rooted at dir
+func NewFileJobStore(dir string) (*FileJobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job directory: %v", err)
+	}
+
+	return &FileJobStore{
+		dir: dir,
+	}, nil
+}
+
+func (s *FileJobStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *FileJobStore) Save(record JobRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %w", record.ID, err)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return utils.WriteFileAtomic(s.path(record.ID), data)
+}
+
+func (s *FileJobStore) Delete(id string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileJobStore) LoadAll() ([]JobRecord, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []JobRecord
+	var corrupt []error
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		path := filepath.Join(s.dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var record JobRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			id := strings.TrimSuffix(entry.Name(), ".json")
+			// Keep the file for inspection under a name that is not loaded
+			if err := os.Rename(path, path+corruptSuffix); err != nil {
+				return nil, err
+			}
+			corrupt = append(corrupt, fmt.Errorf("%w %s: %v", ErrCorruptJob, id, err))
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, errors.Join(corrupt...)
+}
+
+func (s *FileJobStore) Close() error {
+	return nil
+}
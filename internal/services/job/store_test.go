@@ -0,0 +1,149 @@
+package job
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"sawthet.go-press-server.net/internal/utils"
+)
+
+// jobStores opens each kind of job store in a temporary directory, together
+// with a function writing a raw record into it
+func jobStores(t *testing.T) map[string]struct {
+	store JobStore
+	put   func(id string, data []byte)
+} {
+	t.Helper()
+	dir := t.TempDir()
+	files, err := NewFileJobStore(filepath.Join(dir, "jobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewBoltJobStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return map[string]struct {
+		store JobStore
+		put   func(id string, data []byte)
+	}{
+		"file": {files, func(id string, data []byte) {
+			if err := os.WriteFile(files.path(id), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		"bolt": {db, func(id string, data []byte) {
+			err := db.db.Update(func(tx *bolt.Tx) error {
+				return tx.Bucket(jobsBucket).Put([]byte(id), data)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+}
+
+func TestLoadAllSetsCorruptRecordsAside(t *testing.T) {
+	for name, s := range jobStores(t) {
+		if err := s.store.Save(JobRecord{ID: "good", ProjectID: "p", Status: StatusPending}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		s.put("bad", []byte(`{"id": "bad", "status": `))
+
+		records, err := s.store.LoadAll()
+		if !errors.Is(err, ErrCorruptJob) || !strings.Contains(err.Error(), "bad") {
+			t.Errorf("%s: LoadAll error = %v, want %v for the bad record", name, err, ErrCorruptJob)
+		}
+		if len(records) != 1 || records[0].ID != "good" {
+			t.Errorf("%s: LoadAll = %+v, want the good record", name, records)
+		}
+
+		// The corrupt record is not loaded again
+		records, err = s.store.LoadAll()
+		if err != nil || len(records) != 1 {
+			t.Errorf("%s: second LoadAll = %d records, %v; want the good record only", name, len(records), err)
+		}
+	}
+}
+
+func TestFileJobStoreKeepsCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.path("bad"), []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.LoadAll(); !errors.Is(err, ErrCorruptJob) {
+		t.Fatalf("LoadAll error = %v, want %v", err, ErrCorruptJob)
+	}
+	if data, err := os.ReadFile(s.path("bad") + corruptSuffix); err != nil || string(data) != "not json" {
+		t.Errorf("corrupt record was not kept for inspection: %q, %v", data, err)
+	}
+}
+
+func TestQueueRestoresJobsNextToCorruptRecord(t *testing.T) {
+	for name, s := range jobStores(t) {
+		now := time.Now()
+		finished := JobRecord{
+			ID: "finished", ProjectID: "p", Status: StatusCompleted, Progress: 100,
+			CreatedAt: now, UpdatedAt: now, ExpiresAt: now.Add(time.Hour),
+		}
+		if err := s.store.Save(finished); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		s.put("bad", []byte("{"))
+
+		logger := utils.NewColoredLogger("TEST", "")
+		q := NewJobQueue(Config{Workers: 1, Store: s.store, Stages: []Stage{}}, logger, logger)
+		job, err := q.GetJobStatus("finished")
+		if err != nil {
+			t.Errorf("%s: good job was not restored: %v", name, err)
+		} else if job.Status != StatusCompleted || job.Progress != 100 {
+			t.Errorf("%s: restored job = %s %d%%", name, job.Status, job.Progress)
+		}
+		if _, err := q.GetJobStatus("bad"); !errors.Is(err, ErrJobNotFound) {
+			t.Errorf("%s: corrupt job: %v, want %v", name, err, ErrJobNotFound)
+		}
+		q.Shutdown()
+	}
+}
+
+func TestRecordKeepsHistoryOnceFinished(t *testing.T) {
+	job := jobWithEvents(50)
+	for i := 0; i < 30; i++ {
+		job.addLog(LogEntry{Level: LogInfo})
+	}
+
+	// A live job saves only what continues its numbering
+	record := job.record()
+	if len(record.Events) != 1 || record.Events[0].Seq != 50 {
+		t.Errorf("live record holds %d events, want the latest only", len(record.Events))
+	}
+	if len(record.Logs) != 1 || record.Logs[0].Seq != 30 {
+		t.Errorf("live record holds log lines %v, want the latest only", logSeqs(record.Logs))
+	}
+
+	// A job restored from the record continues numbering where it left off
+	restored := &BuildJob{ID: "j", ProjectID: "p", Status: StatusPending, Events: record.Events, Logs: record.Logs}
+	if seq := restored.addEvent(ProgressUpdate{Status: StatusRunning}).Seq; seq != 51 {
+		t.Errorf("restored job's next event is seq %d, want 51", seq)
+	}
+	if seq := restored.addLog(LogEntry{Level: LogInfo}).Seq; seq != 31 {
+		t.Errorf("restored job's next log line is seq %d, want 31", seq)
+	}
+
+	job.Status = StatusCompleted
+	record = job.record()
+	if len(record.Events) != 50 || len(record.Logs) != 30 {
+		t.Errorf("finished record holds %d events and %d log lines, want 50 and 30", len(record.Events), len(record.Logs))
+	}
+}
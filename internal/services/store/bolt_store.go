@@ -0,0 +1,232 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"sawthet.go-press-server.net/internal/models"
+)
+
+var (
+	projectsBucket  = []byte("projects")
+	revisionsBucket = []byte("revisions")
+)
+
+// BoltStore keeps projects in an embedded BoltDB database. The latest version
+// of each project lives in the projects bucket, and every revision in a
+// per-project bucket nested under the revisions bucket.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (or creates) the database file at path
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open project database: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{projectsBucket, revisionsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create buckets: %v", err)
+	}
+
+	return &BoltStore{
+		db: db,
+	}, nil
+}
+
+func (s *BoltStore) List() ([]models.Project, error) {
+	projects := []models.Project{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// Bolt iterates keys in byte order, so the result is sorted by ID
+		return tx.Bucket(projectsBucket).ForEach(func(k, v []byte) error {
+			var project models.Project
+			if err := json.Unmarshal(v, &project); err != nil {
+				return fmt.Errorf("failed to decode project %s: %w", k, err)
+			}
+			projects = append(projects, project)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return projects, nil
+}
+
+func (s *BoltStore) Get(id string) (models.Project, error) {
+	var project models.Project
+	if err := ValidateID(id); err != nil {
+		return project, err
+	}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(projectsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &project)
+	})
+
+	return project, err
+}
+
+func (s *BoltStore) Create(project models.Project, info RevisionInfo) (Revision, error) {
+	return s.put(project, info, false)
+}
+
+func (s *BoltStore) Update(project models.Project, info RevisionInfo) (Revision, error) {
+	return s.put(project, info, true)
+}
+
+func (s *BoltStore) Delete(id string) error {
+	if err := ValidateID(id); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(projectsBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+
+		revisions := tx.Bucket(revisionsBucket)
+		if revisions.Bucket([]byte(id)) == nil {
+			return nil
+		}
+		return revisions.DeleteBucket([]byte(id))
+	})
+}
+
+func (s *BoltStore) ListRevisions(id string) ([]Revision, error) {
+	if err := ValidateID(id); err != nil {
+		return nil, err
+	}
+
+	revisions := []Revision{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(projectsBucket).Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+
+		bucket := tx.Bucket(revisionsBucket).Bucket([]byte(id))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var record revisionRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("failed to decode revision of project %s: %w", id, err)
+			}
+			revisions = append(revisions, record.Revision)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (s *BoltStore) GetRevision(id string, number int) (models.Project, Revision, error) {
+	if err := ValidateID(id); err != nil {
+		return models.Project{}, Revision{}, err
+	}
+
+	var record revisionRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(projectsBucket).Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+
+		bucket := tx.Bucket(revisionsBucket).Bucket([]byte(id))
+		if bucket == nil || number < 1 {
+			return ErrRevisionNotFound
+		}
+
+		data := bucket.Get(revisionKey(number))
+		if data == nil {
+			return ErrRevisionNotFound
+		}
+		return json.Unmarshal(data, &record)
+	})
+
+	return record.Project, record.Revision, err
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// put writes a project and a new revision, requiring the project to exist
+// (update) or not exist (create)
+func (s *BoltStore) put(project models.Project, info RevisionInfo, mustExist bool) (Revision, error) {
+	if err := ValidateID(project.ID); err != nil {
+		return Revision{}, err
+	}
+
+	data, err := json.Marshal(project)
+	if err != nil {
+		return Revision{}, fmt.Errorf("failed to encode project %s: %w", project.ID, err)
+	}
+
+	var rev Revision
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(projectsBucket)
+		exists := bucket.Get([]byte(project.ID)) != nil
+		if mustExist && !exists {
+			return ErrNotFound
+		}
+		if !mustExist && exists {
+			return ErrAlreadyExists
+		}
+
+		revisions, err := tx.Bucket(revisionsBucket).CreateBucketIfNotExists([]byte(project.ID))
+		if err != nil {
+			return err
+		}
+		seq, err := revisions.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		var record []byte
+		record, rev, err = newRevisionRecord(project, int(seq), info)
+		if err != nil {
+			return fmt.Errorf("failed to encode project %s: %w", project.ID, err)
+		}
+		if err := revisions.Put(revisionKey(rev.Number), record); err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(project.ID), data)
+	})
+
+	return rev, err
+}
+
+// revisionKey encodes a revision number so that keys sort numerically
+func revisionKey(number int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(number))
+	return key
+}
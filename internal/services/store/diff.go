@@ -0,0 +1,121 @@
+package store
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sawthet.go-press-server.net/internal/models"
+)
+
+// Change is a single difference between two project documents, addressed
+// by a JSON pointer (RFC 6901)
+type Change struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	From any    `json:"from,omitempty"`
+	To   any    `json:"to,omitempty"`
+}
+
+// Diff returns the changes needed to turn project a into project b
+func Diff(a, b models.Project) ([]Change, error) {
+	docA, err := toDocument(a)
+	if err != nil {
+		return nil, err
+	}
+	docB, err := toDocument(b)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	diffValues("", docA, docB, &changes)
+
+	return changes, nil
+}
+
+// toDocument converts a project into its generic JSON representation
+func toDocument(project models.Project) (any, error) {
+	data, err := json.Marshal(project)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+func diffValues(path string, a, b any, changes *[]Change) {
+	switch av := a.(type) {
+	case map[string]any:
+		if bv, ok := b.(map[string]any); ok {
+			diffObjects(path, av, bv, changes)
+			return
+		}
+	case []any:
+		if bv, ok := b.([]any); ok {
+			diffArrays(path, av, bv, changes)
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, Change{Op: "replace", Path: path, From: a, To: b})
+	}
+}
+
+func diffObjects(path string, a, b map[string]any, changes *[]Change) {
+	keys := make(map[string]struct{}, len(a)+len(b))
+	for key := range a {
+		keys[key] = struct{}{}
+	}
+	for key := range b {
+		keys[key] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	for _, key := range sorted {
+		childPath := path + "/" + escapePointer(key)
+		av, inA := a[key]
+		bv, inB := b[key]
+
+		switch {
+		case !inA:
+			*changes = append(*changes, Change{Op: "add", Path: childPath, To: bv})
+		case !inB:
+			*changes = append(*changes, Change{Op: "remove", Path: childPath, From: av})
+		default:
+			diffValues(childPath, av, bv, changes)
+		}
+	}
+}
+
+func diffArrays(path string, a, b []any, changes *[]Change) {
+	common := min(len(a), len(b))
+	for i := 0; i < common; i++ {
+		diffValues(path+"/"+strconv.Itoa(i), a[i], b[i], changes)
+	}
+	for i := common; i < len(b); i++ {
+		*changes = append(*changes, Change{Op: "add", Path: path + "/" + strconv.Itoa(i), To: b[i]})
+	}
+	// Report removals from the end so each path is valid when applied in order
+	for i := len(a) - 1; i >= common; i-- {
+		*changes = append(*changes, Change{Op: "remove", Path: path + "/" + strconv.Itoa(i), From: a[i]})
+	}
+}
+
+// escapePointer escapes a key for use as a JSON pointer reference token
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
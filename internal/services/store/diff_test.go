@@ -0,0 +1,227 @@
+package store
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"sawthet.go-press-server.net/internal/models"
+)
+
+// apply applies changes to a JSON document in order, as a JSON Patch would
+func apply(t *testing.T, doc any, changes []Change) any {
+	t.Helper()
+	for _, change := range changes {
+		if change.Path == "" {
+			doc = change.To
+			continue
+		}
+		var tokens []string
+		for _, token := range strings.Split(change.Path[1:], "/") {
+			tokens = append(tokens, strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~"))
+		}
+		doc = applyAt(t, doc, tokens, change)
+	}
+	return doc
+}
+
+// applyAt applies a change to the value at tokens below doc and returns the
+// updated document
+func applyAt(t *testing.T, doc any, tokens []string, change Change) any {
+	t.Helper()
+	token, last := tokens[0], len(tokens) == 1
+	switch v := doc.(type) {
+	case map[string]any:
+		_, exists := v[token]
+		switch {
+		case !last:
+			v[token] = applyAt(t, v[token], tokens[1:], change)
+		case change.Op == "add" && !exists, change.Op == "replace" && exists:
+			v[token] = change.To
+		case change.Op == "remove" && exists:
+			delete(v, token)
+		default:
+			t.Fatalf("cannot %s %s", change.Op, change.Path)
+		}
+		return v
+	case []any:
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i > len(v) || (i == len(v) && (!last || change.Op != "add")) {
+			t.Fatalf("index %q of %s is out of range", token, change.Path)
+		}
+		switch {
+		case !last:
+			v[i] = applyAt(t, v[i], tokens[1:], change)
+		case change.Op == "add":
+			v = append(v[:i], append([]any{change.To}, v[i:]...)...)
+		case change.Op == "replace":
+			v[i] = change.To
+		case change.Op == "remove":
+			v = append(v[:i], v[i+1:]...)
+		}
+		return v
+	}
+	t.Fatalf("%s does not address a value", change.Path)
+	return nil
+}
+
+// pages returns pages with the given titles
+func pages(titles ...string) []models.Page {
+	var list []models.Page
+	for _, title := range titles {
+		list = append(list, models.Page{ID: strings.ToLower(title), Title: title, Slug: "/" + strings.ToLower(title)})
+	}
+	return list
+}
+
+func TestDiff(t *testing.T) {
+	base := models.Project{
+		ID:    "site",
+		Name:  "Site",
+		Pages: pages("Home", "About", "Blog"),
+		GlobalConfig: models.GlobalConfig{Theme: models.Theme{
+			Radii: map[string]string{"DEFAULT": "4px", "a/b": "1px", "c~d": "2px"},
+		}},
+		Build: &models.BuildConfig{Stages: []string{"render", "css", "package"}, Skip: []string{"minify"}},
+	}
+
+	tests := []struct {
+		name   string
+		change func(p *models.Project)
+		want   []Change
+	}{
+		{
+			name:   "no changes",
+			change: func(p *models.Project) {},
+			want:   []Change{},
+		},
+		{
+			name:   "replaced value",
+			change: func(p *models.Project) { p.Name = "New" },
+			want:   []Change{{Op: "replace", Path: "/name", From: "Site", To: "New"}},
+		},
+		{
+			name:   "value within an array element",
+			change: func(p *models.Project) { p.Pages[1].Title = "Team" },
+			want:   []Change{{Op: "replace", Path: "/pages/1/title", From: "About", To: "Team"}},
+		},
+		{
+			name:   "appended elements",
+			change: func(p *models.Project) { p.Build.Skip = append(p.Build.Skip, "optimize", "critical") },
+			want: []Change{
+				{Op: "add", Path: "/build/skip/1", To: "optimize"},
+				{Op: "add", Path: "/build/skip/2", To: "critical"},
+			},
+		},
+		{
+			name:   "removed elements are reported from the end",
+			change: func(p *models.Project) { p.Build.Stages = p.Build.Stages[:1] },
+			want: []Change{
+				{Op: "remove", Path: "/build/stages/2", From: "package"},
+				{Op: "remove", Path: "/build/stages/1", From: "css"},
+			},
+		},
+		{
+			name:   "removed first element shifts the rest",
+			change: func(p *models.Project) { p.Build.Stages = []string{"css", "package"} },
+			want: []Change{
+				{Op: "replace", Path: "/build/stages/0", From: "render", To: "css"},
+				{Op: "replace", Path: "/build/stages/1", From: "css", To: "package"},
+				{Op: "remove", Path: "/build/stages/2", From: "package"},
+			},
+		},
+		{
+			name: "added and removed keys with escaped names",
+			change: func(p *models.Project) {
+				p.GlobalConfig.Theme.Radii = map[string]string{"DEFAULT": "4px", "c~d": "2px", "x/y": "3px"}
+			},
+			want: []Change{
+				{Op: "remove", Path: "/globalConfig/theme/radii/a~1b", From: "1px"},
+				{Op: "add", Path: "/globalConfig/theme/radii/x~1y", To: "3px"},
+			},
+		},
+		{
+			name:   "removed object",
+			change: func(p *models.Project) { p.Build = nil },
+			want: []Change{{Op: "remove", Path: "/build", From: map[string]any{
+				"stages": []any{"render", "css", "package"},
+				"skip":   []any{"minify"},
+			}}},
+		},
+		{
+			name:   "array replaced by null",
+			change: func(p *models.Project) { p.Pages = nil },
+			want: []Change{{Op: "replace", Path: "/pages", From: []any{
+				map[string]any{"id": "home", "title": "Home", "slug": "/home", "components": nil, "created_at": "0001-01-01T00:00:00Z", "updated_at": "0001-01-01T00:00:00Z"},
+				map[string]any{"id": "about", "title": "About", "slug": "/about", "components": nil, "created_at": "0001-01-01T00:00:00Z", "updated_at": "0001-01-01T00:00:00Z"},
+				map[string]any{"id": "blog", "title": "Blog", "slug": "/blog", "components": nil, "created_at": "0001-01-01T00:00:00Z", "updated_at": "0001-01-01T00:00:00Z"},
+			}, To: nil}},
+		},
+	}
+	for _, tt := range tests {
+		changed := clone(t, base)
+		tt.change(&changed)
+
+		changes, err := Diff(base, changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(changes, tt.want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, changes, tt.want)
+		}
+	}
+}
+
+// TestDiffApplies checks that applying the changes in order turns the first
+// project into the second, however their arrays and objects differ
+func TestDiffApplies(t *testing.T) {
+	projects := []models.Project{
+		{},
+		{ID: "site", Name: "Site"},
+		{ID: "site", Pages: pages("Home")},
+		{ID: "site", Pages: pages("Home", "About", "Blog", "Contact")},
+		{ID: "site", Pages: pages("Blog", "Home")},
+		{ID: "site", Pages: []models.Page{}, Build: &models.BuildConfig{Stages: []string{"render", "package"}}},
+		{ID: "site", Build: &models.BuildConfig{Skip: []string{"css", "minify", "optimize"}, InlineCSS: true}},
+		{ID: "site", GlobalConfig: models.GlobalConfig{Theme: models.Theme{
+			Breakpoints: map[string]string{"tablet": "700px"},
+			Palettes:    map[string]models.ColorScale{"brand": {"500": "#f00", "600": "#e00"}},
+		}}},
+		{ID: "site", GlobalConfig: models.GlobalConfig{Theme: models.Theme{
+			Palettes: map[string]models.ColorScale{"brand": {"500": "#0f0"}, "accent": {"DEFAULT": "#00f"}},
+		}}},
+	}
+	for i, a := range projects {
+		for j, b := range projects {
+			changes, err := Diff(a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i == j && len(changes) != 0 {
+				t.Errorf("project %d differs from itself: %+v", i, changes)
+			}
+
+			docA, _ := toDocument(a)
+			docB, _ := toDocument(b)
+			if got := apply(t, docA, changes); !reflect.DeepEqual(got, docB) {
+				t.Errorf("applying the diff of project %d to %d gives %v, want %v", i, j, got, docB)
+			}
+		}
+	}
+}
+
+// clone returns a deep copy of a project
+func clone(t *testing.T, project models.Project) models.Project {
+	t.Helper()
+	data, err := json.Marshal(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var copied models.Project
+	if err := json.Unmarshal(data, &copied); err != nil {
+		t.Fatal(err)
+	}
+	return copied
+}
@@ -0,0 +1,342 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/utils"
+)
+
+// FileStore keeps the latest version of each project as a JSON file named
+// after its ID, and every revision under revisions/<id>/ together with an
+// index of their metadata, so saving and listing do not decode snapshots
+type FileStore struct {
+	dir string
+	mux sync.RWMutex
+}
+
+// NewFileStore creates a file-backed store rooted at dir
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create project directory: %v", err)
+	}
+
+	return &FileStore{
+		dir: dir,
+	}, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *FileStore) revisionsDir(id string) string {
+	return filepath.Join(s.dir, "revisions", id)
+}
+
+func (s *FileStore) revisionPath(id string, number int) string {
+	return filepath.Join(s.revisionsDir(id), fmt.Sprintf("%06d.json", number))
+}
+
+func (s *FileStore) indexPath(id string) string {
+	return filepath.Join(s.revisionsDir(id), "index.json")
+}
+
+func (s *FileStore) List() ([]models.Project, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(ids)
+
+	projects := make([]models.Project, 0, len(ids))
+	for _, id := range ids {
+		project, err := s.read(id)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+
+	return projects, nil
+}
+
+func (s *FileStore) Get(id string) (models.Project, error) {
+	if err := ValidateID(id); err != nil {
+		return models.Project{}, err
+	}
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.read(id)
+}
+
+func (s *FileStore) Create(project models.Project, info RevisionInfo) (Revision, error) {
+	if err := ValidateID(project.ID); err != nil {
+		return Revision{}, err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, err := os.Stat(s.path(project.ID)); err == nil {
+		return Revision{}, ErrAlreadyExists
+	}
+
+	// Drop any revisions left behind by a previously deleted project
+	if err := os.RemoveAll(s.revisionsDir(project.ID)); err != nil {
+		return Revision{}, err
+	}
+
+	return s.save(project, 1, info)
+}
+
+func (s *FileStore) Update(project models.Project, info RevisionInfo) (Revision, error) {
+	if err := ValidateID(project.ID); err != nil {
+		return Revision{}, err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, err := os.Stat(s.path(project.ID)); os.IsNotExist(err) {
+		return Revision{}, ErrNotFound
+	}
+
+	last, err := s.lastRevision(project.ID)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	return s.save(project, last+1, info)
+}
+
+func (s *FileStore) Delete(id string) error {
+	if err := ValidateID(id); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if err := os.Remove(s.path(id)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return os.RemoveAll(s.revisionsDir(id))
+}
+
+func (s *FileStore) ListRevisions(id string) ([]Revision, error) {
+	if err := ValidateID(id); err != nil {
+		return nil, err
+	}
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	if _, err := os.Stat(s.path(id)); os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return s.readIndex(id)
+}
+
+func (s *FileStore) GetRevision(id string, number int) (models.Project, Revision, error) {
+	if err := ValidateID(id); err != nil {
+		return models.Project{}, Revision{}, err
+	}
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	if _, err := os.Stat(s.path(id)); os.IsNotExist(err) {
+		return models.Project{}, Revision{}, ErrNotFound
+	}
+
+	record, err := s.readRevision(id, number)
+	if err != nil {
+		return models.Project{}, Revision{}, err
+	}
+
+	return record.Project, record.Revision, nil
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// read loads a project file; callers must hold the lock
+func (s *FileStore) read(id string) (models.Project, error) {
+	var project models.Project
+
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return project, ErrNotFound
+		}
+		return project, err
+	}
+
+	if err := json.Unmarshal(data, &project); err != nil {
+		return project, fmt.Errorf("failed to decode project %s: %w", id, err)
+	}
+	project.ID = id
+
+	return project, nil
+}
+
+// readRevision loads a single revision record; callers must hold the lock
+func (s *FileStore) readRevision(id string, number int) (revisionRecord, error) {
+	var record revisionRecord
+
+	data, err := os.ReadFile(s.revisionPath(id, number))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return record, ErrRevisionNotFound
+		}
+		return record, err
+	}
+
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, fmt.Errorf("failed to decode revision %d of project %s: %w", number, id, err)
+	}
+
+	return record, nil
+}
+
+// revisionNumbers returns the numbers of a project's revision files in
+// order, without reading them; callers must hold the lock
+func (s *FileStore) revisionNumbers(id string) ([]int, error) {
+	entries, err := os.ReadDir(s.revisionsDir(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Revision files are zero padded, so directory order is revision order;
+	// the index and temporary files are not numbered
+	var numbers []int
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		number, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		numbers = append(numbers, number)
+	}
+
+	return numbers, nil
+}
+
+// lastRevision returns the highest revision number of a project, or 0 when it
+// has none; callers must hold the lock
+func (s *FileStore) lastRevision(id string) (int, error) {
+	numbers, err := s.revisionNumbers(id)
+	if err != nil || len(numbers) == 0 {
+		return 0, err
+	}
+	return numbers[len(numbers)-1], nil
+}
+
+// readIndex returns the metadata of a project's revisions in order; callers
+// must hold the lock. An index that is missing or lags behind the revision
+// files, as after a crash between writing the two, is rebuilt from the
+// revisions themselves.
+func (s *FileStore) readIndex(id string) ([]Revision, error) {
+	numbers, err := s.revisionNumbers(id)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := []Revision{}
+	data, err := os.ReadFile(s.indexPath(id))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &revisions); err != nil {
+			return nil, fmt.Errorf("failed to decode revision index of project %s: %w", id, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+	if len(revisions) == len(numbers) && (len(numbers) == 0 || revisions[len(revisions)-1].Number == numbers[len(numbers)-1]) {
+		return revisions, nil
+	}
+
+	revisions = make([]Revision, 0, len(numbers))
+	for _, number := range numbers {
+		record, err := s.readRevision(id, number)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, record.Revision)
+	}
+
+	return revisions, nil
+}
+
+// save records a new revision and makes it the latest version; callers must hold the lock
+func (s *FileStore) save(project models.Project, number int, info RevisionInfo) (Revision, error) {
+	record, rev, err := newRevisionRecord(project, number, info)
+	if err != nil {
+		return Revision{}, fmt.Errorf("failed to encode project %s: %w", project.ID, err)
+	}
+
+	// Read the index before the new revision is written, while it is in
+	// step with the revision files
+	revisions, err := s.readIndex(project.ID)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	if err := os.MkdirAll(s.revisionsDir(project.ID), 0755); err != nil {
+		return Revision{}, err
+	}
+	if err := utils.WriteFileAtomic(s.revisionPath(project.ID, number), record); err != nil {
+		return Revision{}, err
+	}
+
+	index, err := json.Marshal(append(revisions, rev))
+	if err != nil {
+		return Revision{}, fmt.Errorf("failed to encode revision index of project %s: %w", project.ID, err)
+	}
+	if err := utils.WriteFileAtomic(s.indexPath(project.ID), index); err != nil {
+		return Revision{}, err
+	}
+
+	data, err := json.MarshalIndent(project, "", "  ")
+	if err != nil {
+		return Revision{}, fmt.Errorf("failed to encode project %s: %w", project.ID, err)
+	}
+	if err := utils.WriteFileAtomic(s.path(project.ID), data); err != nil {
+		return Revision{}, err
+	}
+
+	return rev, nil
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/utils"
+)
+
+var (
+	// ErrNotFound is returned when a project does not exist in the store
+	ErrNotFound = errors.New("project not found")
+	// ErrAlreadyExists is returned when creating a project whose ID is taken
+	ErrAlreadyExists = errors.New("project already exists")
+	// ErrInvalidID is returned when a project ID contains unsupported characters
+	ErrInvalidID = errors.New("invalid project ID")
+	// ErrRevisionNotFound is returned when a project has no revision with the given number
+	ErrRevisionNotFound = errors.New("revision not found")
+)
+
+// RevisionInfo describes who saved a project and why
+type RevisionInfo struct {
+	Author  string
+	Message string
+}
+
+// Revision is the metadata of an immutable, numbered save of a project
+type Revision struct {
+	Number    int       `json:"number"`
+	Author    string    `json:"author,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// revisionRecord is the persisted form of a revision and its project snapshot
+type revisionRecord struct {
+	Revision Revision       `json:"revision"`
+	Project  models.Project `json:"project"`
+}
+
+// ProjectStore persists project definitions by ID, keeping every save as a revision
+type ProjectStore interface {
+	// List returns all stored projects ordered by ID
+	List() ([]models.Project, error)
+	// Get returns the latest saved version of a project
+	Get(id string) (models.Project, error)
+	// Create stores a new project as revision 1, failing if the ID is already taken
+	Create(project models.Project, info RevisionInfo) (Revision, error)
+	// Update replaces an existing project and records a new revision
+	Update(project models.Project, info RevisionInfo) (Revision, error)
+	// Delete removes a project and all of its revisions
+	Delete(id string) error
+	// ListRevisions returns the revisions of a project, oldest first
+	ListRevisions(id string) ([]Revision, error)
+	// GetRevision returns the project as it was saved in the given revision
+	GetRevision(id string, number int) (models.Project, Revision, error)
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// ValidateID checks that a project ID can be stored
+func ValidateID(id string) error {
+	if !utils.ValidID(id) {
+		return ErrInvalidID
+	}
+	return nil
+}
+
+// newRevisionRecord encodes a project snapshot together with its revision metadata
+func newRevisionRecord(project models.Project, number int, info RevisionInfo) ([]byte, Revision, error) {
+	data, err := json.Marshal(project)
+	if err != nil {
+		return nil, Revision{}, err
+	}
+
+	sum := sha256.Sum256(data)
+	rev := Revision{
+		Number:    number,
+		Author:    info.Author,
+		Message:   info.Message,
+		Hash:      hex.EncodeToString(sum[:]),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	record, err := json.Marshal(revisionRecord{Revision: rev, Project: project})
+	if err != nil {
+		return nil, Revision{}, err
+	}
+
+	return record, rev, nil
+}
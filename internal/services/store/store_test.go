@@ -0,0 +1,313 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+	"sawthet.go-press-server.net/internal/models"
+)
+
+// stores opens each kind of store in a temporary directory
+func stores(t *testing.T) map[string]ProjectStore {
+	t.Helper()
+	files, err := NewFileStore(filepath.Join(t.TempDir(), "projects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "projects.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bolt.Close() })
+	return map[string]ProjectStore{"file": files, "bolt": bolt}
+}
+
+// numbers returns the numbers of revisions in order
+func numbers(revisions []Revision) []int {
+	out := []int{}
+	for _, rev := range revisions {
+		out = append(out, rev.Number)
+	}
+	return out
+}
+
+func TestRestoreRevision(t *testing.T) {
+	original := models.Project{
+		ID:    "site",
+		Name:  "Site",
+		Pages: pages("Home", "About", "Blog"),
+		GlobalConfig: models.GlobalConfig{Theme: models.Theme{
+			Radii: map[string]string{"DEFAULT": "4px", "card": "12px"},
+		}},
+		Build: &models.BuildConfig{Stages: []string{"render", "css", "package"}, Skip: []string{"minify"}},
+	}
+	edited := clone(t, original)
+	edited.Name = "Renamed"
+	edited.Pages = edited.Pages[:1]
+	edited.GlobalConfig.Theme.Radii = map[string]string{"DEFAULT": "4px"}
+	edited.Build = nil
+
+	for name, s := range stores(t) {
+		if _, err := s.Create(original, RevisionInfo{Author: "ann", Message: "first"}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := s.Update(edited, RevisionInfo{Author: "bob"}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// The edit removed array elements and object keys
+		first, _, err := s.GetRevision("site", 1)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		second, _, err := s.GetRevision("site", 2)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		forward, err := Diff(first, second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{
+			"remove /build",
+			"remove /globalConfig/theme/radii/card",
+			"replace /name",
+			"remove /pages/2",
+			"remove /pages/1",
+		}; !sameChanges(forward, want) {
+			t.Errorf("%s: changes of revision 2 = %+v, want %v", name, forward, want)
+		}
+
+		// Restoring saves the old revision again as a new one
+		rev, err := s.Update(first, RevisionInfo{Message: "Restore revision 1"})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if rev.Number != 3 {
+			t.Errorf("%s: restore saved revision %d, want 3", name, rev.Number)
+		}
+
+		latest, err := s.Get("site")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if changes, _ := Diff(original, latest); len(changes) != 0 {
+			t.Errorf("%s: restored project differs from revision 1: %+v", name, changes)
+		}
+		_, third, err := s.GetRevision("site", 3)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		_, firstRev, _ := s.GetRevision("site", 1)
+		if third.Hash != firstRev.Hash {
+			t.Errorf("%s: restored revision hash %s, want %s", name, third.Hash, firstRev.Hash)
+		}
+
+		// The restore undoes each change of the edit, arrays included
+		backward, err := Diff(second, latest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, _ := toDocument(second)
+		want, _ := toDocument(original)
+		if got := apply(t, doc, backward); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: applying the restore's changes gives %v, want %v", name, got, want)
+		}
+
+		// History is kept intact
+		revisions, err := s.ListRevisions("site")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := numbers(revisions); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+			t.Errorf("%s: revisions = %v, want [1 2 3]", name, got)
+		}
+		if revisions[0].Author != "ann" || revisions[0].Message != "first" || revisions[2].Message != "Restore revision 1" {
+			t.Errorf("%s: revision metadata = %+v", name, revisions)
+		}
+	}
+}
+
+// sameChanges reports whether changes have the given ops and paths, in order
+func sameChanges(changes []Change, want []string) bool {
+	got := []string{}
+	for _, change := range changes {
+		got = append(got, change.Op+" "+change.Path)
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func TestRevisionErrors(t *testing.T) {
+	for name, s := range stores(t) {
+		if _, err := s.Update(models.Project{ID: "site"}, RevisionInfo{}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: updating a missing project: %v, want %v", name, err, ErrNotFound)
+		}
+		if _, _, err := s.GetRevision("site", 1); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: revision of a missing project: %v, want %v", name, err, ErrNotFound)
+		}
+		if _, err := s.Create(models.Project{ID: "../site"}, RevisionInfo{}); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("%s: invalid ID: %v, want %v", name, err, ErrInvalidID)
+		}
+
+		if _, err := s.Create(models.Project{ID: "site"}, RevisionInfo{}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := s.Create(models.Project{ID: "site"}, RevisionInfo{}); !errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("%s: creating a taken ID: %v, want %v", name, err, ErrAlreadyExists)
+		}
+		for _, number := range []int{0, 2} {
+			if _, _, err := s.GetRevision("site", number); !errors.Is(err, ErrRevisionNotFound) {
+				t.Errorf("%s: revision %d: %v, want %v", name, number, err, ErrRevisionNotFound)
+			}
+		}
+
+		// A project created again after being deleted starts a new history
+		if _, err := s.Update(models.Project{ID: "site", Name: "Two"}, RevisionInfo{}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := s.Delete("site"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := s.ListRevisions("site"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: revisions of a deleted project: %v, want %v", name, err, ErrNotFound)
+		}
+		rev, err := s.Create(models.Project{ID: "site"}, RevisionInfo{})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		revisions, _ := s.ListRevisions("site")
+		if rev.Number != 1 || !reflect.DeepEqual(numbers(revisions), []int{1}) {
+			t.Errorf("%s: recreated project has revision %d of %v, want 1 of [1]", name, rev.Number, numbers(revisions))
+		}
+	}
+}
+
+func TestListRevisionsWithoutRevisions(t *testing.T) {
+	for name, s := range stores(t) {
+		if _, err := s.Create(models.Project{ID: "site"}, RevisionInfo{}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// Projects saved before revisions were kept have none
+		var err error
+		switch s := s.(type) {
+		case *FileStore:
+			err = os.RemoveAll(s.revisionsDir("site"))
+		case *BoltStore:
+			err = s.db.Update(func(tx *bolt.Tx) error {
+				return tx.Bucket(revisionsBucket).DeleteBucket([]byte("site"))
+			})
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		revisions, err := s.ListRevisions("site")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// Both stores list no revisions as an empty JSON array
+		if data, _ := json.Marshal(revisions); string(data) != "[]" {
+			t.Errorf("%s: revisions = %s, want []", name, data)
+		}
+	}
+}
+
+func TestConcurrentUpdatesNumberRevisions(t *testing.T) {
+	for name, s := range stores(t) {
+		if _, err := s.Create(models.Project{ID: "site"}, RevisionInfo{}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		const writers, saves = 4, 10
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < saves; j++ {
+					project := models.Project{ID: "site", Name: fmt.Sprintf("%d-%d", i, j)}
+					if _, err := s.Update(project, RevisionInfo{}); err != nil {
+						t.Error(err)
+					}
+					if _, err := s.ListRevisions("site"); err != nil {
+						t.Error(err)
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		revisions, err := s.ListRevisions("site")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want := []int{}
+		for number := 1; number <= 1+writers*saves; number++ {
+			want = append(want, number)
+		}
+		if got := numbers(revisions); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: revisions = %v, want 1 to %d without gaps", name, got, len(want))
+		}
+	}
+}
+
+func TestFileStoreRebuildsRevisionIndex(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create(models.Project{ID: "site"}, RevisionInfo{Message: "one"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Update(models.Project{ID: "site"}, RevisionInfo{Message: "two"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A missing index, as after upgrading from a store without one, is
+	// rebuilt from the revisions and kept up to date by the next save
+	if err := os.Remove(s.indexPath("site")); err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := s.ListRevisions("site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := numbers(revisions); !reflect.DeepEqual(got, []int{1, 2}) || revisions[1].Message != "two" {
+		t.Errorf("rebuilt index = %+v", revisions)
+	}
+	if _, err := s.Update(models.Project{ID: "site"}, RevisionInfo{Message: "three"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.indexPath("site")); err != nil {
+		t.Errorf("index was not written again: %v", err)
+	}
+
+	// An index lagging behind the revision files, as after a crash between
+	// writing the two, is rebuilt too
+	record, _, err := newRevisionRecord(models.Project{ID: "site"}, 4, RevisionInfo{Message: "four"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.revisionPath("site", 4), record, 0644); err != nil {
+		t.Fatal(err)
+	}
+	revisions, err = s.ListRevisions("site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := numbers(revisions); !reflect.DeepEqual(got, []int{1, 2, 3, 4}) || revisions[3].Message != "four" {
+		t.Errorf("index after a crash = %+v, want revisions 1 to 4", revisions)
+	}
+	if rev, err := s.Update(models.Project{ID: "site"}, RevisionInfo{}); err != nil || rev.Number != 5 {
+		t.Errorf("save after a crash = revision %d, %v; want 5", rev.Number, err)
+	}
+}
@@ -2,18 +2,36 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"sawthet.go-press-server.net/internal/models"
 )
 
+// StylesheetPlaceholder is written by the layout where the site stylesheet
+// belongs. The CSS stage replaces it once the stylesheet is compiled, as its
+// fingerprinted name depends on the rendered pages.
+const StylesheetPlaceholder = "<!--press:stylesheet-->"
+
+// ContentMarker is written by the layout where the page content starts, after
+// the header, so the CSS stage can find what is visible without scrolling
+const ContentMarker = "<!--press:content-->"
+
 // TemplateService handles template generation
 type TemplateService struct {
-	templates *template.Template
+	templates   *template.Template
+	fingerprint string
 }
 
 // NewTemplateService creates a new template service
@@ -65,6 +83,12 @@ func NewTemplateService() (*TemplateService, error) {
 		"getYear": func() int {
 			return time.Now().Year()
 		},
+		"stylesheet": func() template.HTML {
+			return StylesheetPlaceholder
+		},
+		"content": func() template.HTML {
+			return ContentMarker
+		},
 	})
 
 	// Parse all template files
@@ -76,55 +100,208 @@ func NewTemplateService() (*TemplateService, error) {
 		"internal/templates/*.tmpl",
 	}
 
+	hash := sha256.New()
 	for _, pattern := range patterns {
 		_, err := tmpl.ParseGlob(pattern)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse templates: %v", err)
 		}
+
+		// Fingerprint the template sources so cached output is invalidated
+		// when a template changes
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list templates: %v", err)
+		}
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read template %s: %v", file, err)
+			}
+			hash.Write([]byte(file))
+			hash.Write(content)
+		}
 	}
 
 	return &TemplateService{
-		templates: tmpl,
+		templates:   tmpl,
+		fingerprint: hex.EncodeToString(hash.Sum(nil)),
 	}, nil
 }
 
-// GenerateHTML generates HTML from the project data
-func (s *TemplateService) GenerateHTML(project models.Project, updateProgress func(int, string)) (map[string][]byte, error) {
-	// Create a map to store all HTML files
-	htmlFiles := make(map[string][]byte)
+// Fingerprint returns a hash of the template sources
+func (s *TemplateService) Fingerprint() string {
+	return s.fingerprint
+}
 
-	// Generate pages
-	var totalToRender int = len(project.Pages)
+// PageError reports a page that failed to render
+type PageError struct {
+	Title    string
+	Filename string
+	// Component is the ID of the top-level component that failed to render,
+	// when the failure could be narrowed down to one
+	Component string
+	Err       error
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf("failed to generate page %s: %v", e.Title, e.Err)
+}
+
+func (e *PageError) Unwrap() error {
+	return e.Err
+}
+
+// RenderError collects every page that failed to render, in page order
+type RenderError struct {
+	Pages []*PageError
+}
+
+func (e *RenderError) Error() string {
+	if len(e.Pages) == 1 {
+		return e.Pages[0].Error()
+	}
+
+	messages := make([]string, len(e.Pages))
+	for i, page := range e.Pages {
+		messages[i] = page.Error()
+	}
+	return fmt.Sprintf("%d pages failed: %s", len(e.Pages), strings.Join(messages, "; "))
+}
+
+func (e *RenderError) Unwrap() []error {
+	errs := make([]error, len(e.Pages))
+	for i, page := range e.Pages {
+		errs[i] = page
+	}
+	return errs
+}
+
+// RenderOptions configures how pages are rendered
+type RenderOptions struct {
+	// Workers is the number of pages rendered concurrently; zero uses one per CPU
+	Workers int
+	// Draft renders preview pages styled by the Tailwind CDN instead of the
+	// compiled stylesheet
+	Draft bool
+	// PageRendered, when set, is called with every page rendered successfully
+	// and how long it took; it is never called concurrently
+	PageRendered func(page models.Page, elapsed time.Duration)
+}
 
+// GenerateHTML renders the project's pages on up to options.Workers
+// goroutines, stopping early if ctx is cancelled. updateProgress is never
+// called concurrently and reports steadily increasing progress. Every page is
+// attempted; failures are returned together as a *RenderError.
+func (s *TemplateService) GenerateHTML(ctx context.Context, project models.Project, options RenderOptions, updateProgress func(int, string)) (map[string][]byte, error) {
 	totalPages := len(project.Pages)
-	for i, page := range project.Pages {
-		progress := (i * 100) / totalPages
-		updateProgress(progress, fmt.Sprintf("Generating static page: %d of %d ...", i+1, totalToRender))
-
-		// Create a buffer for the page
-		var pageBuf bytes.Buffer
-
-		// Execute the template with the page data
-		err := s.templates.ExecuteTemplate(&pageBuf, "layouts/default", struct {
-			models.Project
-			Page models.Page
-		}{
-			Project: project,
-			Page:    page,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to generate page %s: %v", page.Title, err)
+	workers := options.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	workers = min(workers, totalPages)
+
+	// Results are stored by page index so the output does not depend on
+	// which worker finished first
+	results := make([][]byte, totalPages)
+	pageErrors := make([]error, totalPages)
+
+	var progressMux sync.Mutex
+	rendered := 0
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				started := time.Now()
+				results[i], pageErrors[i] = s.renderPage(project, project.Pages[i], options.Draft)
+				elapsed := time.Since(started)
+
+				progressMux.Lock()
+				if pageErrors[i] == nil && options.PageRendered != nil {
+					options.PageRendered(project.Pages[i], elapsed)
+				}
+				rendered++
+				updateProgress((rendered*100)/totalPages, fmt.Sprintf("Generated static page: %d of %d ...", rendered, totalPages))
+				progressMux.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for i := range project.Pages {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
 		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-		// Generate filename based on slug
-		filename := strings.TrimPrefix(page.Slug, "/")
-		if filename == "" {
-			filename = "index.html"
-		} else {
-			filename = filename + ".html"
+	// Create a map to store all HTML files
+	htmlFiles := make(map[string][]byte, totalPages)
+	renderErr := &RenderError{}
+	for i, page := range project.Pages {
+		if pageErrors[i] != nil {
+			renderErr.Pages = append(renderErr.Pages, &PageError{
+				Title:     page.Title,
+				Filename:  page.Filename(),
+				Component: s.failingComponent(project, page),
+				Err:       pageErrors[i],
+			})
+			continue
 		}
-		htmlFiles[filename] = pageBuf.Bytes()
+		htmlFiles[page.Filename()] = results[i]
+	}
+	if len(renderErr.Pages) > 0 {
+		return nil, renderErr
 	}
 
 	return htmlFiles, nil
 }
+
+// renderPage executes the page layout for a single page
+func (s *TemplateService) renderPage(project models.Project, page models.Page, draft bool) ([]byte, error) {
+	var pageBuf bytes.Buffer
+	err := s.templates.ExecuteTemplate(&pageBuf, "layouts/default", struct {
+		models.Project
+		Page  models.Page
+		Draft bool
+	}{
+		Project: project,
+		Page:    page,
+		Draft:   draft,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pageBuf.Bytes(), nil
+}
+
+// failingComponent renders the top-level components of a page that failed
+// to render one by one and returns the ID of the first that fails, or ""
+// when the failure lies elsewhere, such as in the header or footer
+func (s *TemplateService) failingComponent(project models.Project, page models.Page) string {
+	for _, component := range page.Components {
+		if component.Component == nil {
+			continue
+		}
+		err := s.templates.ExecuteTemplate(io.Discard, "render", map[string]any{
+			"Component": component.Component,
+			"Page":      page,
+			"Project":   project,
+		})
+		if err != nil {
+			return component.GetID()
+		}
+	}
+	return ""
+}
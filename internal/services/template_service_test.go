@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"sawthet.go-press-server.net/internal/models"
+)
+
+// newTestTemplateService parses the templates, which are looked up relative
+// to the repository root
+func newTestTemplateService(t *testing.T) *TemplateService {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("../.."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	s, err := NewTemplateService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// siteWithPages returns a project with n pages; the pages at the broken
+// indexes hold a component that fails to render
+func siteWithPages(n int, broken ...int) models.Project {
+	project := models.Project{
+		ID:     "site",
+		Name:   "Site",
+		Header: models.ComponentWrapper{Component: &models.HeaderComponent{BaseComponent: models.BaseComponent{Type: "header"}}},
+		Footer: models.ComponentWrapper{Component: &models.FooterComponent{BaseComponent: models.BaseComponent{Type: "footer"}}},
+	}
+	for i := 0; i < n; i++ {
+		page := models.Page{
+			ID:    fmt.Sprintf("page-%d", i),
+			Title: fmt.Sprintf("Page %d", i),
+			Slug:  fmt.Sprintf("/page-%d", i),
+			Components: []models.ComponentWrapper{{Component: &models.TextComponent{
+				BaseComponent: models.BaseComponent{Type: "text", ID: fmt.Sprintf("text-%d", i), Content: fmt.Sprintf("Content %d", i)},
+			}}},
+		}
+		project.Pages = append(project.Pages, page)
+	}
+	for _, i := range broken {
+		// A text component claiming to be an image has no src to render
+		project.Pages[i].Components = append(project.Pages[i].Components, models.ComponentWrapper{Component: &models.TextComponent{
+			BaseComponent: models.BaseComponent{Type: "image", ID: fmt.Sprintf("broken-%d", i)},
+		}})
+	}
+	return project
+}
+
+func TestGenerateHTMLIsDeterministic(t *testing.T) {
+	s := newTestTemplateService(t)
+	project := siteWithPages(24)
+
+	want, err := s.GenerateHTML(context.Background(), project, RenderOptions{Workers: 1}, func(int, string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != len(project.Pages) {
+		t.Fatalf("rendered %d pages, want %d", len(want), len(project.Pages))
+	}
+
+	for _, workers := range []int{0, 2, 8, 100} {
+		var progress []int
+		var pages []string
+		got, err := s.GenerateHTML(context.Background(), project, RenderOptions{
+			Workers: workers,
+			PageRendered: func(page models.Page, elapsed time.Duration) {
+				pages = append(pages, page.ID)
+			},
+		}, func(p int, message string) {
+			progress = append(progress, p)
+		})
+		if err != nil {
+			t.Fatalf("%d workers: %v", workers, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d workers: output differs from a single worker's", workers)
+		}
+		if len(pages) != len(project.Pages) {
+			t.Errorf("%d workers: PageRendered called for %d pages, want %d", workers, len(pages), len(project.Pages))
+		}
+		for i := 1; i < len(progress); i++ {
+			if progress[i] < progress[i-1] {
+				t.Errorf("%d workers: progress went back from %d to %d", workers, progress[i-1], progress[i])
+			}
+		}
+		if len(progress) == 0 || progress[len(progress)-1] != 100 {
+			t.Errorf("%d workers: progress %v does not end at 100", workers, progress)
+		}
+	}
+}
+
+func TestGenerateHTMLCollectsEveryFailure(t *testing.T) {
+	s := newTestTemplateService(t)
+	project := siteWithPages(10, 7, 1, 4)
+
+	var rendered int
+	pages, err := s.GenerateHTML(context.Background(), project, RenderOptions{
+		Workers: 4,
+		PageRendered: func(page models.Page, elapsed time.Duration) {
+			rendered++
+		},
+	}, func(int, string) {})
+	if pages != nil {
+		t.Errorf("failed render returned %d pages", len(pages))
+	}
+
+	var renderErr *RenderError
+	if !errors.As(err, &renderErr) {
+		t.Fatalf("error = %v, want a *RenderError", err)
+	}
+	// Failures are reported in page order, with the component at fault
+	var got []string
+	for _, page := range renderErr.Pages {
+		got = append(got, page.Filename+" "+page.Component)
+		if page.Err == nil || !errors.Is(err, page.Err) {
+			t.Errorf("page %s: error %v is not wrapped", page.Filename, page.Err)
+		}
+	}
+	want := []string{"page-1.html broken-1", "page-4.html broken-4", "page-7.html broken-7"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("failed pages = %v, want %v", got, want)
+	}
+	if rendered != 7 {
+		t.Errorf("PageRendered called for %d pages, want the 7 that rendered", rendered)
+	}
+
+	// A single failure reads as the page's own error
+	_, err = s.GenerateHTML(context.Background(), siteWithPages(3, 2), RenderOptions{}, func(int, string) {})
+	if !errors.As(err, &renderErr) || len(renderErr.Pages) != 1 || err.Error() != renderErr.Pages[0].Error() {
+		t.Errorf("single failure = %v", err)
+	}
+}
+
+func TestGenerateHTMLStopsWhenCancelled(t *testing.T) {
+	s := newTestTemplateService(t)
+	project := siteWithPages(50)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if pages, err := s.GenerateHTML(ctx, project, RenderOptions{}, func(int, string) {}); !errors.Is(err, context.Canceled) || pages != nil {
+		t.Errorf("cancelled render = %d pages, %v; want %v", len(pages), err, context.Canceled)
+	}
+
+	// Cancelling after the first page leaves the rest unrendered
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	rendered := 0
+	pages, err := s.GenerateHTML(ctx, project, RenderOptions{
+		Workers: 1,
+		PageRendered: func(page models.Page, elapsed time.Duration) {
+			rendered++
+			cancel()
+		},
+	}, func(int, string) {})
+	if !errors.Is(err, context.Canceled) || pages != nil {
+		t.Errorf("render cancelled midway = %d pages, %v; want %v", len(pages), err, context.Canceled)
+	}
+	if rendered >= len(project.Pages) {
+		t.Errorf("rendered all %d pages after being cancelled", rendered)
+	}
+}
@@ -0,0 +1,359 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"sawthet.go-press-server.net/internal/models"
+)
+
+// Theme values end up in generated CSS and in the Tailwind config, so they
+// are checked against strict grammars rather than for characters to avoid
+var (
+	lengthPattern     = regexp.MustCompile(`^(0|-?(\d+|\d*\.\d+)(px|rem|em|%|vh|vw|ch|ex|pt))$`)
+	breakpointPattern = regexp.MustCompile(`^(\d+|\d*\.\d+)(px|rem|em)$`)
+	numberPattern     = regexp.MustCompile(`^(\d+|\d*\.\d+)$`)
+	fontNamePattern   = regexp.MustCompile(`^[A-Za-z0-9]+([ _-][A-Za-z0-9]+)*$`)
+)
+
+// IsValidLength reports whether a value is zero or a number with a CSS unit
+func IsValidLength(value string) bool {
+	return lengthPattern.MatchString(value)
+}
+
+// IsValidBreakpoint reports whether a value is a width in px, rem or em
+func IsValidBreakpoint(value string) bool {
+	return breakpointPattern.MatchString(value)
+}
+
+// IsValidLineHeight reports whether a value is a unitless number or a length
+func IsValidLineHeight(value string) bool {
+	return numberPattern.MatchString(value) || IsValidLength(value)
+}
+
+// IsValidFontName reports whether a value is a single, unquoted font family
+// name made of words separated by spaces, "-" or "_"
+func IsValidFontName(value string) bool {
+	return fontNamePattern.MatchString(value)
+}
+
+// IsValidFontFamily reports whether a value is a comma-separated list of font
+// family names
+func IsValidFontFamily(value string) bool {
+	for _, name := range strings.Split(value, ",") {
+		if !IsValidFontName(strings.Trim(name, " ")) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsValidShadow reports whether a value is "none" or a comma-separated list
+// of shadows made of lengths, colors and the inset keyword
+func IsValidShadow(value string) bool {
+	if value == "none" {
+		return true
+	}
+	layers, ok := splitTopLevel(value, ',')
+	if !ok {
+		return false
+	}
+	for _, layer := range layers {
+		parts, ok := splitTopLevel(layer, ' ')
+		if !ok {
+			return false
+		}
+		lengths := 0
+		for _, part := range parts {
+			switch {
+			case part == "":
+			case part == "inset":
+			case IsValidLength(part):
+				lengths++
+			case IsValidColor(part):
+			default:
+				return false
+			}
+		}
+		if lengths < 2 || lengths > 4 {
+			return false
+		}
+	}
+	return true
+}
+
+// splitTopLevel splits a value on sep outside parentheses, reporting whether
+// the parentheses are balanced
+func splitTopLevel(value string, sep byte) ([]string, bool) {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, false
+			}
+		case sep:
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(value[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(value[start:])), depth == 0
+}
+
+func (v *validator) validateTheme(theme models.Theme) {
+	colors := []struct {
+		name  string
+		value string
+	}{
+		{"primary", theme.Colors.Primary},
+		{"secondary", theme.Colors.Secondary},
+		{"background", theme.Colors.Background},
+		{"text", theme.Colors.Text},
+	}
+
+	for _, color := range colors {
+		path := "/globalConfig/theme/colors/" + color.name
+		if color.value == "" {
+			v.add(SeverityWarning, "missing-color", path, "theme color %q is not set", color.name)
+			continue
+		}
+		if !IsValidColor(color.value) {
+			v.add(SeverityError, "invalid-color", path, "theme color %q has invalid value %q", color.name, color.value)
+		}
+	}
+
+	if family := theme.Typography.FontFamily; family != "" && !IsValidFontFamily(family) {
+		v.add(SeverityError, "invalid-font", "/globalConfig/theme/typography/fontFamily", "font family %q must be a comma-separated list of font names", family)
+	}
+	v.validateTokens("/globalConfig/theme/typography/fontSizes", "font size", fontSizes(theme.Typography.FontSizes), IsValidLength)
+	v.validateTokens("/globalConfig/theme/spacing", "spacing", spacing(theme.Spacing), IsValidLength)
+
+	v.validatePalettes("/globalConfig/theme/palettes", theme.Palettes)
+	v.validateFontFamilies(theme.Typography.FontFamilies)
+	v.validateTokens("/globalConfig/theme/typography/lineHeights", "line height", theme.Typography.LineHeights, IsValidLineHeight)
+	v.validateTokens("/globalConfig/theme/radii", "radius", theme.Radii, IsValidLength)
+	v.validateTokens("/globalConfig/theme/shadows", "shadow", theme.Shadows, IsValidShadow)
+	v.validateTokens("/globalConfig/theme/breakpoints", "breakpoint", theme.Breakpoints, IsValidBreakpoint)
+
+	if theme.Dark != nil {
+		v.validateDarkTheme(*theme.Dark)
+	}
+}
+
+// validateTokenName checks that a token can be used in class and custom
+// property names
+func (v *validator) validateTokenName(path, kind, name string) bool {
+	if models.IsTokenName(name) {
+		return true
+	}
+	v.add(SeverityError, "invalid-token-name", path, "%s name %q may only contain letters, digits, \"-\" and \"_\"", kind, name)
+	return false
+}
+
+// validateTokens checks the names and values of a map of theme tokens. Empty
+// values are left unset.
+func (v *validator) validateTokens(path, kind string, tokens map[string]string, valid func(string) bool) {
+	for _, name := range sortedNames(tokens) {
+		tokenPath := path + "/" + escapePointer(name)
+		if !v.validateTokenName(tokenPath, kind, name) {
+			continue
+		}
+		if value := tokens[name]; value != "" && !valid(value) {
+			v.add(SeverityError, "invalid-token", tokenPath, "%s %q has invalid value %q", kind, name, value)
+		}
+	}
+}
+
+func (v *validator) validatePalettes(path string, palettes map[string]models.ColorScale) {
+	for _, name := range sortedNames(palettes) {
+		palettePath := path + "/" + escapePointer(name)
+		if !v.validateTokenName(palettePath, "palette", name) {
+			continue
+		}
+		scale := palettes[name]
+		if len(scale) == 0 {
+			v.add(SeverityWarning, "empty-palette", palettePath, "palette %q has no shades", name)
+		}
+		for _, shade := range sortedNames(scale) {
+			shadePath := palettePath + "/" + escapePointer(shade)
+			if !v.validateTokenName(shadePath, "shade", shade) {
+				continue
+			}
+			if !IsValidColor(scale[shade]) {
+				v.add(SeverityError, "invalid-color", shadePath, "palette %q shade %q has invalid value %q", name, shade, scale[shade])
+			}
+		}
+	}
+}
+
+func (v *validator) validateFontFamilies(families map[string][]string) {
+	for _, name := range sortedNames(families) {
+		path := "/globalConfig/theme/typography/fontFamilies/" + escapePointer(name)
+		if !v.validateTokenName(path, "font family", name) {
+			continue
+		}
+		if len(families[name]) == 0 {
+			v.add(SeverityError, "invalid-token", path, "font family %q lists no fonts", name)
+		}
+		for i, font := range families[name] {
+			if !IsValidFontName(font) {
+				v.add(SeverityError, "invalid-font", fmt.Sprintf("%s/%d", path, i), "font family %q has invalid font name %q", name, font)
+			}
+		}
+	}
+}
+
+func (v *validator) validateDarkTheme(dark models.DarkTheme) {
+	const path = "/globalConfig/theme/dark"
+	if !validDarkMode(dark.Mode) {
+		v.add(SeverityError, "invalid-dark-mode", path+"/mode", "dark mode must be %q or %q, got %q", models.DarkModeMedia, models.DarkModeClass, dark.Mode)
+	}
+
+	for _, color := range []struct {
+		name  string
+		value string
+	}{
+		{"primary", dark.Colors.Primary},
+		{"secondary", dark.Colors.Secondary},
+		{"background", dark.Colors.Background},
+		{"text", dark.Colors.Text},
+	} {
+		if color.value != "" && !IsValidColor(color.value) {
+			v.add(SeverityError, "invalid-color", path+"/colors/"+color.name, "dark theme color %q has invalid value %q", color.name, color.value)
+		}
+	}
+
+	v.validatePalettes(path+"/palettes", dark.Palettes)
+}
+
+func validDarkMode(mode string) bool {
+	return mode == "" || mode == models.DarkModeMedia || mode == models.DarkModeClass
+}
+
+func fontSizes(sizes models.FontSizes) map[string]string {
+	return map[string]string{
+		"sm":   sizes.Small,
+		"base": sizes.Base,
+		"lg":   sizes.Large,
+		"xl":   sizes.XLarge,
+		"2xl":  sizes.XXLarge,
+	}
+}
+
+func spacing(spacing models.Spacing) map[string]string {
+	return map[string]string{
+		"sm": spacing.Small,
+		"md": spacing.Medium,
+		"lg": spacing.Large,
+		"xl": spacing.XLarge,
+	}
+}
+
+// SanitizeTheme returns a copy of theme without the values that fail
+// validation. CSS backends generate code from the sanitized theme, so a
+// project that was never validated still cannot inject CSS or JavaScript.
+func SanitizeTheme(theme models.Theme) models.Theme {
+	clean := theme
+	clean.Colors = sanitizeColors(theme.Colors)
+
+	clean.Typography.FontFamily = keep(theme.Typography.FontFamily, IsValidFontFamily)
+	clean.Typography.FontSizes = models.FontSizes{
+		Small:   keep(theme.Typography.FontSizes.Small, IsValidLength),
+		Base:    keep(theme.Typography.FontSizes.Base, IsValidLength),
+		Large:   keep(theme.Typography.FontSizes.Large, IsValidLength),
+		XLarge:  keep(theme.Typography.FontSizes.XLarge, IsValidLength),
+		XXLarge: keep(theme.Typography.FontSizes.XXLarge, IsValidLength),
+	}
+	clean.Spacing = models.Spacing{
+		Small:  keep(theme.Spacing.Small, IsValidLength),
+		Medium: keep(theme.Spacing.Medium, IsValidLength),
+		Large:  keep(theme.Spacing.Large, IsValidLength),
+		XLarge: keep(theme.Spacing.XLarge, IsValidLength),
+	}
+
+	clean.Typography.FontFamilies = nil
+	for name, fonts := range theme.Typography.FontFamilies {
+		valid := models.IsTokenName(name) && len(fonts) > 0
+		for _, font := range fonts {
+			valid = valid && IsValidFontName(font)
+		}
+		if valid {
+			if clean.Typography.FontFamilies == nil {
+				clean.Typography.FontFamilies = make(map[string][]string)
+			}
+			clean.Typography.FontFamilies[name] = fonts
+		}
+	}
+
+	clean.Typography.LineHeights = sanitizeTokens(theme.Typography.LineHeights, IsValidLineHeight)
+	clean.Radii = sanitizeTokens(theme.Radii, IsValidLength)
+	clean.Shadows = sanitizeTokens(theme.Shadows, IsValidShadow)
+	clean.Breakpoints = sanitizeTokens(theme.Breakpoints, IsValidBreakpoint)
+	clean.Palettes = sanitizePalettes(theme.Palettes)
+
+	if theme.Dark != nil {
+		dark := models.DarkTheme{
+			Mode:     theme.Dark.Mode,
+			Colors:   sanitizeColors(theme.Dark.Colors),
+			Palettes: sanitizePalettes(theme.Dark.Palettes),
+		}
+		if !validDarkMode(dark.Mode) {
+			dark.Mode = ""
+		}
+		clean.Dark = &dark
+	}
+	return clean
+}
+
+// keep returns value if it is valid and "" otherwise
+func keep(value string, valid func(string) bool) string {
+	if valid(value) {
+		return value
+	}
+	return ""
+}
+
+func sanitizeColors(colors models.Colors) models.Colors {
+	return models.Colors{
+		Primary:    keep(colors.Primary, IsValidColor),
+		Secondary:  keep(colors.Secondary, IsValidColor),
+		Background: keep(colors.Background, IsValidColor),
+		Text:       keep(colors.Text, IsValidColor),
+	}
+}
+
+func sanitizeTokens(tokens map[string]string, valid func(string) bool) map[string]string {
+	var clean map[string]string
+	for name, value := range tokens {
+		if models.IsTokenName(name) && valid(value) {
+			if clean == nil {
+				clean = make(map[string]string)
+			}
+			clean[name] = value
+		}
+	}
+	return clean
+}
+
+func sanitizePalettes(palettes map[string]models.ColorScale) map[string]models.ColorScale {
+	var clean map[string]models.ColorScale
+	for name, scale := range palettes {
+		if !models.IsTokenName(name) {
+			continue
+		}
+		if shades := sanitizeTokens(scale, IsValidColor); shades != nil {
+			if clean == nil {
+				clean = make(map[string]models.ColorScale)
+			}
+			clean[name] = shades
+		}
+	}
+	return clean
+}
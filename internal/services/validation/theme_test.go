@@ -0,0 +1,216 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	"sawthet.go-press-server.net/internal/models"
+	"sawthet.go-press-server.net/internal/models/modelstest"
+)
+
+// hostileValues try to break out of a CSS declaration, a style element or
+// the JSON/JavaScript config the theme is written to
+var hostileValues = []string{
+	`red; } body { display: none`,
+	`red"`,
+	`'red'`,
+	`red}`,
+	`{red`,
+	`red;`,
+	`red</style><script>alert(1)</script>`,
+	`url(javascript:alert(1))`,
+	`url("https://example.com/x.png")`,
+	`expression(alert(1))`,
+	"red\n}",
+	"red\r\nbody{}",
+	`\72 ed`,
+	`red\`,
+	`rgb(0, 0, 0); }`,
+	`#fff;`,
+	`1px; }`,
+	`10px</style>`,
+	"",
+}
+
+func TestValidatorsRejectHostileValues(t *testing.T) {
+	validators := map[string]func(string) bool{
+		"IsValidColor":      IsValidColor,
+		"IsValidLength":     IsValidLength,
+		"IsValidBreakpoint": IsValidBreakpoint,
+		"IsValidLineHeight": IsValidLineHeight,
+		"IsValidFontName":   IsValidFontName,
+		"IsValidFontFamily": IsValidFontFamily,
+		"IsValidShadow":     IsValidShadow,
+	}
+	for name, valid := range validators {
+		for _, value := range hostileValues {
+			if valid(value) {
+				t.Errorf("%s(%q) = true, want false", name, value)
+			}
+		}
+	}
+}
+
+func TestIsValidColor(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"#fff", true},
+		{"#ffffff", true},
+		{"#ffffff80", true},
+		{"rgb(0, 128, 255)", true},
+		{"rgba(0, 128, 255, 0.5)", true},
+		{"hsl(120 50% 50% / 50%)", true},
+		{"rebeccapurple", true},
+		{"#ffff", true},
+		{"#ff", false},
+		{"#gggggg", false},
+		{"rgb(0, 0)", false},
+		{"rgb(0, 0, 0", false},
+		{"rgb(var(--x), 0, 0)", false},
+		{"red blue", false},
+		{"calc(1px)", false},
+	}
+	for _, tt := range tests {
+		if got := IsValidColor(tt.value); got != tt.want {
+			t.Errorf("IsValidColor(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIsValidLength(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"0", true},
+		{"1px", true},
+		{"1.5rem", true},
+		{".5em", true},
+		{"-2px", true},
+		{"100%", true},
+		{"50vh", true},
+		{"1", false},
+		{"px", false},
+		{"1 px", false},
+		{"1px 2px", false},
+		{"calc(1px + 2px)", false},
+		{"var(--x)", false},
+		{"1PX", false},
+		{"1e3px", false},
+	}
+	for _, tt := range tests {
+		if got := IsValidLength(tt.value); got != tt.want {
+			t.Errorf("IsValidLength(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIsValidFontFamily(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"Inter", true},
+		{"Inter, sans-serif", true},
+		{"Open Sans, Helvetica Neue, Arial", true},
+		{"Source_Code_Pro", true},
+		{"Inter,", false},
+		{",Inter", false},
+		{`"Open Sans"`, false},
+		{"'Open Sans'", false},
+		{"Inter;", false},
+		{"Inter\n", false},
+		{"Inter\t", false},
+		{"Inter  Sans", false},
+		{"Inter-", false},
+		{`Inter\, Arial`, false},
+	}
+	for _, tt := range tests {
+		if got := IsValidFontFamily(tt.value); got != tt.want {
+			t.Errorf("IsValidFontFamily(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIsValidShadow(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"none", true},
+		{"0 1px 2px #0000001a", true},
+		{"inset 0 2px 4px rgb(0, 0, 0, 0.1)", true},
+		{"0 1px 3px rgba(0, 0, 0, 0.1), 0 1px 2px rgba(0, 0, 0, 0.06)", true},
+		{"0 0 0 1px 2px", false},
+		{"1px", false},
+		{"0 1px black black url(x)", false},
+		{"0 1px 2px rgba(0, 0, 0, 0.1", false},
+		{"0 1px 2px rgba(0, 0, 0, 0.1))", false},
+		{"0 1px 2px expression(alert(1))", false},
+		{"0 1px 2px red;", false},
+		{"0 1px 2px red, none", false},
+	}
+	for _, tt := range tests {
+		if got := IsValidShadow(tt.value); got != tt.want {
+			t.Errorf("IsValidShadow(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeThemeDropsHostileValues(t *testing.T) {
+	for _, value := range hostileValues {
+		if value == "" {
+			continue
+		}
+		clean := SanitizeTheme(modelstest.HostileTheme(value))
+
+		// Every remaining value must pass its own validator, and nothing
+		// hostile may survive in names or values
+		props := append(clean.Properties(), clean.DarkProperties()...)
+		for _, prop := range props {
+			if strings.Contains(prop.Name, value) || strings.Contains(prop.Value, value) {
+				t.Errorf("SanitizeTheme kept %q in property %s: %s", value, prop.Name, prop.Value)
+			}
+		}
+		if clean.Dark == nil || clean.Dark.Mode != "" {
+			t.Errorf("SanitizeTheme kept dark theme %+v", clean.Dark)
+		}
+		v := &validator{}
+		v.validateTheme(clean)
+		if HasErrors(v.issues) {
+			t.Errorf("sanitized theme for %q still has errors: %v", value, v.issues)
+		}
+	}
+}
+
+func TestSanitizeThemeKeepsValidValues(t *testing.T) {
+	theme := models.Theme{
+		Colors:      models.Colors{Primary: "#3b82f6", Secondary: "rgb(0, 0, 0)", Background: "white", Text: "#111"},
+		Typography:  models.Typography{FontFamily: "Inter, sans-serif", LineHeights: map[string]string{"tight": "1.25"}},
+		Spacing:     models.Spacing{Small: "0.5rem"},
+		Palettes:    map[string]models.ColorScale{"brand": {"500": "#ff0000"}},
+		Radii:       map[string]string{"DEFAULT": "4px"},
+		Shadows:     map[string]string{"md": "0 1px 2px #0000001a"},
+		Breakpoints: map[string]string{"tablet": "640px"},
+		Dark:        &models.DarkTheme{Mode: models.DarkModeClass, Colors: models.Colors{Background: "#000"}},
+	}
+	clean := SanitizeTheme(theme)
+
+	if clean.Colors != theme.Colors {
+		t.Errorf("colors = %+v, want %+v", clean.Colors, theme.Colors)
+	}
+	if clean.Typography.FontFamily != "Inter, sans-serif" || clean.Typography.LineHeights["tight"] != "1.25" {
+		t.Errorf("typography = %+v", clean.Typography)
+	}
+	if clean.Spacing.Small != "0.5rem" || clean.Palettes["brand"]["500"] != "#ff0000" {
+		t.Errorf("spacing or palettes dropped: %+v %+v", clean.Spacing, clean.Palettes)
+	}
+	if clean.Radii["DEFAULT"] != "4px" || clean.Shadows["md"] == "" || clean.Breakpoints["tablet"] != "640px" {
+		t.Errorf("tokens dropped: %+v %+v %+v", clean.Radii, clean.Shadows, clean.Breakpoints)
+	}
+	if clean.Dark == nil || clean.Dark.Mode != models.DarkModeClass || clean.Dark.Colors.Background != "#000" {
+		t.Errorf("dark theme = %+v", clean.Dark)
+	}
+}
@@ -0,0 +1,181 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sawthet.go-press-server.net/internal/models"
+)
+
+type Severity string
+
+const (
+	// SeverityError marks issues that would break the build or its output
+	SeverityError Severity = "error"
+	// SeverityWarning marks issues worth fixing that do not block a build
+	SeverityWarning Severity = "warning"
+)
+
+// ValidationIssue is a single problem found in a project document. Path is a
+// JSON pointer (RFC 6901) to the offending value.
+type ValidationIssue struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Path     string   `json:"path"`
+	Message  string   `json:"message"`
+}
+
+var (
+	// slugPattern allows "/" and nested slugs such as "/blog/my-post"
+	slugPattern = regexp.MustCompile(`^/([A-Za-z0-9_-]+(/[A-Za-z0-9_-]+)*)?$`)
+
+	hexColorPattern  = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	funcColorPattern = regexp.MustCompile(`^(rgb|rgba|hsl|hsla)\(\s*[0-9.%]+(\s*[,\s]\s*[0-9.%]+){2}(\s*[,/]\s*[0-9.%]+)?\s*\)$`)
+	namedColor       = regexp.MustCompile(`^[a-zA-Z]+$`)
+)
+
+// validator accumulates issues while walking a project
+type validator struct {
+	issues       []ValidationIssue
+	componentIDs map[string]string
+}
+
+// Validate checks a project for structural problems before it is built
+func Validate(project models.Project) []ValidationIssue {
+	v := &validator{
+		issues:       []ValidationIssue{},
+		componentIDs: make(map[string]string),
+	}
+
+	v.validateTheme(project.GlobalConfig.Theme)
+	v.validatePages(project.Pages)
+
+	if project.Header.Component != nil {
+		v.validateComponent("/header", project.Header.Component)
+	}
+	if project.Footer.Component != nil {
+		v.validateComponent("/footer", project.Footer.Component)
+	}
+
+	return v.issues
+}
+
+// HasErrors reports whether any issue is severe enough to block a build
+func HasErrors(issues []ValidationIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidColor reports whether a value is a CSS hex, functional or named color
+func IsValidColor(value string) bool {
+	return hexColorPattern.MatchString(value) ||
+		funcColorPattern.MatchString(value) ||
+		namedColor.MatchString(value)
+}
+
+func (v *validator) add(severity Severity, code, path, format string, args ...any) {
+	v.issues = append(v.issues, ValidationIssue{
+		Severity: severity,
+		Code:     code,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) validatePages(pages []models.Page) {
+	if len(pages) == 0 {
+		v.add(SeverityWarning, "no-pages", "/pages", "project has no pages")
+		return
+	}
+
+	pageIDs := make(map[string]string)
+	filenames := make(map[string]string)
+
+	for i, page := range pages {
+		path := fmt.Sprintf("/pages/%d", i)
+
+		if page.ID == "" {
+			v.add(SeverityWarning, "missing-id", path+"/id", "page has no ID")
+		} else if other, exists := pageIDs[page.ID]; exists {
+			v.add(SeverityError, "duplicate-id", path+"/id", "page ID %q is already used by %s", page.ID, other)
+		} else {
+			pageIDs[page.ID] = path
+		}
+
+		if page.Title == "" {
+			v.add(SeverityWarning, "missing-title", path+"/title", "page has no title")
+		}
+
+		if !slugPattern.MatchString(page.Slug) {
+			v.add(SeverityError, "invalid-slug", path+"/slug", "slug %q must start with \"/\" and contain only letters, digits, \"-\" and \"_\"", page.Slug)
+		} else {
+			// Pages are written to a file named after their slug, so two
+			// pages mapping to the same file would overwrite each other
+			filename := strings.ToLower(page.Filename())
+			if other, exists := filenames[filename]; exists {
+				v.add(SeverityError, "duplicate-slug", path+"/slug", "slug %q clashes with %s", page.Slug, other)
+			} else {
+				filenames[filename] = path
+			}
+		}
+
+		for j, wrapper := range page.Components {
+			v.validateComponent(fmt.Sprintf("%s/components/%d", path, j), wrapper.Component)
+		}
+	}
+}
+
+func (v *validator) validateComponent(path string, component models.Component) {
+	if component == nil {
+		v.add(SeverityError, "missing-component", path, "component is empty")
+		return
+	}
+
+	if id := component.GetID(); id != "" {
+		if other, exists := v.componentIDs[id]; exists {
+			v.add(SeverityError, "duplicate-id", path+"/id", "component ID %q is already used by %s", id, other)
+		} else {
+			v.componentIDs[id] = path
+		}
+	}
+
+	switch c := component.(type) {
+	case *models.LinkComponent:
+		if strings.TrimSpace(c.Href) == "" {
+			v.add(SeverityError, "empty-href", path+"/href", "link has no href")
+		}
+	case *models.ImageComponent:
+		if strings.TrimSpace(c.Src) == "" {
+			v.add(SeverityError, "empty-src", path+"/src", "image has no src")
+		}
+		if strings.TrimSpace(c.Alt) == "" {
+			v.add(SeverityWarning, "missing-alt", path+"/alt", "image has no alt text")
+		}
+	}
+
+	for i, child := range component.GetChildren() {
+		v.validateComponent(fmt.Sprintf("%s/children/%d", path, i), child)
+	}
+}
+
+// sortedNames returns the keys of a map, sorted so issues are reported in a
+// stable order
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// escapePointer escapes a key for use as a JSON pointer token
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
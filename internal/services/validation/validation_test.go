@@ -0,0 +1,200 @@
+package validation
+
+import (
+	"reflect"
+	"testing"
+
+	"sawthet.go-press-server.net/internal/models"
+)
+
+// issue identifies a validation issue by everything but its message
+type issue struct {
+	Severity Severity
+	Code     string
+	Path     string
+}
+
+// page returns a page with the given slug and components
+func page(id, slug string, components ...models.Component) models.Page {
+	page := models.Page{ID: id, Title: id, Slug: slug, Components: []models.ComponentWrapper{}}
+	for _, component := range components {
+		page.Components = append(page.Components, models.ComponentWrapper{Component: component})
+	}
+	return page
+}
+
+// block returns a block component holding children
+func block(id string, children ...models.Component) *models.BlockComponent {
+	c := &models.BlockComponent{BaseComponent: models.BaseComponent{Type: "block", ID: id}}
+	for _, child := range children {
+		c.Children = append(c.Children, models.ComponentWrapper{Component: child})
+	}
+	return c
+}
+
+func text(id string) *models.TextComponent {
+	return &models.TextComponent{BaseComponent: models.BaseComponent{Type: "text", ID: id}}
+}
+
+func link(id, href string) *models.LinkComponent {
+	return &models.LinkComponent{BaseComponent: models.BaseComponent{Type: "link", ID: id}, Href: href}
+}
+
+func image(id, src, alt string) *models.ImageComponent {
+	return &models.ImageComponent{BaseComponent: models.BaseComponent{Type: "image", ID: id}, Src: src, Alt: alt}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		project models.Project
+		want    []issue
+	}{
+		{
+			name:    "valid project",
+			project: models.Project{Pages: []models.Page{page("home", "/", link("a", "/about"), image("b", "/logo.png", "Logo")), page("about", "/about")}},
+			want:    []issue{},
+		},
+		{
+			name:    "no pages",
+			project: models.Project{},
+			want:    []issue{{SeverityWarning, "no-pages", "/pages"}},
+		},
+		{
+			name: "missing page ID and title",
+			project: models.Project{Pages: []models.Page{
+				{Slug: "/"},
+			}},
+			want: []issue{
+				{SeverityWarning, "missing-id", "/pages/0/id"},
+				{SeverityWarning, "missing-title", "/pages/0/title"},
+			},
+		},
+		{
+			name:    "duplicate page IDs",
+			project: models.Project{Pages: []models.Page{page("home", "/"), page("home", "/home")}},
+			want:    []issue{{SeverityError, "duplicate-id", "/pages/1/id"}},
+		},
+		{
+			name: "invalid slugs",
+			project: models.Project{Pages: []models.Page{
+				page("a", "about"),
+				page("b", "/blog/"),
+				page("c", "/../etc"),
+				page("d", "/a b"),
+				page("e", ""),
+			}},
+			want: []issue{
+				{SeverityError, "invalid-slug", "/pages/0/slug"},
+				{SeverityError, "invalid-slug", "/pages/1/slug"},
+				{SeverityError, "invalid-slug", "/pages/2/slug"},
+				{SeverityError, "invalid-slug", "/pages/3/slug"},
+				{SeverityError, "invalid-slug", "/pages/4/slug"},
+			},
+		},
+		{
+			name: "slugs writing the same file",
+			project: models.Project{Pages: []models.Page{
+				page("home", "/"),
+				page("index", "/index"),
+				page("about", "/about"),
+				page("About", "/About"),
+				page("post", "/blog/post"),
+				page("nested", "/Blog/Post"),
+			}},
+			want: []issue{
+				{SeverityError, "duplicate-slug", "/pages/1/slug"},
+				{SeverityError, "duplicate-slug", "/pages/3/slug"},
+				{SeverityError, "duplicate-slug", "/pages/5/slug"},
+			},
+		},
+		{
+			name: "duplicate component IDs across pages, header, footer and children",
+			project: models.Project{
+				Pages: []models.Page{
+					page("home", "/", text("title"), block("main", text("title"))),
+					page("about", "/about", text("main")),
+				},
+				Header: models.ComponentWrapper{Component: block("nav", link("title", "/"))},
+				Footer: models.ComponentWrapper{Component: text("nav")},
+			},
+			want: []issue{
+				{SeverityError, "duplicate-id", "/pages/0/components/1/children/0/id"},
+				{SeverityError, "duplicate-id", "/pages/1/components/0/id"},
+				{SeverityError, "duplicate-id", "/header/children/0/id"},
+				{SeverityError, "duplicate-id", "/footer/id"},
+			},
+		},
+		{
+			name:    "components without IDs",
+			project: models.Project{Pages: []models.Page{page("home", "/", text(""), text(""))}},
+			want:    []issue{},
+		},
+		{
+			name: "links and images without targets",
+			project: models.Project{Pages: []models.Page{page("home", "/",
+				link("a", ""),
+				link("b", "  "),
+				image("c", "", "Photo"),
+				block("d", image("e", "/x.png", " ")),
+			)}},
+			want: []issue{
+				{SeverityError, "empty-href", "/pages/0/components/0/href"},
+				{SeverityError, "empty-href", "/pages/0/components/1/href"},
+				{SeverityError, "empty-src", "/pages/0/components/2/src"},
+				{SeverityWarning, "missing-alt", "/pages/0/components/3/children/0/alt"},
+			},
+		},
+		{
+			name: "image without src or alt in the footer",
+			project: models.Project{
+				Pages:  []models.Page{page("home", "/")},
+				Footer: models.ComponentWrapper{Component: image("logo", "", "")},
+			},
+			want: []issue{
+				{SeverityError, "empty-src", "/footer/src"},
+				{SeverityWarning, "missing-alt", "/footer/alt"},
+			},
+		},
+		{
+			name: "empty components",
+			project: models.Project{Pages: []models.Page{{
+				ID: "home", Title: "Home", Slug: "/",
+				Components: []models.ComponentWrapper{{Component: block("a")}, {}},
+			}}},
+			want: []issue{{SeverityError, "missing-component", "/pages/0/components/1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		// Theme issues are covered by the theme tests
+		tt.project.GlobalConfig.Theme.Colors = models.Colors{Primary: "#3b82f6", Secondary: "#64748b", Background: "white", Text: "#111"}
+
+		got := []issue{}
+		for _, found := range Validate(tt.project) {
+			if found.Message == "" {
+				t.Errorf("%s: issue %s at %s has no message", tt.name, found.Code, found.Path)
+			}
+			got = append(got, issue{found.Severity, found.Code, found.Path})
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %v\nwant %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHasErrors(t *testing.T) {
+	tests := []struct {
+		issues []ValidationIssue
+		want   bool
+	}{
+		{nil, false},
+		{[]ValidationIssue{{Severity: SeverityWarning}}, false},
+		{[]ValidationIssue{{Severity: SeverityWarning}, {Severity: SeverityError}}, true},
+	}
+	for _, tt := range tests {
+		if got := HasErrors(tt.issues); got != tt.want {
+			t.Errorf("HasErrors(%v) = %t, want %t", tt.issues, got, tt.want)
+		}
+	}
+}
@@ -1,9 +1,9 @@
 package websocket
 
 import (
-	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -11,15 +11,47 @@ import (
 	"sawthet.go-press-server.net/internal/services/job"
 )
 
+const (
+	// writeWait is how long a single write may take before the connection
+	// is considered dead
+	writeWait = 10 * time.Second
+	// pongWait is how long a client may stay silent, pongs included
+	pongWait = 60 * time.Second
+	// pingPeriod is how often clients are pinged; it must be below pongWait
+	pingPeriod = pongWait * 9 / 10
+)
+
+// SocketManager streams job progress to WebSocket clients. Any number of
+// clients can watch the same job; each receives every update.
 type SocketManager struct {
-	clients    map[string]*websocket.Conn
-	clientsMux sync.RWMutex
+	clients    map[*client]struct{}
+	clientsMux sync.Mutex
 	jobQueue   *job.JobQueue
 }
 
+// client is one WebSocket connection watching a job. Only its write loop
+// writes data frames to conn.
+type client struct {
+	conn *websocket.Conn
+	sub  *job.Subscription
+}
+
+// logMessage is a line of a job's build log, tagged so clients can tell it
+// from progress events
+type logMessage struct {
+	Type      string `json:"type"`
+	JobID     string `json:"jobId"`
+	ProjectID string `json:"projectId"`
+	job.LogEntry
+}
+
+func newLogMessage(event job.Event) logMessage {
+	return logMessage{Type: "log", JobID: event.JobID, ProjectID: event.ProjectID, LogEntry: *event.Log}
+}
+
 func NewSocketManager(jobQueue *job.JobQueue) *SocketManager {
 	return &SocketManager{
-		clients:  make(map[string]*websocket.Conn),
+		clients:  make(map[*client]struct{}),
 		jobQueue: jobQueue,
 	}
 }
@@ -40,6 +72,30 @@ func (sm *SocketManager) HandleConnection(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// since asks for the events after that sequence number, so that clients
+	// can rebuild the timeline or resume after reconnecting
+	var since uint64
+	resume := r.URL.Query().Has("since")
+	if resume {
+		var err error
+		since, err = strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+		if err != nil {
+			http.Error(w, "since must be a sequence number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// logs asks for the lines added to the job's build log as well
+	var logs bool
+	if r.URL.Query().Has("logs") {
+		var err error
+		logs, err = strconv.ParseBool(r.URL.Query().Get("logs"))
+		if err != nil {
+			http.Error(w, "logs must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade connection: %v", err)
@@ -47,86 +103,103 @@ func (sm *SocketManager) HandleConnection(w http.ResponseWriter, r *http.Request
 	}
 	defer conn.Close()
 
+	snapshot, backlog, sub, err := sm.jobQueue.Subscribe(jobID, since, resume, logs)
+	if err != nil {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		conn.WriteJSON(job.Event{JobID: jobID, ProgressUpdate: job.ProgressUpdate{
+			Status:  job.StatusFailed,
+			Message: "Error: " + err.Error(),
+			At:      time.Now(),
+		}})
+		closeConn(conn, websocket.CloseNormalClosure, err.Error())
+		return
+	}
+
+	c := &client{conn: conn, sub: sub}
 	sm.clientsMux.Lock()
-	sm.clients[jobID] = conn
+	sm.clients[c] = struct{}{}
 	sm.clientsMux.Unlock()
 
-	go sm.monitorJobProgress(jobID, conn)
-
+	defer func() {
+		sub.Unsubscribe()
+		sm.clientsMux.Lock()
+		delete(sm.clients, c)
+		sm.clientsMux.Unlock()
+	}()
+
+	go c.writeLoop(backlog, snapshot.Status)
+
+	// Clients only send control frames; reading processes them and notices
+	// when the connection goes away
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
 	for {
-		_, _, err := conn.ReadMessage()
-		if err != nil {
-			sm.clientsMux.Lock()
-			delete(sm.clients, jobID)
-			sm.clientsMux.Unlock()
-			break
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
 		}
 	}
 }
 
-func (sm *SocketManager) monitorJobProgress(jobID string, conn *websocket.Conn) {
-	buildJob, err := sm.jobQueue.GetJobStatus(jobID)
-	if err != nil {
-		sm.sendProgress(conn, jobID, string(job.StatusFailed), 0, fmt.Sprintf("Error: %v", err))
-		sm.cleanupConnection(jobID, conn)
-		return
-	}
+// writeLoop sends the backlog and then every event, and log line if asked
+// for, until the job finishes, the client falls behind or the connection
+// fails
+func (c *client) writeLoop(backlog []job.Event, status job.JobStatus) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
 
-	// If job is already completed or failed, send final status and return
-	if buildJob.Status == job.StatusCompleted || buildJob.Status == job.StatusFailed {
-		sm.sendProgress(conn, jobID, string(buildJob.Status), buildJob.Progress, buildJob.Message)
-		sm.cleanupConnection(jobID, conn)
-		return
+	for _, event := range backlog {
+		if !c.write(event) {
+			return
+		}
 	}
 
-	// Monitor progress updates
 	for {
 		select {
-		case progress := <-buildJob.ProgressChan:
-			sm.sendProgress(conn, jobID, string(progress.Status), progress.Progress, progress.Message)
-
-			if progress.Status == job.StatusCompleted || progress.Status == job.StatusFailed {
-				sm.cleanupConnection(jobID, conn)
+		case event, ok := <-c.sub.C:
+			if !ok {
+				switch {
+				case c.sub.Evicted():
+					closeConn(c.conn, websocket.CloseTryAgainLater, "Client too slow")
+				case status.IsFinal():
+					closeConn(c.conn, websocket.CloseNormalClosure, "Job completed")
+				}
+				return
+			}
+			var msg any = event
+			if event.Log != nil {
+				msg = newLogMessage(event)
+			} else {
+				status = event.Status
+			}
+			if !c.write(msg) {
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				c.conn.Close()
 				return
 			}
-		case <-time.After(30 * time.Second):
-			sm.sendProgress(conn, jobID, string(job.StatusFailed), 0, "Connection timeout")
-			sm.cleanupConnection(jobID, conn)
-			return
 		}
 	}
 }
 
-func (sm *SocketManager) sendProgress(conn *websocket.Conn, jobID, status string, progress int, message string) {
-	msg := struct {
-		JobID    string `json:"jobId"`
-		Status   string `json:"status"`
-		Progress int    `json:"progress"`
-		Message  string `json:"message"`
-	}{
-		JobID:    jobID,
-		Status:   status,
-		Progress: progress,
-		Message:  message,
-	}
-
-	if err := conn.WriteJSON(msg); err != nil {
+// write sends a message, closing the connection if it fails
+func (c *client) write(msg any) bool {
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := c.conn.WriteJSON(msg); err != nil {
 		log.Printf("Error sending message: %v", err)
+		c.conn.Close()
+		return false
 	}
+	return true
 }
 
-// cleanupConnection closes the WebSocket connection and removes it from the clients map
-func (sm *SocketManager) cleanupConnection(jobID string, conn *websocket.Conn) {
-	// Send close message
-	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Job completed"))
-
-	// Close the connection
+// closeConn sends a close frame and closes the connection
+func closeConn(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
 	conn.Close()
-
-	// Remove from clients map
-	sm.clientsMux.Lock()
-	delete(sm.clients, jobID)
-	sm.clientsMux.Unlock()
 }
 
 // Cleanup closes all active WebSocket connections
@@ -134,14 +207,8 @@ func (sm *SocketManager) Cleanup() {
 	sm.clientsMux.Lock()
 	defer sm.clientsMux.Unlock()
 
-	for jobID, conn := range sm.clients {
-		// Send close message
-		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "Server shutting down"))
-
-		// Close connection
-		conn.Close()
-
-		// Remove from map
-		delete(sm.clients, jobID)
+	for c := range sm.clients {
+		closeConn(c.conn, websocket.CloseGoingAway, "Server shutting down")
+		delete(sm.clients, c)
 	}
 }
@@ -0,0 +1,222 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"sawthet.go-press-server.net/internal/services/job"
+)
+
+const (
+	// maxWatched limits the jobs and projects one stream watches at a time
+	maxWatched = 500
+	// maxRequestBytes limits the size of a client's request
+	maxRequestBytes = 4096
+)
+
+const (
+	// StreamProtocol is the subprotocol a stream answers with when a client
+	// presents its token as a subprotocol
+	StreamProtocol = "press.stream"
+	// tokenProtocolPrefix marks the subprotocol carrying a client's token,
+	// for browsers that cannot set headers on WebSockets
+	tokenProtocolPrefix = "bearer."
+)
+
+// streamUpgrader answers with StreamProtocol, which browsers require when
+// they offered subprotocols
+var streamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  upgrader.ReadBufferSize,
+	WriteBufferSize: upgrader.WriteBufferSize,
+	CheckOrigin:     upgrader.CheckOrigin,
+	Subprotocols:    []string{StreamProtocol},
+}
+
+// StreamToken returns the token a client offered as the "bearer.<token>"
+// subprotocol, if any
+func StreamToken(r *http.Request) (string, bool) {
+	for _, protocol := range websocket.Subprotocols(r) {
+		if token, found := strings.CutPrefix(protocol, tokenProtocolPrefix); found {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// streamRequest is a message from a stream client
+type streamRequest struct {
+	// Type is "subscribe", "unsubscribe" or "ping"
+	Type      string `json:"type"`
+	JobID     string `json:"jobId,omitempty"`
+	ProjectID string `json:"projectId,omitempty"`
+	// Since resumes a job subscription after that sequence number
+	Since *uint64 `json:"since,omitempty"`
+	// Logs asks for the lines added to the build logs of the jobs as well
+	Logs bool `json:"logs,omitempty"`
+
+	malformed bool
+}
+
+// streamReply answers a stream request
+type streamReply struct {
+	// Type is "subscribed", "unsubscribed", "pong" or "error"
+	Type      string `json:"type"`
+	JobID     string `json:"jobId,omitempty"`
+	ProjectID string `json:"projectId,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// streamEvent is an event of a watched job, tagged with its job and project
+type streamEvent struct {
+	Type string `json:"type"`
+	job.Event
+}
+
+// HandleStream serves one WebSocket over which a client watches any number
+// of jobs and projects. Clients send subscribe and unsubscribe requests and
+// receive the events of everything they watch, as well as replies to their
+// requests; application-level pings are answered for clients, such as
+// browsers, that cannot send WebSocket pings.
+func (sm *SocketManager) HandleStream(w http.ResponseWriter, r *http.Request) {
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	feed := sm.jobQueue.NewFeed()
+	c := &client{conn: conn, sub: feed}
+	sm.clientsMux.Lock()
+	sm.clients[c] = struct{}{}
+	sm.clientsMux.Unlock()
+
+	defer func() {
+		feed.Unsubscribe()
+		sm.clientsMux.Lock()
+		delete(sm.clients, c)
+		sm.clientsMux.Unlock()
+	}()
+
+	requests := make(chan streamRequest)
+	done := make(chan struct{})
+	go c.streamLoop(sm.jobQueue, requests, done)
+
+	conn.SetReadLimit(maxRequestBytes)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var req streamRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			req = streamRequest{malformed: true}
+		}
+		select {
+		case requests <- req:
+		case <-done:
+			return
+		}
+	}
+}
+
+// streamLoop is the only writer of a stream connection. It sends the events
+// of the feed and handles the client's requests in order, so the reply to a
+// subscription precedes the job's events.
+func (c *client) streamLoop(queue *job.JobQueue, requests <-chan streamRequest, done chan<- struct{}) {
+	defer close(done)
+	// Closing the connection stops the reader
+	defer c.conn.Close()
+
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		var msg any
+		select {
+		case event, ok := <-c.sub.C:
+			if !ok {
+				if c.sub.Evicted() {
+					closeConn(c.conn, websocket.CloseTryAgainLater, "Client too slow")
+				}
+				return
+			}
+			if event.Log != nil {
+				msg = newLogMessage(event)
+			} else {
+				msg = streamEvent{Type: "event", Event: event}
+			}
+		case req := <-requests:
+			msg = c.handleRequest(queue, req)
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
+			continue
+		}
+
+		c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := c.conn.WriteJSON(msg); err != nil {
+			log.Printf("Error sending message: %v", err)
+			return
+		}
+	}
+}
+
+// handleRequest changes what the stream watches and returns the reply
+func (c *client) handleRequest(queue *job.JobQueue, req streamRequest) streamReply {
+	fail := func(format string, args ...any) streamReply {
+		return streamReply{Type: "error", JobID: req.JobID, ProjectID: req.ProjectID, Message: fmt.Sprintf(format, args...)}
+	}
+
+	switch {
+	case req.malformed:
+		return fail("request must be a JSON object")
+	case req.Type == "ping":
+		return streamReply{Type: "pong"}
+	case req.Type != "subscribe" && req.Type != "unsubscribe":
+		return fail("unknown request type %q", req.Type)
+	case (req.JobID == "") == (req.ProjectID == ""):
+		return fail("%s requires either jobId or projectId", req.Type)
+	case req.Since != nil && req.JobID == "":
+		return fail("since only applies to job subscriptions")
+	case req.Logs && req.Type == "unsubscribe":
+		return fail("logs only applies to subscriptions")
+	}
+
+	if req.Type == "unsubscribe" {
+		if req.JobID != "" {
+			c.sub.UnwatchJob(req.JobID)
+		} else {
+			c.sub.UnwatchProject(req.ProjectID)
+		}
+		return streamReply{Type: "unsubscribed", JobID: req.JobID, ProjectID: req.ProjectID}
+	}
+
+	if c.sub.Watching() >= maxWatched {
+		return fail("a stream can watch at most %d jobs and projects", maxWatched)
+	}
+	if req.JobID != "" {
+		var since uint64
+		if req.Since != nil {
+			since = *req.Since
+		}
+		if err := queue.WatchJob(c.sub, req.JobID, since, req.Since != nil, req.Logs); err != nil {
+			return fail("%v", err)
+		}
+	} else {
+		queue.WatchProject(c.sub, req.ProjectID, req.Logs)
+	}
+	return streamReply{Type: "subscribed", JobID: req.JobID, ProjectID: req.ProjectID}
+}
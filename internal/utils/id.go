@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"regexp"
+	"time"
+)
+
+// validID restricts IDs to characters that are safe in file names and URLs
+var validID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,127}$`)
+
+// ValidID reports whether an ID is safe to use as a file name or URL segment
+func ValidID(id string) bool {
+	return validID.MatchString(id)
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewID returns a new ULID: a 26 character, lexicographically sortable
+// identifier made of a millisecond timestamp followed by 80 random bits
+func NewID() string {
+	var raw [16]byte
+
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixMilli()))
+	copy(raw[:6], ts[2:])
+
+	if _, err := rand.Read(raw[6:]); err != nil {
+		panic(err)
+	}
+
+	// Encode the 128 bits as 26 base32 characters, most significant first
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(raw[:8])
+	lo := binary.BigEndian.Uint64(raw[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(out[:])
+}